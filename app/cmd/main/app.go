@@ -9,16 +9,58 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/charopevez/eob-accountant-worker/internal/accounts"
 	"github.com/charopevez/eob-accountant-worker/internal/accounts/db"
+	"github.com/charopevez/eob-accountant-worker/internal/alerts"
+	alertdb "github.com/charopevez/eob-accountant-worker/internal/alerts/db"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/internal/challenge"
 	"github.com/charopevez/eob-accountant-worker/internal/config"
+	"github.com/charopevez/eob-accountant-worker/internal/directory"
+	"github.com/charopevez/eob-accountant-worker/internal/identities"
+	identitydb "github.com/charopevez/eob-accountant-worker/internal/identities/db"
+	"github.com/charopevez/eob-accountant-worker/internal/impersonation"
+	impersonationdb "github.com/charopevez/eob-accountant-worker/internal/impersonation/db"
+	"github.com/charopevez/eob-accountant-worker/internal/invites"
+	invitesdb "github.com/charopevez/eob-accountant-worker/internal/invites/db"
+	"github.com/charopevez/eob-accountant-worker/internal/logins"
+	loginsdb "github.com/charopevez/eob-accountant-worker/internal/logins/db"
+	"github.com/charopevez/eob-accountant-worker/internal/magiclink"
+	magiclinkdb "github.com/charopevez/eob-accountant-worker/internal/magiclink/db"
+	"github.com/charopevez/eob-accountant-worker/internal/mfa"
+	mfadb "github.com/charopevez/eob-accountant-worker/internal/mfa/db"
+	"github.com/charopevez/eob-accountant-worker/internal/oauth"
+	oauthdb "github.com/charopevez/eob-accountant-worker/internal/oauth/db"
+	"github.com/charopevez/eob-accountant-worker/internal/oidc"
+	"github.com/charopevez/eob-accountant-worker/internal/otp"
+	otpdb "github.com/charopevez/eob-accountant-worker/internal/otp/db"
+	"github.com/charopevez/eob-accountant-worker/internal/passkeys"
+	passkeydb "github.com/charopevez/eob-accountant-worker/internal/passkeys/db"
+	"github.com/charopevez/eob-accountant-worker/internal/pat"
+	patdb "github.com/charopevez/eob-accountant-worker/internal/pat/db"
+	"github.com/charopevez/eob-accountant-worker/internal/referrals"
+	referralsdb "github.com/charopevez/eob-accountant-worker/internal/referrals/db"
+	"github.com/charopevez/eob-accountant-worker/internal/revocation"
+	revocationdb "github.com/charopevez/eob-accountant-worker/internal/revocation/db"
+	"github.com/charopevez/eob-accountant-worker/internal/scim"
+	"github.com/charopevez/eob-accountant-worker/internal/sessions"
+	sessiondb "github.com/charopevez/eob-accountant-worker/internal/sessions/db"
+	"github.com/charopevez/eob-accountant-worker/internal/signature"
+	"github.com/charopevez/eob-accountant-worker/internal/sso"
+	ssodb "github.com/charopevez/eob-accountant-worker/internal/sso/db"
+	"github.com/charopevez/eob-accountant-worker/internal/usernames"
+	"github.com/charopevez/eob-accountant-worker/pkg/geoip"
 	"github.com/charopevez/eob-accountant-worker/pkg/handlers/metric"
 	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/mail"
 	mongo "github.com/charopevez/eob-accountant-worker/pkg/mongodb"
+	"github.com/charopevez/eob-accountant-worker/pkg/ratelimit"
 	"github.com/charopevez/eob-accountant-worker/pkg/shutdown"
+	"github.com/charopevez/eob-accountant-worker/pkg/webauthn"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -29,7 +71,10 @@ func main() {
 
 	logger.Println("config initializing")
 	cfg := config.GetConfig()
-	logger.Println(cfg)
+
+	if err := auth.TrustProxies(cfg.Listen.TrustedProxies); err != nil {
+		logger.Fatal(err)
+	}
 
 	logger.Println("router initializing")
 	router := httprouter.New()
@@ -43,21 +88,432 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+
+	logger.Println("mail sender initializing")
+	mailSender, err := mail.NewSender(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password,
+		cfg.Mail.From, cfg.IsDebug != nil && *cfg.IsDebug, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("ldap directory initializing")
+	ldapDomains := make([]directory.Domain, 0, len(cfg.LDAP.Domains))
+	for _, d := range cfg.LDAP.Domains {
+		ldapDomains = append(ldapDomains, directory.Domain{
+			Domain:             d.Domain,
+			URL:                d.URL,
+			StartTLS:           d.StartTLS,
+			InsecureSkipVerify: d.InsecureSkipVerify,
+			CAFile:             d.CAFile,
+			BindDN:             d.BindDN,
+			NameAttribute:      d.NameAttribute,
+			GroupBaseDN:        d.GroupBaseDN,
+			GroupFilter:        d.GroupFilter,
+			GroupAttribute:     d.GroupAttribute,
+			RoleMapping:        d.RoleMapping,
+		})
+	}
+	ldapDirectory, err := directory.NewLDAP(ldapDomains, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("geoip database initializing")
+	geoDB := geoip.NewDB(cfg.GeoIP.Path, cfg.GeoIP.ReloadInterval, logger)
+
+	logger.Println("login alerts initializing")
+	reportStorage := alertdb.NewStorage(mongoClient, cfg.MongoDB.Collections.LoginReports, logger)
+	alertService, err := alerts.NewService(reportStorage, mailSender, cfg.LoginAlerts.ReportURL, cfg.LoginAlerts.ReportTTL,
+		logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("login history collection initializing")
+	historyStorage := loginsdb.NewStorage(mongoClient, cfg.MongoDB.Collections.LoginHistory, logger)
+	historyService, err := logins.NewService(historyStorage, geoDB, alertService, cfg.LoginHistory.Retention,
+		cfg.LoginHistory.MaxResults, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("invite collection initializing")
+	inviteStorage := invitesdb.NewStorage(mongoClient, cfg.MongoDB.Collections.Invites, logger)
+	inviteService, err := invites.NewService(inviteStorage, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("referral collection initializing")
+	referralStorage := referralsdb.NewStorage(mongoClient, cfg.MongoDB.Collections.ReferralCodes,
+		cfg.MongoDB.Collections.Referrals, logger)
+	referralService, err := referrals.NewService(referralStorage, cfg.Referrals.MaxResults, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("username policy initializing")
+	usernamePolicy, err := usernames.NewPolicy(usernames.Options{
+		MinLength:     cfg.Usernames.MinLength,
+		MaxLength:     cfg.Usernames.MaxLength,
+		Pattern:       cfg.Usernames.Pattern,
+		Reserved:      cfg.Usernames.Reserved,
+		ProfanityPath: cfg.Usernames.ProfanityPath,
+	}, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	logger.Println("account collection initializing")
-	accountStorage := db.NewStorage(mongoClient, cfg.MongoDB.Collection, logger)
-	accountantService, err := accounts.NewService(accountStorage, logger)
+	accountStorage, err := db.NewStorage(mongoClient, cfg.MongoDB.Collection, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	accountantService, err := accounts.NewService(accountStorage, ldapDirectory, historyService, geoDB, inviteService,
+		referralService, usernamePolicy, cfg.Registration.Mode, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("login ticket collection initializing")
+	ticketStorage := mfadb.NewStorage(mongoClient, cfg.MongoDB.Collections.LoginTickets, logger)
+	mfaService, err := mfa.NewService(ticketStorage, cfg.MFA.TicketTTL, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("otp collection initializing")
+	otpStorage := otpdb.NewStorage(mongoClient, cfg.MongoDB.Collections.OTPCodes,
+		cfg.MongoDB.Collections.OTPAttempts, logger)
+	otpService, err := otp.NewService(otpStorage, accountantService, mfaService, mailSender,
+		cfg.OTP.TTL, cfg.OTP.ResendInterval, cfg.OTP.MaxAttempts, cfg.OTP.AttemptWindow, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("session collection initializing")
+	sessionStorage := sessiondb.NewStorage(mongoClient, cfg.MongoDB.Collections.Sessions,
+		cfg.MongoDB.Collections.ReauthAttempts, logger)
+	sessionService, err := sessions.NewService(sessionStorage, accountantService, otpService, historyService, geoDB,
+		cfg.Session.TTL, cfg.Session.IdleTimeout, cfg.Session.ReauthAttempts, cfg.Session.ReauthWindow, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("oidc provider initializing")
+	oidcService, err := oidc.NewService(accountantService, cfg.OIDC.Issuer, cfg.OIDC.SigningKey, cfg.OIDC.IDTokenTTL, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("oauth collections initializing")
+	oauthStorage := oauthdb.NewStorage(mongoClient, cfg.MongoDB.Collections.OAuthClients,
+		cfg.MongoDB.Collections.OAuthCodes, cfg.MongoDB.Collections.OAuthDevices, cfg.MongoDB.Collections.OAuthTokens,
+		cfg.MongoDB.Collections.OAuthConsents, logger)
+	oauthService, err := oauth.NewService(oauthStorage, accountantService, oidcService,
+		cfg.OAuth.CodeTTL, cfg.OAuth.AccessTokenTTL, cfg.OAuth.RefreshTokenTTL, cfg.OAuth.DeviceCodeTTL,
+		cfg.OAuth.DeviceInterval, cfg.OAuth.VerificationURL, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("personal access token collection initializing")
+	patStorage := patdb.NewStorage(mongoClient, cfg.MongoDB.Collections.AccessTokens, logger)
+	patService, err := pat.NewService(patStorage, accountantService, cfg.PAT.DefaultTTL, cfg.PAT.MaxTTL, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("impersonation collection initializing")
+	impersonationStorage := impersonationdb.NewStorage(mongoClient, cfg.MongoDB.Collections.Impersonations,
+		cfg.MongoDB.Collections.ImpersonationAudit, logger)
+	impersonationService, err := impersonation.NewService(impersonationStorage, accountantService,
+		cfg.Impersonation.TTL, logger)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
+	logger.Println("revocation collection initializing")
+	revocationStorage := revocationdb.NewStorage(mongoClient, cfg.MongoDB.Collections.Revocations, logger)
+	revocationService, err := revocation.NewService(revocationStorage, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	authMiddleware := &auth.Middleware{
+		Logger:         logger,
+		Authenticators: []auth.Authenticator{sessionService, oauthService, patService, impersonationService},
+		Revocations:    revocationService,
+		Impersonations: impersonationService,
+		FreshWindow:    cfg.Session.FreshWindow,
+	}
+	if cfg.OTP.RequireStepUp {
+		authMiddleware.StepUp = otpService
+	}
+	login := &accounts.Login{
+		Logger:     logger,
+		MFAService: mfaService,
+		Sessions:   sessionService,
+		History:    historyService,
+	}
+
+	var sessionCookies *sessions.Cookies
+	if cfg.Session.Cookie.Enabled {
+		logger.Println("cookie sessions initializing")
+		sessionCookies = &sessions.Cookies{
+			Logger:     logger,
+			Sessions:   sessionService,
+			Name:       cfg.Session.Cookie.Name,
+			CSRFName:   cfg.Session.Cookie.CSRFName,
+			CSRFHeader: cfg.Session.Cookie.CSRFHeader,
+			Domain:     cfg.Session.Cookie.Domain,
+			Secure:     cfg.Session.Cookie.Secure,
+			SameSite:   sameSite(cfg.Session.Cookie.SameSite),
+		}
+		authMiddleware.Cookies = sessionCookies
+		login.Browser = sessionCookies
+	}
+
+	var challenges accounts.Challenges
+	if cfg.Challenge.Enabled {
+		logger.Println("proof of work initializing")
+		challengeService, err := challenge.NewService(historyService, challenge.Options{
+			Key:              cfg.Challenge.Key,
+			TTL:              cfg.Challenge.TTL,
+			Difficulty:       cfg.Challenge.Difficulty,
+			HighDifficulty:   cfg.Challenge.HighDifficulty,
+			Networks:         cfg.Challenge.Networks,
+			FailureWindow:    cfg.Challenge.FailureWindow,
+			FailureThreshold: cfg.Challenge.FailureThreshold,
+		}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		challenges = challengeService
+
+		challengeHandler := challenge.Handler{
+			Logger:           logger,
+			ChallengeService: challengeService,
+		}
+		challengeHandler.Register(router)
+	}
+
 	accountsHandler := accounts.Handler{
 		Logger:            logger,
 		AccountantService: accountantService,
+		Login:             login,
+		Challenges:        challenges,
+		Auth:              authMiddleware,
+		UsernameLimiter:   ratelimit.New(cfg.Usernames.CheckLimit, cfg.Usernames.CheckWindow),
 	}
 	accountsHandler.Register(router)
 
+	sessionsHandler := sessions.Handler{
+		Logger:         logger,
+		SessionService: sessionService,
+		Cookies:        sessionCookies,
+		Auth:           authMiddleware,
+	}
+	sessionsHandler.Register(router)
+
+	oauthHandler := oauth.Handler{
+		Logger:       logger,
+		OAuthService: oauthService,
+		Revocations:  revocationService,
+		Auth:         authMiddleware,
+	}
+	oauthHandler.Register(router)
+
+	oidcHandler := oidc.Handler{
+		Logger:      logger,
+		OIDCService: oidcService,
+		Auth:        authMiddleware,
+	}
+	oidcHandler.Register(router)
+
+	patHandler := pat.Handler{
+		Logger:     logger,
+		PATService: patService,
+		Auth:       authMiddleware,
+	}
+	patHandler.Register(router)
+
+	impersonationHandler := impersonation.Handler{
+		Logger:               logger,
+		ImpersonationService: impersonationService,
+		Auth:                 authMiddleware,
+	}
+	impersonationHandler.Register(router)
+
+	historyHandler := logins.Handler{
+		Logger:         logger,
+		HistoryService: historyService,
+		Auth:           authMiddleware,
+	}
+	historyHandler.Register(router)
+
+	alertsHandler := alerts.Handler{
+		Logger:            logger,
+		AlertService:      alertService,
+		AccountantService: accountantService,
+		SessionService:    sessionService,
+		OAuthService:      oauthService,
+		PATService:        patService,
+	}
+	alertsHandler.Register(router)
+
+	invitesHandler := invites.Handler{
+		Logger:        logger,
+		InviteService: inviteService,
+		Auth:          authMiddleware,
+	}
+	invitesHandler.Register(router)
+
+	referralsHandler := referrals.Handler{
+		Logger:          logger,
+		ReferralService: referralService,
+		Auth:            authMiddleware,
+	}
+	referralsHandler.Register(router)
+
+	otpHandler := otp.Handler{
+		Logger:     logger,
+		OTPService: otpService,
+		Login:      login,
+		Auth:       authMiddleware,
+	}
+	otpHandler.Register(router)
+
+	logger.Println("passkey collection initializing")
+	passkeyStorage := passkeydb.NewStorage(mongoClient, cfg.MongoDB.Collections.Passkeys,
+		cfg.MongoDB.Collections.Ceremonies, logger)
+	relyingParty := &webauthn.RelyingParty{
+		ID:      cfg.WebAuthn.RPID,
+		Name:    cfg.WebAuthn.RPName,
+		Origins: cfg.WebAuthn.Origins,
+		Timeout: cfg.WebAuthn.Timeout,
+	}
+	passkeyService, err := passkeys.NewService(passkeyStorage, accountantService, mfaService, relyingParty, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	passkeysHandler := passkeys.Handler{
+		Logger:         logger,
+		PasskeyService: passkeyService,
+		Login:          login,
+		Auth:           authMiddleware,
+	}
+	passkeysHandler.Register(router)
+
+	logger.Println("magic link collection initializing")
+	magicLinkStorage := magiclinkdb.NewStorage(mongoClient, cfg.MongoDB.Collections.MagicLinks, logger)
+	magicLinkService, err := magiclink.NewService(magicLinkStorage, accountantService, mailSender,
+		cfg.MagicLink.URL, cfg.MagicLink.TTL, cfg.MagicLink.ResendInterval, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	magicLinkHandler := magiclink.Handler{
+		Logger:           logger,
+		MagicLinkService: magicLinkService,
+		Login:            login,
+		RequestLimiter:   ratelimit.New(cfg.MagicLink.RequestLimit, cfg.MagicLink.RequestWindow),
+	}
+	magicLinkHandler.Register(router)
+
+	logger.Println("identity collection initializing")
+	identityStorage := identitydb.NewStorage(mongoClient, cfg.MongoDB.Collections.Identities,
+		cfg.MongoDB.Collections.IdentityStates, logger)
+	providers := make([]identities.Provider, 0, len(cfg.ExternalLogin.Providers))
+	for _, p := range cfg.ExternalLogin.Providers {
+		providers = append(providers, identities.Provider{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		})
+	}
+	identityService, err := identities.NewService(identityStorage, accountantService, providers,
+		cfg.ExternalLogin.StateTTL, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	identitiesHandler := identities.Handler{
+		Logger:          logger,
+		IdentityService: identityService,
+		Login:           login,
+		Auth:            authMiddleware,
+		SecureCookie:    cfg.Session.Cookie.Secure,
+	}
+	identitiesHandler.Register(router)
+
+	if cfg.SAML.Enabled {
+		logger.Println("saml service provider initializing")
+		ssoStorage := ssodb.NewStorage(mongoClient, cfg.MongoDB.Collections.SAMLRequests, logger)
+		ssoService, err := sso.NewService(ssoStorage, accountantService, sso.Options{
+			RootURL:           cfg.SAML.RootURL,
+			EntityID:          cfg.SAML.EntityID,
+			CertFile:          cfg.SAML.CertFile,
+			KeyFile:           cfg.SAML.KeyFile,
+			IDPMetadataURL:    cfg.SAML.IDPMetadataURL,
+			IDPMetadataFile:   cfg.SAML.IDPMetadataFile,
+			EmailAttribute:    cfg.SAML.EmailAttribute,
+			NameAttribute:     cfg.SAML.NameAttribute,
+			RoleAttribute:     cfg.SAML.RoleAttribute,
+			RoleMapping:       cfg.SAML.RoleMapping,
+			AllowIDPInitiated: cfg.SAML.AllowIDPInitiated,
+		}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		ssoHandler := sso.Handler{
+			Logger:     logger,
+			SSOService: ssoService,
+			Login:      login,
+		}
+		ssoHandler.Register(router)
+	}
+
+	logger.Println("scim provisioning initializing")
+	scimTokens := make([]scim.Token, 0, len(cfg.SCIM.Tokens))
+	for _, t := range cfg.SCIM.Tokens {
+		scimTokens = append(scimTokens, scim.Token{Name: t.Name, Token: t.Token})
+	}
+	scimService, err := scim.NewService(accountantService, scimTokens, cfg.SCIM.BaseURL, cfg.SCIM.MaxResults, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	scimHandler := scim.Handler{
+		Logger:      logger,
+		SCIMService: scimService,
+	}
+	scimHandler.Register(router)
+
+	logger.Println("request signing initializing")
+	signingKeys := make([]signature.Key, 0, len(cfg.Signing.Keys))
+	for _, k := range cfg.Signing.Keys {
+		signingKeys = append(signingKeys, signature.Key{ID: k.ID, Secret: k.Secret, Scopes: k.Scopes})
+	}
+	signatureMiddleware := signature.NewMiddleware(signingKeys, cfg.Signing.ClockSkew, logger)
+
 	logger.Println("start application")
-	start(router, logger, cfg)
+	start(signatureMiddleware.Wrap(router), logger, cfg)
+}
+
+func sameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
 }
 
 func start(router http.Handler, logger logging.Logger, cfg *config.Config) {
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts/db"
+	"github.com/charopevez/eob-accountant-worker/internal/config"
+	"github.com/charopevez/eob-accountant-worker/internal/usernames"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	mongo "github.com/charopevez/eob-accountant-worker/pkg/mongodb"
+)
+
+// migrate runs one off migration of account collection and prints what it changed.
+// -dry-run prints changes without writing them
+func main() {
+	name := flag.String("name", "", "migration to run: usernames, deleted")
+	dryRun := flag.Bool("dry-run", false, "print changes without writing them")
+	flag.Parse()
+
+	logging.Init()
+	logger := logging.GetLogger()
+	cfg := config.GetConfig()
+
+	logger.Println("db client initializing")
+	mongoClient, err := mongo.NewClient(context.Background(), cfg.MongoDB.Host, cfg.MongoDB.Port,
+		cfg.MongoDB.Username, cfg.MongoDB.Password, cfg.MongoDB.Database, cfg.MongoDB.AuthDB)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	migrator := db.NewMigrator(mongoClient, cfg.MongoDB.Collection, logger)
+
+	switch *name {
+	case "usernames":
+		policy, err := usernames.NewPolicy(usernames.Options{
+			MinLength:     cfg.Usernames.MinLength,
+			MaxLength:     cfg.Usernames.MaxLength,
+			Pattern:       cfg.Usernames.Pattern,
+			Reserved:      cfg.Usernames.Reserved,
+			ProfanityPath: cfg.Usernames.ProfanityPath,
+		}, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		renames, err := migrator.RenameDuplicateUsernames(context.Background(), policy, cfg.Usernames.MaxLength, *dryRun)
+		unresolved := 0
+		for _, r := range renames {
+			if r.To == "" {
+				unresolved++
+				fmt.Printf("%s\t%s\t<no free username>\n", r.UUID, r.From)
+				continue
+			}
+			fmt.Printf("%s\t%s\t%s\n", r.UUID, r.From, r.To)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if unresolved > 0 {
+			logger.Errorf("%d accounts need username chosen by hand", unresolved)
+			os.Exit(1)
+		}
+	case "deleted":
+		deleted, err := migrator.MigrateDeletedFlag(context.Background(), *dryRun)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("%d deleted accounts\n", deleted)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -3,9 +3,17 @@ module github.com/charopevez/eob-accountant-worker
 go 1.16
 
 require (
+	github.com/coreos/go-oidc/v3 v3.1.0
+	github.com/crewjam/saml v0.4.5
+	github.com/fxamacker/cbor/v2 v2.3.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.4.1
+	github.com/golang-jwt/jwt/v4 v4.0.0
 	github.com/ilyakaznacheev/cleanenv v1.2.5
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/oschwald/maxminddb-golang v1.3.1
 	github.com/sirupsen/logrus v1.8.1
 	go.mongodb.org/mongo-driver v1.7.1
 	golang.org/x/crypto v0.0.0-20210813211128-0a44fdfbc16e
+	golang.org/x/oauth2 v0.0.0-20210819190943-2bc19b11175f
 )
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"regexp"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var comparisons = map[string]string{
+	accounts.FilterGt: "$gt",
+	accounts.FilterGe: "$gte",
+	accounts.FilterLt: "$lt",
+	accounts.FilterLe: "$lte",
+}
+
+// toQuery translates account filter into mongo query
+func toQuery(f accounts.Filter) bson.M {
+	switch f.Op {
+	case "":
+		return bson.M{}
+	case accounts.FilterAnd, accounts.FilterOr:
+		queries := make(bson.A, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			queries = append(queries, toQuery(child))
+		}
+		return bson.M{"$" + f.Op: queries}
+	case accounts.FilterNot:
+		queries := make(bson.A, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			queries = append(queries, toQuery(child))
+		}
+		return bson.M{"$nor": queries}
+	case accounts.FilterPr:
+		return bson.M{f.Field: bson.M{"$exists": true, "$nin": bson.A{nil, ""}}}
+	}
+
+	value := f.Value
+	if f.Field == "_id" {
+		//? malformed id can't match any account
+		id, _ := value.(string)
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			objectID = primitive.NilObjectID
+		}
+		value = objectID
+	}
+
+	switch v := value.(type) {
+	case string:
+		return bson.M{f.Field: stringQuery(f.Op, v)}
+	case bool:
+		//? false booleans aren't stored, so compare with true
+		if (f.Op == accounts.FilterEq) == v {
+			return bson.M{f.Field: true}
+		}
+		return bson.M{f.Field: bson.M{"$ne": true}}
+	}
+
+	if op, ok := comparisons[f.Op]; ok {
+		return bson.M{f.Field: bson.M{op: value}}
+	}
+	if f.Op == accounts.FilterNe {
+		return bson.M{f.Field: bson.M{"$ne": value}}
+	}
+	return bson.M{f.Field: value}
+}
+
+func stringQuery(op, value string) interface{} {
+	quoted := regexp.QuoteMeta(value)
+	switch op {
+	case accounts.FilterEq:
+		return primitive.Regex{Pattern: "^" + quoted + "$", Options: "i"}
+	case accounts.FilterNe:
+		return bson.M{"$not": primitive.Regex{Pattern: "^" + quoted + "$", Options: "i"}}
+	case accounts.FilterCo:
+		return primitive.Regex{Pattern: quoted, Options: "i"}
+	case accounts.FilterSw:
+		return primitive.Regex{Pattern: "^" + quoted, Options: "i"}
+	case accounts.FilterEw:
+		return primitive.Regex{Pattern: quoted + "$", Options: "i"}
+	}
+	if cmp, ok := comparisons[op]; ok {
+		return bson.M{cmp: value}
+	}
+	return value
+}
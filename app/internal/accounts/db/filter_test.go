@@ -0,0 +1,71 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestToQuery(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("611a7209ef4f1f377c96a4eb")
+	email := accounts.Filter{Op: accounts.FilterEq, Field: "email", Value: "a.b@eob.local"}
+	tests := []struct {
+		name   string
+		filter accounts.Filter
+		want   bson.M
+	}{
+		{name: "empty", filter: accounts.Filter{}, want: bson.M{}},
+		{name: "string eq is case insensitive and escaped", filter: email,
+			want: bson.M{"email": primitive.Regex{Pattern: `^a\.b@eob\.local$`, Options: "i"}}},
+		{name: "string ne", filter: accounts.Filter{Op: accounts.FilterNe, Field: "lang", Value: "en"},
+			want: bson.M{"lang": bson.M{"$not": primitive.Regex{Pattern: "^en$", Options: "i"}}}},
+		{name: "string co", filter: accounts.Filter{Op: accounts.FilterCo, Field: "username", Value: "a+b"},
+			want: bson.M{"username": primitive.Regex{Pattern: `a\+b`, Options: "i"}}},
+		{name: "string sw", filter: accounts.Filter{Op: accounts.FilterSw, Field: "username", Value: "pl"},
+			want: bson.M{"username": primitive.Regex{Pattern: "^pl", Options: "i"}}},
+		{name: "string ew", filter: accounts.Filter{Op: accounts.FilterEw, Field: "username", Value: "er"},
+			want: bson.M{"username": primitive.Regex{Pattern: "er$", Options: "i"}}},
+		{name: "string ge", filter: accounts.Filter{Op: accounts.FilterGe, Field: "username", Value: "m"},
+			want: bson.M{"username": bson.M{"$gte": "m"}}},
+		{name: "id eq", filter: accounts.Filter{Op: accounts.FilterEq, Field: "_id", Value: id.Hex()},
+			want: bson.M{"_id": id}},
+		{name: "id ne", filter: accounts.Filter{Op: accounts.FilterNe, Field: "_id", Value: id.Hex()},
+			want: bson.M{"_id": bson.M{"$ne": id}}},
+		{name: "malformed id", filter: accounts.Filter{Op: accounts.FilterEq, Field: "_id", Value: "player"},
+			want: bson.M{"_id": primitive.NilObjectID}},
+		{name: "true boolean", filter: accounts.Filter{Op: accounts.FilterEq, Field: "is_active", Value: true},
+			want: bson.M{"is_active": true}},
+		{name: "false boolean", filter: accounts.Filter{Op: accounts.FilterEq, Field: "is_active", Value: false},
+			want: bson.M{"is_active": bson.M{"$ne": true}}},
+		{name: "ne false boolean", filter: accounts.Filter{Op: accounts.FilterNe, Field: "is_active", Value: false},
+			want: bson.M{"is_active": true}},
+		{name: "date lt", filter: accounts.Filter{Op: accounts.FilterLt, Field: "created_at", Value: int64(42)},
+			want: bson.M{"created_at": bson.M{"$lt": int64(42)}}},
+		{name: "date eq", filter: accounts.Filter{Op: accounts.FilterEq, Field: "created_at", Value: int64(42)},
+			want: bson.M{"created_at": int64(42)}},
+		{name: "present", filter: accounts.Filter{Op: accounts.FilterPr, Field: "external_id"},
+			want: bson.M{"external_id": bson.M{"$exists": true, "$nin": bson.A{nil, ""}}}},
+		{name: "and", filter: accounts.Filter{Op: accounts.FilterAnd, Filters: []accounts.Filter{
+			email, {Op: accounts.FilterEq, Field: "is_active", Value: true},
+		}}, want: bson.M{"$and": bson.A{
+			bson.M{"email": primitive.Regex{Pattern: `^a\.b@eob\.local$`, Options: "i"}},
+			bson.M{"is_active": true},
+		}}},
+		{name: "not or", filter: accounts.Filter{Op: accounts.FilterNot, Filters: []accounts.Filter{
+			{Op: accounts.FilterOr, Filters: []accounts.Filter{email, {Op: accounts.FilterPr, Field: "lang"}}},
+		}}, want: bson.M{"$nor": bson.A{bson.M{"$or": bson.A{
+			bson.M{"email": primitive.Regex{Pattern: `^a\.b@eob\.local$`, Options: "i"}},
+			bson.M{"lang": bson.M{"$exists": true, "$nin": bson.A{nil, ""}}},
+		}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toQuery(tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rename is username changed by migration. To is empty when no free username was found
+type Rename struct {
+	UUID string
+	From string
+	To   string
+}
+
+// Migrator runs one off migrations of account collection. they are started by cmd/migrate, never by worker
+type Migrator struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewMigrator(storage *mongo.Database, collection string, logger logging.Logger) *Migrator {
+	return &Migrator{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// suffix lengths of account id tried for renamed username, shortest first
+var suffixLengths = []int{6, 10, 16, 24}
+
+//? oldest account keeps username, others get suffix of their id. group uses username collation,
+//? so it finds same names unique index would reject. new username must pass policy and be free
+func (m *Migrator) RenameDuplicateUsernames(ctx context.Context, policy accounts.UsernamePolicy, maxLength int,
+	dryRun bool) ([]Rename, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"username": bson.M{"$type": "string"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$username",
+			"ids":   bson.M{"$push": "$_id"},
+			"names": bson.M{"$push": "$username"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := m.collection.Aggregate(ctx, pipeline, options.Aggregate().SetCollation(usernameCollation))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	var groups []struct {
+		IDs   []primitive.ObjectID `bson:"ids"`
+		Names []string             `bson:"names"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+
+	renames := make([]Rename, 0)
+	//? dry run doesn't write names, so names picked by this run are remembered to keep them unique
+	picked := make(map[string]bool)
+	for _, g := range groups {
+		for i, id := range g.IDs[1:] {
+			rename := Rename{UUID: id.Hex(), From: g.Names[i+1]}
+			rename.To, err = m.freeUsername(ctx, policy, maxLength, rename.From, rename.UUID, picked)
+			if err != nil {
+				return renames, err
+			}
+			renames = append(renames, rename)
+			if rename.To == "" {
+				m.logger.Errorf("no free username for account %s with username %s", rename.UUID, rename.From)
+				continue
+			}
+			picked[strings.ToLower(rename.To)] = true
+			if dryRun {
+				continue
+			}
+
+			_, err = m.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"username": rename.To}})
+			if err != nil {
+				return renames, fmt.Errorf("failed to execute query. error: %w", err)
+			}
+			m.logger.Warnf("username of account %s is renamed from %s to %s", rename.UUID, rename.From, rename.To)
+		}
+	}
+
+	return renames, nil
+}
+
+//? username is cut to fit suffix into max length. names failing policy fall back to player_<suffix>
+func (m *Migrator) freeUsername(ctx context.Context, policy accounts.UsernamePolicy, maxLength int,
+	username, hex string, picked map[string]bool) (string, error) {
+	for _, base := range []string{username, "player"} {
+		for _, n := range suffixLengths {
+			suffix := "_" + hex[len(hex)-n:]
+			candidate := truncate(base, maxLength-len(suffix)) + suffix
+			if picked[strings.ToLower(candidate)] || policy.Check(candidate) != nil {
+				continue
+			}
+			taken, err := m.usernameTaken(ctx, candidate)
+			if err != nil {
+				return "", err
+			}
+			if !taken {
+				return candidate, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (m *Migrator) usernameTaken(ctx context.Context, username string) (bool, error) {
+	err := m.collection.FindOne(ctx, bson.M{"username": username}, options.FindOne().SetCollation(usernameCollation)).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return true, nil
+}
+
+//? accounts deleted before soft delete used is_deleted field kept IsDeleted field, which Account doesn't
+//? read, so they could still sign in. flag is moved to is_deleted, stray IsDeleted fields are removed
+func (m *Migrator) MigrateDeletedFlag(ctx context.Context, dryRun bool) (deleted int64, err error) {
+	legacy := bson.M{"IsDeleted": true}
+	if dryRun {
+		deleted, err = m.collection.CountDocuments(ctx, legacy)
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute query. error: %w", err)
+		}
+		return deleted, nil
+	}
+
+	result, err := m.collection.UpdateMany(ctx, legacy, bson.M{"$set": bson.M{"is_deleted": true}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	deleted = result.ModifiedCount
+
+	result, err = m.collection.UpdateMany(ctx, bson.M{"IsDeleted": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"IsDeleted": ""}})
+	if err != nil {
+		return deleted, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	m.logger.Warnf("%d accounts are marked deleted, IsDeleted field is removed from %d accounts",
+		deleted, result.ModifiedCount)
+
+	return deleted, nil
+}
+
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -13,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var _ accounts.Storage = &db{}
@@ -22,11 +23,35 @@ type db struct {
 	logger     logging.Logger
 }
 
-func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) accounts.Storage {
-	return &db{
+// usernames are compared case insensitive. index and queries must use same collation
+var usernameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// NewStorage fails when unique username index can not be built, since usernames would not be unique without it
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) (accounts.Storage, error) {
+	s := &db{
 		collection: storage.Collection(collection),
 		logger:     logger,
 	}
+	if err := s.ensureIndexes(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//? accounts without username are left out of unique index. index can't be built while usernames which
+//? differ only in case exist, they are renamed by usernames migration of cmd/migrate
+func (s *db) ensureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"username": 1},
+		Options: options.Index().SetUnique(true).SetCollation(usernameCollation).
+			SetPartialFilterExpression(bson.M{"username": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create unique username index, run usernames migration. error: %w", err)
+	}
+	return nil
 }
 
 func (s *db) Create(ctx context.Context, account accounts.Account) (string, error) {
@@ -34,6 +59,9 @@ func (s *db) Create(ctx context.Context, account accounts.Account) (string, erro
 	defer cancel()
 	result, err := s.collection.InsertOne(nCtx, account)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", apperror.ErrUsernameTaken
+		}
 		return "", fmt.Errorf("failed to execute query. error: %w", err)
 	}
 
@@ -90,6 +118,54 @@ func (s *db) FindByEmail(ctx context.Context, email string) (u accounts.Account,
 	return u, nil
 }
 
+func (s *db) FindByUsername(ctx context.Context, username string) (u accounts.Account, err error) {
+	filter := bson.M{"username": username}
+	opts := options.FindOne().SetCollation(usernameCollation)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result := s.collection.FindOne(ctx, filter, opts)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return u, apperror.ErrNotFound
+		}
+		return u, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&u); err != nil {
+		return u, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return u, nil
+}
+
+//? limit 0 only counts matched accounts
+func (s *db) Find(ctx context.Context, filter accounts.Filter, offset, limit int64) (accs []accounts.Account, total int64, err error) {
+	query := toQuery(filter)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	total, err = s.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return accs, total, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if limit == 0 || offset >= total {
+		return accs, total, nil
+	}
+
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetSkip(offset).SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return accs, total, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = cursor.All(ctx, &accs); err != nil {
+		return accs, total, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+
+	return accs, total, nil
+}
+
 func (s *db) UpdateAccount(ctx context.Context, account accounts.Account) error {
 	objectID, err := primitive.ObjectIDFromHex(account.UUID)
 	if err != nil {
@@ -118,6 +194,9 @@ func (s *db) UpdateAccount(ctx context.Context, account accounts.Account) error
 	defer cancel()
 	result, err := s.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrUsernameTaken
+		}
 		return fmt.Errorf("failed to execute query. error: %w", err)
 	}
 	if result.MatchedCount == 0 {
@@ -129,6 +208,8 @@ func (s *db) UpdateAccount(ctx context.Context, account accounts.Account) error
 	return nil
 }
 
+//? soft delete sets is_deleted read by Account. accounts deleted before used IsDeleted field,
+//? they are fixed by deleted migration of cmd/migrate
 func (s *db) Delete(ctx context.Context, uuid string) error {
 	objectID, err := primitive.ObjectIDFromHex(uuid)
 	if err != nil {
@@ -136,7 +217,7 @@ func (s *db) Delete(ctx context.Context, uuid string) error {
 	}
 	filter := bson.M{"_id": objectID}
 	update := bson.M{
-		"$set": bson.M{"IsDeleted": true},
+		"$set": bson.M{"is_deleted": true},
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -153,3 +234,64 @@ func (s *db) Delete(ctx context.Context, uuid string) error {
 
 	return nil
 }
+
+func (s *db) AddSecondFactor(ctx context.Context, uuid, factor string) error {
+	return s.updateOne(ctx, uuid, bson.M{"$addToSet": bson.M{"mfa": factor}})
+}
+
+func (s *db) RemoveSecondFactor(ctx context.Context, uuid, factor string) error {
+	return s.updateOne(ctx, uuid, bson.M{"$pull": bson.M{"mfa": factor}})
+}
+
+//? is_active is omitted when false so it is unset explicitly
+func (s *db) SetActive(ctx context.Context, uuid string, active bool) error {
+	if !active {
+		return s.updateOne(ctx, uuid, bson.M{"$unset": bson.M{"is_active": ""}})
+	}
+	return s.updateOne(ctx, uuid, bson.M{"$set": bson.M{"is_active": true}})
+}
+
+func (s *db) UpdateRoles(ctx context.Context, uuid string, roles []string, isAdmin bool) error {
+	return s.updateOne(ctx, uuid, bson.M{"$set": bson.M{"roles": roles, "is_admin": isAdmin}})
+}
+
+//? alerts are on by default, opt out flag is unset when they are enabled
+func (s *db) SetLoginAlerts(ctx context.Context, uuid string, enabled bool) error {
+	if enabled {
+		return s.updateOne(ctx, uuid, bson.M{"$unset": bson.M{"login_alerts_off": ""}})
+	}
+	return s.updateOne(ctx, uuid, bson.M{"$set": bson.M{"login_alerts_off": true}})
+}
+
+func (s *db) SetPasswordReset(ctx context.Context, uuid string) error {
+	return s.updateOne(ctx, uuid, bson.M{"$set": bson.M{"password_reset": true}})
+}
+
+func (s *db) ResetPassword(ctx context.Context, uuid, password string) error {
+	return s.updateOne(ctx, uuid, bson.M{
+		"$set":   bson.M{"password": password},
+		"$unset": bson.M{"password_reset": ""},
+	})
+}
+
+func (s *db) updateOne(ctx context.Context, uuid string, update bson.M) error {
+	objectID, err := primitive.ObjectIDFromHex(uuid)
+	if err != nil {
+		return fmt.Errorf("failed to convert hex to objectid. error: %w", err)
+	}
+	filter := bson.M{"_id": objectID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Matched %v documents and updated %v documents.\n", result.MatchedCount, result.ModifiedCount)
+
+	return nil
+}
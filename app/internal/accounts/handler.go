@@ -5,7 +5,9 @@ import (
 	"fmt"
 
 	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
 	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/ratelimit"
 	"github.com/julienschmidt/httprouter"
 
 	"net/http"
@@ -15,26 +17,44 @@ const (
 	registerURL = "/api/register"
 	accountURL  = "/api/account/:uuid"
 	loginURL    = "/api/login"
+	alertsURL   = "/api/account/:uuid/login-alerts"
+	usernameURL = "/api/usernames/:username"
+
+	internalAccountURL = "/internal/accounts/:uuid"
 )
 
+// Handler.Challenges is nil unless proof of work is enabled. Handler.UsernameLimiter limits public
+// username checks per client address
 type Handler struct {
 	Logger            logging.Logger
 	AccountantService Service
+	Login             *Login
+	Challenges        Challenges
+	Auth              *auth.Middleware
+	UsernameLimiter   *ratelimit.Limiter
 }
 
 func (h *Handler) Register(router *httprouter.Router) {
 	router.HandlerFunc(http.MethodPost, loginURL, apperror.Middleware(h.Authenticate))
 	router.HandlerFunc(http.MethodPost, registerURL, apperror.Middleware(h.CreateAccount))
-	router.HandlerFunc(http.MethodGet, accountURL, apperror.Middleware(h.GetAccount))
-	router.HandlerFunc(http.MethodPatch, accountURL, apperror.Middleware(h.UpdateAccount))
-	router.HandlerFunc(http.MethodPut, accountURL, apperror.Middleware(h.UpdateCredentials))
-	router.HandlerFunc(http.MethodDelete, accountURL, apperror.Middleware(h.DeleteAccount))
+	router.HandlerFunc(http.MethodGet, accountURL, apperror.Middleware(h.Auth.Owner(h.GetAccount, auth.ScopeAccountRead)))
+	router.HandlerFunc(http.MethodPatch, accountURL, apperror.Middleware(h.Auth.Owner(h.UpdateAccount, auth.ScopeAccountWrite)))
+	router.HandlerFunc(http.MethodPut, accountURL, apperror.Middleware(h.Auth.Fresh(h.UpdateCredentials)))
+	router.HandlerFunc(http.MethodDelete, accountURL, apperror.Middleware(h.Auth.Fresh(h.DeleteAccount)))
+	router.HandlerFunc(http.MethodPut, alertsURL, apperror.Middleware(h.Auth.Owner(h.SetLoginAlerts, auth.ScopeAccountWrite)))
+	router.HandlerFunc(http.MethodGet, usernameURL, apperror.Middleware(h.CheckUsername))
+	router.HandlerFunc(http.MethodGet, internalAccountURL, apperror.Middleware(h.Auth.Service(h.GetAccount, auth.ScopeInternalAccountsRead)))
+	router.HandlerFunc(http.MethodPatch, internalAccountURL, apperror.Middleware(h.Auth.Service(h.UpdateAccount, auth.ScopeInternalAccountsWrite)))
 }
 
 func (h *Handler) Authenticate(w http.ResponseWriter, r *http.Request) error {
 	h.Logger.Info("GET USER ACCOUNT BY EMAIL AND PASSWORD")
 	w.Header().Set("Content-Type", "application/json")
 
+	if err := h.verifyChallenge(r); err != nil {
+		return err
+	}
+
 	h.Logger.Debug("decode credentials dto")
 	var cred CredentialsDTO
 	defer r.Body.Close()
@@ -42,33 +62,29 @@ func (h *Handler) Authenticate(w http.ResponseWriter, r *http.Request) error {
 		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
 	}
 
-	account, err := h.AccountantService.AuthenticateAccount(r.Context(), cred)
-	if err != nil {
-		return err
-	}
-
-	h.Logger.Debug("marshal user account")
-	accountBytes, err := json.Marshal(account)
+	account, err := h.AccountantService.AuthenticateAccount(r.Context(), cred, NewDevice(r))
 	if err != nil {
 		return err
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(accountBytes)
-
-	return nil
+	return h.Login.FirstFactor(w, r, account)
 }
 
 func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) error {
 	h.Logger.Info("CREATE USER ACCOUNT")
 	w.Header().Set("Content-Type", "application/json")
 
+	if err := h.verifyChallenge(r); err != nil {
+		return err
+	}
+
 	h.Logger.Debug("decode create account dto")
 	var crAcc CreateAccountDTO
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&crAcc); err != nil {
 		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
 	}
+	crAcc.IP = auth.RemoteIP(r)
 
 	accountUUID, err := h.AccountantService.Create(r.Context(), crAcc)
 	if err != nil {
@@ -128,6 +144,57 @@ func (h *Handler) UpdateAccount(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (h *Handler) SetLoginAlerts(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("SET LOGIN ALERTS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	h.Logger.Debug("decode login alerts dto")
+	var dto LoginAlertsDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	err := h.AccountantService.SetLoginAlerts(r.Context(), accountUUID, dto.Enabled)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) CheckUsername(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("CHECK USERNAME")
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.UsernameLimiter.Allow(auth.RemoteIP(r)) {
+		return apperror.ErrRateLimited
+	}
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	username := params.ByName("username")
+
+	//? route is public, so own username is reported as taken too
+	availability, err := h.AccountantService.CheckUsername(r.Context(), "", username)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal username availability")
+	availabilityBytes, err := json.Marshal(availability)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(availabilityBytes)
+	return nil
+}
+
 func (h *Handler) GetAccount(w http.ResponseWriter, r *http.Request) error {
 	h.Logger.Info("GET ACCOUNT")
 	w.Header().Set("Content-Type", "application/json")
@@ -168,3 +235,11 @@ func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) error {
 
 	return nil
 }
+
+func (h *Handler) verifyChallenge(r *http.Request) error {
+	if h.Challenges == nil {
+		return nil
+	}
+	h.Logger.Debug("verify proof of work")
+	return h.Challenges.Verify(r.Context(), auth.RemoteIP(r), r.Header.Get(ChallengeHeader), r.Header.Get(SolutionHeader))
+}
@@ -0,0 +1,159 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/internal/mfa"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/useragent"
+)
+
+// SessionStarter opens session for logged in account and returns its token
+type SessionStarter interface {
+	Start(ctx context.Context, accountUUID string, device Device) (string, error)
+}
+
+// Challenges asks risky clients for proof of work before login and registration
+type Challenges interface {
+	Verify(ctx context.Context, ip, challenge, solution string) error
+}
+
+// BrowserSessions opens cookie session of web portal
+type BrowserSessions interface {
+	StartBrowser(w http.ResponseWriter, r *http.Request, accountUUID string) error
+}
+
+// SessionModeHeader lets native clients ask for bearer token when cookie sessions are enabled.
+// DeviceHeader is device name set by game client, browsers are named after user agent.
+// ChallengeHeader and SolutionHeader carry solved proof of work
+const (
+	SessionModeHeader = "X-Eob-Session"
+	DeviceHeader      = "X-Eob-Device"
+	ChallengeHeader   = "X-Eob-Challenge"
+	SolutionHeader    = "X-Eob-Solution"
+)
+
+// Device is where login comes from
+type Device struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// device name set by client is cut to maxDeviceName runes
+const maxDeviceName = 64
+
+func NewDevice(r *http.Request) Device {
+	return Device{
+		Name:      r.Header.Get(DeviceHeader),
+		UserAgent: r.UserAgent(),
+		IP:        auth.RemoteIP(r),
+	}
+}
+
+// DisplayName is name set by client or coarse name from user agent
+func (d Device) DisplayName() string {
+	name := strings.TrimSpace(d.Name)
+	if name == "" {
+		return useragent.Name(d.UserAgent)
+	}
+	if r := []rune(name); len(r) > maxDeviceName {
+		return string(r[:maxDeviceName])
+	}
+	return name
+}
+
+// Login writes responses of login endpoints, so every login method ends the same way.
+// History records every completed login. Browser is nil unless cookie sessions are enabled
+type Login struct {
+	Logger     logging.Logger
+	MFAService mfa.Service
+	Sessions   SessionStarter
+	History    LoginHistory
+	Browser    BrowserSessions
+}
+
+// FirstFactor answers with second factor challenge when account has one enabled
+func (l *Login) FirstFactor(w http.ResponseWriter, r *http.Request, account Account) error {
+	if len(account.MFA) == 0 {
+		return l.Complete(w, r, account)
+	}
+
+	l.Logger.Debug("issue second factor ticket")
+	challenge, err := l.MFAService.Issue(r.Context(), account.UUID, account.MFA)
+	if err != nil {
+		return err
+	}
+	challengeBytes, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(challengeBytes)
+
+	return nil
+}
+
+// Complete opens session and answers with logged in account. session token is sent in Authorization header
+// or in cookie. login is recorded whatever method it used, so owner is alerted about new device
+func (l *Login) Complete(w http.ResponseWriter, r *http.Request, account Account) error {
+	l.Logger.Debug("record login")
+	err := l.History.Record(r.Context(), LoginAttempt{
+		AccountUUID: account.UUID,
+		Email:       account.Email,
+		Outcome:     LoginSuccess,
+		Reason:      ReasonOK,
+		Device:      NewDevice(r),
+		Alerts:      !account.LoginAlertsOff,
+	})
+	if err != nil {
+		l.Logger.Errorf("failed to record login. error: %v", err)
+	}
+
+	if l.Browser != nil && r.Header.Get(SessionModeHeader) != "bearer" {
+		return l.completeBrowser(w, r, account)
+	}
+
+	l.Logger.Debug("start session")
+	sessionToken, err := l.Sessions.Start(r.Context(), account.UUID, NewDevice(r))
+	if err != nil {
+		return err
+	}
+
+	l.Logger.Debug("marshal user account")
+	accountBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Authorization", "Bearer "+sessionToken)
+	w.WriteHeader(http.StatusOK)
+	w.Write(accountBytes)
+
+	return nil
+}
+
+func (l *Login) completeBrowser(w http.ResponseWriter, r *http.Request, account Account) error {
+	if err := l.Browser.StartBrowser(w, r, account.UUID); err != nil {
+		return err
+	}
+
+	l.Logger.Debug("marshal user account")
+	accountBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(accountBytes)
+
+	return nil
+}
@@ -4,25 +4,89 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// staff roles. admin role grants IsAdmin
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// registration modes. invite mode accepts only players with valid invite code
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+// Account.LoginAlertsOff opts out of new device emails. Account.PasswordReset blocks every sign in
+// until password is set again. Account.InviteID is invite used to register. Account.Staff marks account
+// created by corporate identity provider
 type Account struct {
-	UUID      string `json:"uuid" bson:"_id,omitempty"`
-	Email     string `json:"email" bson:"email,omitempty"`
-	Password  string `json:"-" bson:"password,omitempty"`
-	AvatarURL string `json:"avatarURL" bson:"avatar,omitempty"`
-	Username  string `json:"username" bson:"username,omitempty"`
-	Sex       string `json:"sex" bson:"sex,omitempty"`
-	Country   string `json:"country" bson:"country,omitempty"`
-	Language  string `json:"language" bson:"lang,omitempty"`
-	Birthday  int64  `json:"birthday" bson:"birthday,omitempty"`
-	CreatedAt int64  `json:"-" bson:"created_at,omitempty"`
-	LoginAt   int64  `json:"-" bson:"login_at,omitempty"`
-	LogoutAt  int64  `json:"-" bson:"logout_at,omitempty"`
-	IsActive  bool   `json:"-" bson:"is_active,omitempty"`
-	IsAdmin   bool   `json:"-" bson:"is_admin,omitempty"`
-	IsDeleted bool   `json:"-" bson:"is_deleted,omitempty"`
+	UUID           string   `json:"uuid" bson:"_id,omitempty"`
+	Email          string   `json:"email" bson:"email,omitempty"`
+	Password       string   `json:"-" bson:"password,omitempty"`
+	AvatarURL      string   `json:"avatarURL" bson:"avatar,omitempty"`
+	Username       string   `json:"username" bson:"username,omitempty"`
+	Sex            string   `json:"sex" bson:"sex,omitempty"`
+	Country        string   `json:"country" bson:"country,omitempty"`
+	Language       string   `json:"language" bson:"lang,omitempty"`
+	Birthday       int64    `json:"birthday" bson:"birthday,omitempty"`
+	MFA            []string `json:"mfa" bson:"mfa,omitempty"`
+	Roles          []string `json:"roles,omitempty" bson:"roles,omitempty"`
+	Staff          bool     `json:"-" bson:"staff,omitempty"`
+	ExternalID     string   `json:"-" bson:"external_id,omitempty"`
+	InviteID       string   `json:"-" bson:"invite_id,omitempty"`
+	LoginAlertsOff bool     `json:"-" bson:"login_alerts_off,omitempty"`
+	PasswordReset  bool     `json:"-" bson:"password_reset,omitempty"`
+	CreatedAt      int64    `json:"-" bson:"created_at,omitempty"`
+	LoginAt        int64    `json:"-" bson:"login_at,omitempty"`
+	LogoutAt       int64    `json:"-" bson:"logout_at,omitempty"`
+	IsActive       bool     `json:"-" bson:"is_active,omitempty"`
+	IsAdmin        bool     `json:"-" bson:"is_admin,omitempty"`
+	IsDeleted      bool     `json:"-" bson:"is_deleted,omitempty"`
+}
+
+// CheckStatus reports whether account is allowed to login
+func (u *Account) CheckStatus() error {
+	if !u.IsActive {
+		return apperror.ErrNotActive
+	}
+	if u.IsDeleted {
+		return apperror.ErrIsDeleted
+	}
+	return nil
+}
+
+// CheckSignIn is CheckStatus for first factor. reported account may sign in only after password reset
+func (u *Account) CheckSignIn() error {
+	if err := u.CheckStatus(); err != nil {
+		return err
+	}
+	if u.PasswordReset {
+		return apperror.ErrPasswordReset
+	}
+	return nil
+}
+
+// IsStaff reports whether account was provisioned for staff member. staff accounts provisioned
+// before Staff flag have roles and no password
+func (u *Account) IsStaff() bool {
+	return u.Staff || (u.Password == "" && len(u.Roles) > 0)
+}
+
+func (u *Account) HasRole(role string) bool {
+	if role == RoleAdmin && u.IsAdmin {
+		return true
+	}
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 func (u *Account) CheckPassword(password string) error {
@@ -42,10 +106,74 @@ func (u *Account) GeneratePasswordHash() error {
 	return nil
 }
 
+// CreateAccountDTO.IP is client address set by handler. country is detected from it when not given.
+// InviteCode is required when registration is invite only. ReferralCode is optional code of player who
+// brought new one
 type CreateAccountDTO struct {
 	Email          string `json:"email" bson:"email"`
 	Password       string `json:"password" bson:"password"`
 	RepeatPassword string `json:"repeat_password" bson:"-"`
+	Country        string `json:"country" bson:"country"`
+	InviteCode     string `json:"invite_code" bson:"-"`
+	ReferralCode   string `json:"referral_code" bson:"-"`
+	IP             string `json:"-" bson:"-"`
+}
+
+// ExternalAccountDTO is profile from external identity provider. such account has no password
+type ExternalAccountDTO struct {
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatarURL"`
+	Language  string `json:"language"`
+}
+
+// StaffAccountDTO is staff member provisioned by corporate identity provider
+type StaffAccountDTO struct {
+	Email    string   `json:"email"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+// ProvisionAccountDTO is account pushed by provisioning client. password is optional
+type ProvisionAccountDTO struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Username   string `json:"username"`
+	Language   string `json:"language"`
+	ExternalID string `json:"external_id"`
+	Active     bool   `json:"active"`
+}
+
+// DirectoryUser is staff member authenticated by directory
+type DirectoryUser struct {
+	Name  string
+	Roles []string
+}
+
+// login attempt outcomes and reasons
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+
+	ReasonOK             = "ok"
+	ReasonUnknownAccount = "unknown_account"
+	ReasonWrongPassword  = "wrong_password"
+	ReasonNotActive      = "not_active"
+	ReasonDeleted        = "deleted"
+	ReasonPasswordReset  = "password_reset"
+	ReasonDirectory      = "directory_rejected"
+	ReasonError          = "error"
+)
+
+// LoginAttempt is password login of account. AccountUUID is empty when email is unknown,
+// Alerts is set when account wants email about login from new device
+type LoginAttempt struct {
+	AccountUUID string
+	Email       string
+	Outcome     string
+	Reason      string
+	Device      Device
+	Alerts      bool
 }
 
 type CredentialsDTO struct {
@@ -61,14 +189,57 @@ type UpdateCredentialsDTO struct {
 	NewPassword string `json:"new_password,omitempty" bson:"-"`
 }
 
+type LoginAlertsDTO struct {
+	Enabled bool `json:"enabled"`
+}
+
+type ResetPasswordDTO struct {
+	Password       string `json:"password"`
+	RepeatPassword string `json:"repeat_password"`
+}
+
+// UsernameAvailabilityDTO.Reason tells why username can't be used
+type UsernameAvailabilityDTO struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
 type UpdateAccountDTO struct {
-	UUID      string `json:"uuid,omitempty" bson:"_id,omitempty"`
-	AvatarURL string `json:"avatarURL,omitempty" bson:"avatar,omitempty"`
-	Username  string `json:"username,omitempty" bson:"username,omitempty"`
-	Sex       string `json:"sex,omitempty" bson:"sex,omitempty"`
-	Country   string `json:"country,omitempty" bson:"country,omitempty"`
-	Language  string `json:"language,omitempty" bson:"lang,omitempty"`
-	Birthday  int64  `json:"birthday,omitempty" bson:"birthday,omitempty"`
+	UUID       string `json:"uuid,omitempty" bson:"_id,omitempty"`
+	AvatarURL  string `json:"avatarURL,omitempty" bson:"avatar,omitempty"`
+	Username   string `json:"username,omitempty" bson:"username,omitempty"`
+	Sex        string `json:"sex,omitempty" bson:"sex,omitempty"`
+	Country    string `json:"country,omitempty" bson:"country,omitempty"`
+	Language   string `json:"language,omitempty" bson:"lang,omitempty"`
+	Birthday   int64  `json:"birthday,omitempty" bson:"birthday,omitempty"`
+	ExternalID string `json:"-" bson:"external_id,omitempty"`
+}
+
+// filter operators. and, or and not combine Filters, pr checks Field has value
+const (
+	FilterEq  = "eq"
+	FilterNe  = "ne"
+	FilterCo  = "co"
+	FilterSw  = "sw"
+	FilterEw  = "ew"
+	FilterGt  = "gt"
+	FilterGe  = "ge"
+	FilterLt  = "lt"
+	FilterLe  = "le"
+	FilterPr  = "pr"
+	FilterAnd = "and"
+	FilterOr  = "or"
+	FilterNot = "not"
+)
+
+// Filter is storage independent account query. Field is bson name of Account field,
+// string values are compared case insensitive
+type Filter struct {
+	Op      string
+	Field   string
+	Value   interface{}
+	Filters []Filter
 }
 
 func NewAccount(dto CreateAccountDTO) Account {
@@ -76,11 +247,37 @@ func NewAccount(dto CreateAccountDTO) Account {
 	return Account{
 		Email:     dto.Email,
 		Password:  dto.Password,
+		Country:   dto.Country,
+		CreatedAt: tNow,
+		IsActive:  true,
+		IsAdmin:   false,
+	}
+}
+func NewExternalAccount(dto ExternalAccountDTO) Account {
+	tNow := time.Now().UnixNano()
+	return Account{
+		Email:     dto.Email,
+		Username:  dto.Username,
+		AvatarURL: dto.AvatarURL,
+		Language:  dto.Language,
 		CreatedAt: tNow,
 		IsActive:  true,
 		IsAdmin:   false,
 	}
 }
+func NewProvisionedAccount(dto ProvisionAccountDTO) Account {
+	tNow := time.Now().UnixNano()
+	return Account{
+		Email:      dto.Email,
+		Password:   dto.Password,
+		Username:   dto.Username,
+		Language:   dto.Language,
+		ExternalID: dto.ExternalID,
+		CreatedAt:  tNow,
+		IsActive:   dto.Active,
+		IsAdmin:    false,
+	}
+}
 func NewAdmin(dto CreateAccountDTO) Account {
 	tNow := time.Now().UnixNano()
 	return Account{
@@ -92,6 +289,20 @@ func NewAdmin(dto CreateAccountDTO) Account {
 	}
 }
 
+func NewStaff(dto StaffAccountDTO) Account {
+	tNow := time.Now().UnixNano()
+	acc := Account{
+		Email:     dto.Email,
+		Username:  dto.Username,
+		Roles:     dto.Roles,
+		Staff:     true,
+		CreatedAt: tNow,
+		IsActive:  true,
+	}
+	acc.IsAdmin = acc.HasRole(RoleAdmin)
+	return acc
+}
+
 func UpdatedCredentials(dto UpdateCredentialsDTO) Account {
 	return Account{
 		UUID:     dto.UUID,
@@ -102,13 +313,14 @@ func UpdatedCredentials(dto UpdateCredentialsDTO) Account {
 
 func UpdatedAccount(dto UpdateAccountDTO) Account {
 	return Account{
-		UUID:      dto.UUID,
-		AvatarURL: dto.AvatarURL,
-		Username:  dto.Username,
-		Sex:       dto.Sex,
-		Country:   dto.Country,
-		Language:  dto.Language,
-		Birthday:  dto.Birthday,
+		UUID:       dto.UUID,
+		AvatarURL:  dto.AvatarURL,
+		Username:   dto.Username,
+		Sex:        dto.Sex,
+		Country:    dto.Country,
+		Language:   dto.Language,
+		Birthday:   dto.Birthday,
+		ExternalID: dto.ExternalID,
 	}
 }
 
@@ -12,29 +12,103 @@ import (
 
 var _ Service = &service{}
 
+// Directory authenticates staff of configured email domains instead of local password
+type Directory interface {
+	Handles(email string) bool
+	Authenticate(ctx context.Context, email, password string) (DirectoryUser, error)
+}
+
+// Locator resolves country code of client address. empty string when it is unknown
+type Locator interface {
+	Country(ip string) string
+}
+
+// LoginHistory keeps failed password logins and completed logins of every method
+type LoginHistory interface {
+	Record(ctx context.Context, attempt LoginAttempt) error
+}
+
+// Invites redeems invite code of player registering with email. it returns id of invite, which is
+// released when account can not be created
+type Invites interface {
+	Redeem(ctx context.Context, code, email string) (string, error)
+	Release(ctx context.Context, id string) error
+}
+
+// Referrals resolves referral code to account uuid of referrer and tracks referred accounts
+type Referrals interface {
+	Referrer(ctx context.Context, code string) (string, error)
+	Track(ctx context.Context, referrerUUID, accountUUID string) error
+}
+
+// UsernamePolicy checks length, charset, reserved words and profanity of username
+type UsernamePolicy interface {
+	Check(username string) error
+}
+
 type service struct {
-	storage Storage
-	logger  logging.Logger
+	storage      Storage
+	directory    Directory
+	history      LoginHistory
+	locator      Locator
+	invites      Invites
+	referrals    Referrals
+	usernames    UsernamePolicy
+	registration string
+	logger       logging.Logger
 }
 
-func NewService(accountStorage Storage, logger logging.Logger) (Service, error) {
+func NewService(accountStorage Storage, directory Directory, history LoginHistory, locator Locator,
+	invites Invites, referrals Referrals, usernames UsernamePolicy, registration string,
+	logger logging.Logger) (Service, error) {
+	switch registration {
+	case RegistrationOpen, RegistrationInvite, RegistrationClosed:
+	default:
+		return nil, fmt.Errorf("unknown registration mode %q", registration)
+	}
 	return &service{
-		storage: accountStorage,
-		logger:  logger,
+		storage:      accountStorage,
+		directory:    directory,
+		history:      history,
+		locator:      locator,
+		invites:      invites,
+		referrals:    referrals,
+		usernames:    usernames,
+		registration: registration,
+		logger:       logger,
 	}, nil
 }
 
 type Service interface {
 	Create(ctx context.Context, dto CreateAccountDTO) (string, error)
-	AuthenticateAccount(ctx context.Context, dto CredentialsDTO) (Account, error)
+	CreateExternal(ctx context.Context, dto ExternalAccountDTO) (string, error)
+	ProvisionStaff(ctx context.Context, dto StaffAccountDTO) (Account, error)
+	Provision(ctx context.Context, dto ProvisionAccountDTO) (string, error)
+	AuthenticateAccount(ctx context.Context, dto CredentialsDTO, device Device) (Account, error)
 	GetAccount(ctx context.Context, uuid string) (Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (Account, error)
+	FindAccounts(ctx context.Context, filter Filter, offset, limit int64) ([]Account, int64, error)
 	UpdateCredentials(ctx context.Context, dto UpdateCredentialsDTO) error
 	UpdateAccount(ctx context.Context, dto UpdateAccountDTO) error
+	SetActive(ctx context.Context, uuid string, active bool) error
 	Delete(ctx context.Context, uuid string) error
+	EnableSecondFactor(ctx context.Context, uuid, factor string) error
+	DisableSecondFactor(ctx context.Context, uuid, factor string) error
+	SetLoginAlerts(ctx context.Context, uuid string, enabled bool) error
+	RequirePasswordReset(ctx context.Context, uuid string) error
+	ResetPassword(ctx context.Context, uuid string, dto ResetPasswordDTO) error
+	CheckUsername(ctx context.Context, accountUUID, username string) (UsernameAvailabilityDTO, error)
 }
 
 //?register new user
 func (s service) Create(ctx context.Context, dto CreateAccountDTO) (accUUID string, err error) {
+	if s.registration == RegistrationClosed {
+		return accUUID, apperror.ErrRegistrationClosed
+	}
+	if s.registration == RegistrationInvite && dto.InviteCode == "" {
+		return accUUID, apperror.ErrInviteRequired
+	}
+
 	s.logger.Debug("check if user exist")
 	u, err := s.storage.FindByEmail(ctx, dto.Email)
 
@@ -47,6 +121,22 @@ func (s service) Create(ctx context.Context, dto CreateAccountDTO) (accUUID stri
 		return accUUID, apperror.BadRequestError("password does not match repeat password")
 	}
 
+	if dto.Country == "" && dto.IP != "" {
+		s.logger.Debug("detect country by ip")
+		dto.Country = s.locator.Country(dto.IP)
+	}
+
+	//? referral is a bonus, so bad code does not stop registration
+	var referrerUUID string
+	if dto.ReferralCode != "" {
+		s.logger.Debug("find referrer")
+		referrerUUID, err = s.referrals.Referrer(ctx, dto.ReferralCode)
+		if err != nil {
+			s.logger.Warnf("referral code %q is skipped. error: %v", dto.ReferralCode, err)
+			referrerUUID = ""
+		}
+	}
+
 	acc := NewAccount(dto)
 
 	s.logger.Debug("generate password hash")
@@ -56,41 +146,228 @@ func (s service) Create(ctx context.Context, dto CreateAccountDTO) (accUUID stri
 		return
 	}
 
+	if s.registration == RegistrationInvite {
+		s.logger.Debug("redeem invite")
+		acc.InviteID, err = s.invites.Redeem(ctx, dto.InviteCode, dto.Email)
+		if err != nil {
+			return accUUID, err
+		}
+	}
+
 	accUUID, err = s.storage.Create(ctx, acc)
 
 	if err != nil {
+		if acc.InviteID != "" {
+			s.logger.Debug("release invite")
+			if rErr := s.invites.Release(ctx, acc.InviteID); rErr != nil {
+				s.logger.Errorf("failed to release invite %s. error: %v", acc.InviteID, rErr)
+			}
+		}
 		if errors.Is(err, apperror.ErrNotFound) {
 			return accUUID, err
 		}
 		return accUUID, fmt.Errorf("failed to create user. error: %w", err)
 	}
 
+	if referrerUUID != "" && referrerUUID != accUUID {
+		s.logger.Debug("track referral")
+		if err = s.referrals.Track(ctx, referrerUUID, accUUID); err != nil {
+			s.logger.Errorf("failed to track referral of account %s. error: %v", accUUID, err)
+		}
+	}
+
+	return accUUID, nil
+}
+
+//? register user signed in with external identity provider
+func (s service) CreateExternal(ctx context.Context, dto ExternalAccountDTO) (accUUID string, err error) {
+	s.logger.Debug("check if user exist")
+	u, err := s.storage.FindByEmail(ctx, dto.Email)
+	if err == nil {
+		return u.UUID, apperror.ErrAlreadyExists
+	}
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return accUUID, fmt.Errorf("failed to find user by email. error: %w", err)
+	}
+	if s.registration != RegistrationOpen {
+		return accUUID, apperror.ErrRegistrationClosed
+	}
+
+	if dto.Username != "" {
+		if err = s.checkUsername(ctx, "", dto.Username); err != nil {
+			var appErr *apperror.AppError
+			if !errors.As(err, &appErr) {
+				return accUUID, err
+			}
+			s.logger.Debugf("skip username of identity provider. %v", err)
+			dto.Username = ""
+		}
+	}
+
+	accUUID, err = s.storage.Create(ctx, NewExternalAccount(dto))
+	if err != nil {
+		return accUUID, fmt.Errorf("failed to create user. error: %w", err)
+	}
+
+	return accUUID, nil
+}
+
+//? create staff account on first sign in, later sign ins sync roles from identity provider
+func (s service) ProvisionStaff(ctx context.Context, dto StaffAccountDTO) (acc Account, err error) {
+	acc, err = s.storage.FindByEmail(ctx, dto.Email)
+	if err != nil {
+		if !errors.Is(err, apperror.ErrNotFound) {
+			return acc, fmt.Errorf("failed to find user by email. error: %w", err)
+		}
+
+		//? directory names follow player rules too, so staff can't take reserved or offensive names
+		if dto.Username != "" {
+			if err = s.checkUsername(ctx, "", dto.Username); err != nil {
+				var appErr *apperror.AppError
+				if !errors.As(err, &appErr) {
+					return acc, err
+				}
+				s.logger.Debugf("skip username %s of staff. %v", dto.Username, err)
+				dto.Username = ""
+			}
+		}
+
+		s.logger.Debug("create staff account")
+		acc = NewStaff(dto)
+		acc.UUID, err = s.storage.Create(ctx, acc)
+		if err != nil {
+			return acc, fmt.Errorf("failed to create staff account. error: %w", err)
+		}
+		return acc, nil
+	}
+
+	//? player registered with staff email must not get roles of staff member
+	if !acc.IsStaff() {
+		s.logger.Warnf("refuse to provision staff over player account %s", acc.UUID)
+		return acc, apperror.ErrStaffConflict
+	}
+
+	s.logger.Debug("sync staff roles")
+	acc.Roles = dto.Roles
+	acc.IsAdmin = NewStaff(dto).IsAdmin
+	if err = s.storage.UpdateRoles(ctx, acc.UUID, acc.Roles, acc.IsAdmin); err != nil {
+		return acc, fmt.Errorf("failed to update staff roles. error: %w", err)
+	}
+	return acc, nil
+}
+
+//? create account pushed by provisioning client
+func (s service) Provision(ctx context.Context, dto ProvisionAccountDTO) (accUUID string, err error) {
+	s.logger.Debug("check if user exist")
+	u, err := s.storage.FindByEmail(ctx, dto.Email)
+	if err == nil {
+		return u.UUID, apperror.ErrAlreadyExists
+	}
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return accUUID, fmt.Errorf("failed to find user by email. error: %w", err)
+	}
+
+	if dto.Username != "" {
+		if err = s.checkUsername(ctx, "", dto.Username); err != nil {
+			return accUUID, err
+		}
+	}
+
+	acc := NewProvisionedAccount(dto)
+	if acc.Password != "" {
+		s.logger.Debug("generate password hash")
+		if err = acc.GeneratePasswordHash(); err != nil {
+			return accUUID, fmt.Errorf("failed to provision account. error: %w", err)
+		}
+	}
+
+	accUUID, err = s.storage.Create(ctx, acc)
+	if err != nil {
+		return accUUID, fmt.Errorf("failed to provision account. error: %w", err)
+	}
+
 	return accUUID, nil
 }
 
-//? authenticate user by mail and password
-func (s service) AuthenticateAccount(ctx context.Context, dto CredentialsDTO) (u Account, err error) {
+//? authenticate user by mail and password. failed attempt is recorded here, success is recorded by
+//? Login.Complete like logins of other methods
+func (s service) AuthenticateAccount(ctx context.Context, dto CredentialsDTO, device Device) (u Account, err error) {
+	u, reason, err := s.authenticate(ctx, dto)
+	if err == nil {
+		return u, nil
+	}
+
+	attempt := LoginAttempt{
+		AccountUUID: u.UUID,
+		Email:       dto.Email,
+		Outcome:     LoginFailure,
+		Reason:      reason,
+		Device:      device,
+	}
+	if rErr := s.history.Record(ctx, attempt); rErr != nil {
+		s.logger.Errorf("failed to record login attempt. error: %v", rErr)
+	}
+
+	return u, err
+}
+
+func (s service) authenticate(ctx context.Context, dto CredentialsDTO) (u Account, reason string, err error) {
+	if s.directory != nil && s.directory.Handles(dto.Email) {
+		return s.authenticateStaff(ctx, dto)
+	}
 
 	u, err = s.storage.FindByEmail(ctx, dto.Email)
 
 	if err != nil {
 		if errors.Is(err, apperror.ErrNotFound) {
-			return u, err
+			return u, ReasonUnknownAccount, err
 		}
-		return u, fmt.Errorf("failed to find user by email. error: %w", err)
+		return u, ReasonError, fmt.Errorf("failed to find user by email. error: %w", err)
 	}
-	if !u.IsActive {
-		return u, apperror.ErrNotActive
-	}
-	if u.IsDeleted {
-		return u, apperror.ErrIsDeleted
+	if err = u.CheckStatus(); err != nil {
+		return u, statusReason(err), err
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(dto.Password)); err != nil {
-		return u, apperror.ErrNotFound
+		return u, ReasonWrongPassword, apperror.ErrNotFound
+	}
+	if u.PasswordReset {
+		return u, ReasonPasswordReset, apperror.ErrPasswordReset
 	}
 
-	return u, nil
+	return u, ReasonOK, nil
+}
+
+//? directory users get staff account with roles from their groups
+func (s service) authenticateStaff(ctx context.Context, dto CredentialsDTO) (u Account, reason string, err error) {
+	s.logger.Debug("authenticate against directory")
+	user, err := s.directory.Authenticate(ctx, dto.Email, dto.Password)
+	if err != nil {
+		return u, ReasonDirectory, err
+	}
+
+	u, err = s.ProvisionStaff(ctx, StaffAccountDTO{
+		Email:    dto.Email,
+		Username: user.Name,
+		Roles:    user.Roles,
+	})
+	if err != nil {
+		return u, ReasonError, err
+	}
+	if err = u.CheckSignIn(); err != nil {
+		return u, statusReason(err), err
+	}
+	return u, ReasonOK, nil
+}
+
+func statusReason(err error) string {
+	if errors.Is(err, apperror.ErrIsDeleted) {
+		return ReasonDeleted
+	}
+	if errors.Is(err, apperror.ErrPasswordReset) {
+		return ReasonPasswordReset
+	}
+	return ReasonNotActive
 }
 
 func (s service) GetAccount(ctx context.Context, uuid string) (acc Account, err error) {
@@ -105,6 +382,26 @@ func (s service) GetAccount(ctx context.Context, uuid string) (acc Account, err
 	return acc, nil
 }
 
+func (s service) GetAccountByEmail(ctx context.Context, email string) (acc Account, err error) {
+	acc, err = s.storage.FindByEmail(ctx, email)
+
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return acc, err
+		}
+		return acc, fmt.Errorf("failed to find user by email. error: %w", err)
+	}
+	return acc, nil
+}
+
+func (s service) FindAccounts(ctx context.Context, filter Filter, offset, limit int64) ([]Account, int64, error) {
+	accs, total, err := s.storage.Find(ctx, filter, offset, limit)
+	if err != nil {
+		return accs, total, fmt.Errorf("failed to find accounts. error: %w", err)
+	}
+	return accs, total, nil
+}
+
 //? update user credentials
 func (s service) UpdateCredentials(ctx context.Context, dto UpdateCredentialsDTO) error {
 	var updatedAccount Account
@@ -148,6 +445,13 @@ func (s service) UpdateAccount(ctx context.Context, dto UpdateAccountDTO) error
 	var updatedAccount Account
 	s.logger.Debug("get account by uuid")
 
+	if dto.Username != "" {
+		s.logger.Debug("check username")
+		if err := s.checkUsername(ctx, dto.UUID, dto.Username); err != nil {
+			return err
+		}
+	}
+
 	updatedAccount = UpdatedAccount(dto)
 
 	s.logger.Debug("generate password hash")
@@ -163,6 +467,18 @@ func (s service) UpdateAccount(ctx context.Context, dto UpdateAccountDTO) error
 	return nil
 }
 
+//? inactive account can't sign in
+func (s service) SetActive(ctx context.Context, uuid string, active bool) error {
+	err := s.storage.SetActive(ctx, uuid, active)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update account status. error: %w", err)
+	}
+	return nil
+}
+
 func (s service) Delete(ctx context.Context, uuid string) error {
 	err := s.storage.Delete(ctx, uuid)
 
@@ -174,3 +490,108 @@ func (s service) Delete(ctx context.Context, uuid string) error {
 	}
 	return err
 }
+
+func (s service) EnableSecondFactor(ctx context.Context, uuid, factor string) error {
+	err := s.storage.AddSecondFactor(ctx, uuid, factor)
+
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to enable second factor. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) DisableSecondFactor(ctx context.Context, uuid, factor string) error {
+	err := s.storage.RemoveSecondFactor(ctx, uuid, factor)
+
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to disable second factor. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) SetLoginAlerts(ctx context.Context, uuid string, enabled bool) error {
+	err := s.storage.SetLoginAlerts(ctx, uuid, enabled)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update login alerts. error: %w", err)
+	}
+	return nil
+}
+
+//? password login is refused until ResetPassword
+func (s service) RequirePasswordReset(ctx context.Context, uuid string) error {
+	err := s.storage.SetPasswordReset(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to require password reset. error: %w", err)
+	}
+	return nil
+}
+
+//? set password without old one. caller must prove access to account email
+func (s service) ResetPassword(ctx context.Context, uuid string, dto ResetPasswordDTO) error {
+	if dto.Password == "" {
+		return apperror.BadRequestError("password is required")
+	}
+	if dto.Password != dto.RepeatPassword {
+		return apperror.BadRequestError("password does not match repeat password")
+	}
+
+	s.logger.Debug("generate password hash")
+	hash, err := generatePasswordHash(dto.Password)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.ResetPassword(ctx, uuid, hash)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to reset password. error: %w", err)
+	}
+	return nil
+}
+
+//? own username of account is available to it
+func (s service) CheckUsername(ctx context.Context, accountUUID, username string) (UsernameAvailabilityDTO, error) {
+	availability := UsernameAvailabilityDTO{Username: username, Available: true}
+	err := s.checkUsername(ctx, accountUUID, username)
+	if err != nil {
+		var appErr *apperror.AppError
+		if !errors.As(err, &appErr) {
+			return availability, err
+		}
+		availability.Available = false
+		availability.Reason = appErr.Message
+	}
+	return availability, nil
+}
+
+//? uniqueness is enforced by index too, this check gives clear error before write
+func (s service) checkUsername(ctx context.Context, accountUUID, username string) error {
+	if err := s.usernames.Check(username); err != nil {
+		return err
+	}
+	acc, err := s.storage.FindByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find user by username. error: %w", err)
+	}
+	if acc.UUID != accountUUID {
+		return apperror.ErrUsernameTaken
+	}
+	return nil
+}
@@ -8,6 +8,15 @@ type Storage interface {
 	Create(ctx context.Context, account Account) (string, error)
 	FindByEmail(ctx context.Context, email string) (Account, error)
 	FindOne(ctx context.Context, uuid string) (Account, error)
+	FindByUsername(ctx context.Context, username string) (Account, error)
+	Find(ctx context.Context, filter Filter, offset, limit int64) ([]Account, int64, error)
 	UpdateAccount(ctx context.Context, account Account) error
 	Delete(ctx context.Context, uuid string) error
+	AddSecondFactor(ctx context.Context, uuid, factor string) error
+	RemoveSecondFactor(ctx context.Context, uuid, factor string) error
+	SetActive(ctx context.Context, uuid string, active bool) error
+	UpdateRoles(ctx context.Context, uuid string, roles []string, isAdmin bool) error
+	SetLoginAlerts(ctx context.Context, uuid string, enabled bool) error
+	SetPasswordReset(ctx context.Context, uuid string) error
+	ResetPassword(ctx context.Context, uuid, password string) error
 }
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/alerts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ alerts.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) alerts.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+//? expired reports are removed by mongo TTL monitor
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create login report indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, report alerts.Report) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, report)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (report alerts.Report, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return report, apperror.ErrNotFound
+		}
+		return report, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&report); err != nil {
+		return report, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return report, nil
+}
+
+func (s *db) SetReported(ctx context.Context, id string, reportedAt time.Time) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"reported_at": reportedAt}}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *db) Delete(ctx context.Context, id string) error {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/oauth"
+	"github.com/charopevez/eob-accountant-worker/internal/pat"
+	"github.com/charopevez/eob-accountant-worker/internal/sessions"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	reportURL   = "/api/login/report"
+	passwordURL = "/api/login/report/password"
+)
+
+// Handler signs reported account out everywhere and lets owner set new password.
+// it works with accounts, sessions and tokens directly, since login history needs alerts before they exist
+type Handler struct {
+	Logger            logging.Logger
+	AlertService      Service
+	AccountantService accounts.Service
+	SessionService    sessions.Service
+	OAuthService      oauth.Service
+	PATService        pat.Service
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, reportURL, apperror.Middleware(h.Report))
+	router.HandlerFunc(http.MethodPost, passwordURL, apperror.Middleware(h.ResetPassword))
+}
+
+func (h *Handler) Report(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REPORT LOGIN")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode report dto")
+	var dto ReportDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	accountUUID, err := h.AlertService.Report(r.Context(), dto.Token)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("require password reset, then revoke sessions and tokens")
+	if err = h.AccountantService.RequirePasswordReset(r.Context(), accountUUID); err != nil {
+		return err
+	}
+	if err = h.SessionService.RevokeAll(r.Context(), accountUUID); err != nil {
+		return err
+	}
+	if err = h.OAuthService.RevokeAll(r.Context(), accountUUID); err != nil {
+		return err
+	}
+	if err = h.PATService.RevokeAll(r.Context(), accountUUID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("RESET PASSWORD AFTER LOGIN REPORT")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode reset password dto")
+	var dto ResetPasswordDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	accountUUID, err := h.AlertService.Reported(r.Context(), dto.Token)
+	if err != nil {
+		return err
+	}
+
+	err = h.AccountantService.ResetPassword(r.Context(), accountUUID, accounts.ResetPasswordDTO{
+		Password:       dto.Password,
+		RepeatPassword: dto.RepeatPassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("revoke sessions opened before password reset")
+	if err = h.SessionService.RevokeAll(r.Context(), accountUUID); err != nil {
+		return err
+	}
+	if err = h.AlertService.CloseReport(r.Context(), dto.Token); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
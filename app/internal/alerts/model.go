@@ -0,0 +1,33 @@
+package alerts
+
+import "time"
+
+// Report is "this wasn't me" link of login alert. it is kept after report, so that owner can set
+// new password with the same link. Report.ReportedAt is set on report, password may be reset only after it
+type Report struct {
+	ID          string    `bson:"_id"`
+	AccountUUID string    `bson:"account_uuid"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ReportedAt  time.Time `bson:"reported_at,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type ReportDTO struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordDTO struct {
+	Token          string `json:"token"`
+	Password       string `json:"password"`
+	RepeatPassword string `json:"repeat_password"`
+}
+
+func NewReport(id, accountUUID string, ttl time.Duration) Report {
+	tNow := time.Now()
+	return Report{
+		ID:          id,
+		AccountUUID: accountUUID,
+		CreatedAt:   tNow,
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
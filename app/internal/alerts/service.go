@@ -0,0 +1,138 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/logins"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/mail"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ logins.Notifier = &service{}
+
+type service struct {
+	storage   Storage
+	sender    mail.Sender
+	reportURL string
+	ttl       time.Duration
+	logger    logging.Logger
+}
+
+func NewService(reportStorage Storage, sender mail.Sender, reportURL string, ttl time.Duration,
+	logger logging.Logger) (Service, error) {
+	if _, err := url.Parse(reportURL); err != nil {
+		return nil, fmt.Errorf("failed to parse login report url. error: %w", err)
+	}
+	return &service{
+		storage:   reportStorage,
+		sender:    sender,
+		reportURL: reportURL,
+		ttl:       ttl,
+		logger:    logger,
+	}, nil
+}
+
+type Service interface {
+	NotifyLogin(ctx context.Context, email string, entry logins.Entry) error
+	Report(ctx context.Context, token string) (string, error)
+	Reported(ctx context.Context, token string) (string, error)
+	CloseReport(ctx context.Context, token string) error
+}
+
+//? email login details with link to report login
+func (s service) NotifyLogin(ctx context.Context, email string, entry logins.Entry) error {
+	s.logger.Debug("generate login report token")
+	raw, err := token.New(32)
+	if err != nil {
+		return err
+	}
+	if err = s.storage.Create(ctx, NewReport(token.Hash(raw), entry.AccountUUID, s.ttl)); err != nil {
+		return fmt.Errorf("failed to create login report. error: %w", err)
+	}
+
+	u, _ := url.Parse(s.reportURL)
+	q := u.Query()
+	q.Set("token", raw)
+	u.RawQuery = q.Encode()
+
+	var details strings.Builder
+	fmt.Fprintf(&details, "Device: %s\n", entry.Device)
+	fmt.Fprintf(&details, "IP address: %s\n", entry.IP)
+	if entry.Country != "" {
+		fmt.Fprintf(&details, "Country: %s\n", entry.Country)
+	}
+	fmt.Fprintf(&details, "Time: %s\n", entry.CreatedAt.UTC().Format(time.RFC1123))
+
+	err = s.sender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "New sign in to your account",
+		Body: fmt.Sprintf("Your account was signed in from a new device or location.\n\n%s\n"+
+			"If it was you, you can ignore this message. If it wasn't, use the link below to sign out "+
+			"everywhere and set new password. It expires in %s.\n\n%s\n", details.String(), s.ttl, u.String()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send login alert. error: %w", err)
+	}
+
+	return nil
+}
+
+//? report is kept until password is reset or link expires, so repeated clicks are harmless
+func (s service) Report(ctx context.Context, raw string) (string, error) {
+	report, err := s.find(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if report.ReportedAt.IsZero() {
+		if err = s.storage.SetReported(ctx, report.ID, time.Now()); err != nil {
+			return "", fmt.Errorf("failed to update login report. error: %w", err)
+		}
+	}
+	return report.AccountUUID, nil
+}
+
+//? link which was not reported yet can not reset password, so leaked alert alone does not take account over
+func (s service) Reported(ctx context.Context, raw string) (string, error) {
+	report, err := s.find(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if report.ReportedAt.IsZero() {
+		return "", apperror.ErrLinkInvalid
+	}
+	return report.AccountUUID, nil
+}
+
+//? report link is removed when new password is set
+func (s service) CloseReport(ctx context.Context, raw string) error {
+	err := s.storage.Delete(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrLinkInvalid
+		}
+		return fmt.Errorf("failed to delete login report. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) find(ctx context.Context, raw string) (report Report, err error) {
+	report, err = s.storage.FindOne(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return report, apperror.ErrLinkInvalid
+		}
+		return report, fmt.Errorf("failed to find login report. error: %w", err)
+	}
+	if time.Now().After(report.ExpiresAt) {
+		return report, apperror.ErrLinkInvalid
+	}
+	return report, nil
+}
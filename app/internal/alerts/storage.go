@@ -0,0 +1,13 @@
+package alerts
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	Create(ctx context.Context, report Report) error
+	FindOne(ctx context.Context, id string) (Report, error)
+	SetReported(ctx context.Context, id string, reportedAt time.Time) error
+	Delete(ctx context.Context, id string) error
+}
@@ -11,6 +11,56 @@ var (
 	ErrNotActive  = NewAppError("account isn't active", "NS-000011", "Please check you email for activation link")
 	ErrIsDeleted  = NewAppError("account is deleted", "NS-000012", "")
 	ErrNotMatched = NewAppError("wrong password", "NS-000012", "")
+
+	ErrPasswordReset = NewAppError("password reset required", "NS-000014",
+		"Please set new password with link from security alert email")
+
+	//storage error
+	ErrAlreadyExists = NewAppError("already exists", "NS-000013", "")
+
+	//login error
+	ErrTicketInvalid  = NewAppError("login ticket is invalid or expired", "NS-000020", "Please login again")
+	ErrPasskeyInvalid = NewAppError("passkey verification failed", "NS-000021", "")
+	ErrLinkInvalid    = NewAppError("sign in link is invalid or expired", "NS-000022", "Please request a new link")
+	ErrCodeInvalid    = NewAppError("verification code is invalid or expired", "NS-000023", "")
+	ErrCodeAttempts   = NewAppError("too many verification attempts", "NS-000024", "Please try again later")
+	ErrExternalLogin  = NewAppError("external sign in failed or expired", "NS-000025", "Please start sign in again")
+
+	ErrChallengeRequired = NewAppError("proof of work is required", "NS-000026",
+		"Solve puzzle from GET /api/challenge and send it in X-Eob-Challenge and X-Eob-Solution headers")
+	ErrChallengeInvalid = NewAppError("proof of work is invalid or expired", "NS-000027",
+		"Please solve new puzzle from GET /api/challenge")
+	ErrStepUpRequired = NewAppError("verification required", "NS-000028",
+		"Request code with POST /api/account/:uuid/otp and repeat request with X-Verification-Code header")
+
+	//access error
+	ErrUnauthorized   = NewAppError("authentication required", "NS-000030", "Send session token in Authorization header")
+	ErrForbidden      = NewAppError("access denied", "NS-000031", "")
+	ErrReauthRequired = NewAppError("recent authentication required", "NS-000032",
+		"Confirm password or second factor with POST /api/reauth and repeat request")
+	ErrSignatureInvalid = NewAppError("request signature is invalid", "NS-000033",
+		"Sign method, path, timestamp, nonce and body digest with shared key")
+	ErrImpersonation = NewAppError("action is not allowed while impersonating", "NS-000034",
+		"Sensitive actions require session of account owner")
+	ErrCSRF = NewAppError("csrf token is missing or invalid", "NS-000035",
+		"Send value of csrf cookie in X-CSRF-Token header")
+	ErrStaffConflict = NewAppError("email belongs to player account", "NS-000036",
+		"Staff sign in can't take over account that wasn't created by identity provider")
+	ErrRateLimited  = NewAppError("too many requests", "NS-000037", "Please try again later")
+	ErrBodyTooLarge = NewAppError("request body is too large", "NS-000038",
+		"Signed request body must not exceed 10MB")
+	ErrReauthLocked = NewAppError("too many wrong passwords", "NS-000039",
+		"Please try again later or confirm with step up code")
+
+	//registration error
+	ErrRegistrationClosed = NewAppError("registration is closed", "NS-000040", "")
+	ErrInviteInvalid      = NewAppError("invite code is invalid, expired or used up", "NS-000041", "")
+	ErrInviteRequired     = NewAppError("invite code is required", "NS-000042", "Registration is invite only")
+	ErrReferralInvalid    = NewAppError("referral code is invalid", "NS-000043", "")
+
+	//username error
+	ErrUsernameTaken      = NewAppError("username is already taken", "NS-000050", "")
+	ErrUsernameNotAllowed = NewAppError("username is not allowed", "NS-000051", "")
 )
 
 type AppError struct {
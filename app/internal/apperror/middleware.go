@@ -18,9 +18,8 @@ func Middleware(h appHandler) http.HandlerFunc {
 					w.Write(ErrNotFound.Marshal())
 					return
 				}
-				err := err.(*AppError)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write(err.Marshal())
+				w.WriteHeader(status(appErr))
+				w.Write(appErr.Marshal())
 				return
 			}
 			w.WriteHeader(418)
@@ -28,3 +27,19 @@ func Middleware(h appHandler) http.HandlerFunc {
 		}
 	}
 }
+
+func status(err *AppError) int {
+	switch err {
+	case ErrUnauthorized, ErrReauthRequired, ErrStepUpRequired, ErrSignatureInvalid:
+		return http.StatusUnauthorized
+	case ErrForbidden, ErrImpersonation, ErrCSRF, ErrRegistrationClosed, ErrStaffConflict:
+		return http.StatusForbidden
+	case ErrChallengeRequired:
+		return http.StatusPreconditionRequired
+	case ErrRateLimited, ErrReauthLocked:
+		return http.StatusTooManyRequests
+	case ErrBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+type ctxKey struct{}
+type ipKey struct{}
+
+// scopes of delegated access to account routes
+const (
+	ScopeAccountRead  = "account:read"
+	ScopeAccountWrite = "account:write"
+	// ScopeAdmin lets token of admin account use admin routes
+	ScopeAdmin = "admin"
+
+	// OpenID Connect scopes
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+
+	// scopes of service accounts on internal routes
+	ScopeInternalAccountsRead  = "internal:accounts:read"
+	ScopeInternalAccountsWrite = "internal:accounts:write"
+	ScopeInternalTokens        = "internal:tokens"
+)
+
+// Principal is the caller identity resolved from request token
+type Principal struct {
+	AccountUUID string
+	SessionID   string
+	AuthTime    time.Time
+	ExpiresAt   time.Time
+	IsAdmin     bool
+	// ClientID and Scopes are set for delegated tokens. nil Scopes means full access
+	ClientID string
+	Scopes   []string
+	// IsService is set for service account tokens. AccountUUID is empty then
+	IsService bool
+	// ActorUUID is real staff account acting on behalf of AccountUUID with impersonation token
+	ActorUUID string
+}
+
+// IsImpersonated reports whether principal is impersonation of account by staff
+func (p Principal) IsImpersonated() bool {
+	return p.ActorUUID != ""
+}
+
+// Allows reports whether principal may use route guarded by one of scopes
+func (p Principal) Allows(scopes ...string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		for _, required := range scopes {
+			if granted == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator resolves token into principal. apperror.ErrUnauthorized means token isn't known
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (Principal, error)
+}
+
+// RevocationChecker reports whether token was revoked by other service
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, token string) (bool, error)
+}
+
+// CookieSessions reads browser session cookie and checks CSRF token of unsafe requests
+type CookieSessions interface {
+	Token(r *http.Request) string
+	VerifyCSRF(ctx context.Context, raw string, r *http.Request) error
+}
+
+// VerificationCodeHeader carries step up code proving access to mailbox
+const VerificationCodeHeader = "X-Verification-Code"
+
+// StepUpVerifier checks code sent to account email before sensitive operation
+type StepUpVerifier interface {
+	VerifyStepUp(ctx context.Context, accountUUID, code string) error
+}
+
+// ImpersonationAuditor records every request made with impersonation token
+type ImpersonationAuditor interface {
+	RecordRequest(ctx context.Context, p Principal, method, path, ip string) error
+}
+
+// Middleware guards handlers. it wraps handlers before apperror.Middleware.
+// Cookies is nil unless cookie sessions are enabled, StepUp is nil unless step up is required
+type Middleware struct {
+	Logger         logging.Logger
+	Authenticators []Authenticator
+	Revocations    RevocationChecker
+	Impersonations ImpersonationAuditor
+	Cookies        CookieSessions
+	StepUp         StepUpVerifier
+	FreshWindow    time.Duration
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// trustedProxies are gateways allowed to report client address in X-Real-IP and X-Forwarded-For
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets CIDRs of gateways in front of worker. it is called once on start
+func TrustProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("failed to parse trusted proxy %q. error: %w", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// RemoteIP returns client address. forwarding headers are read only from trusted proxies,
+// otherwise any client could pick its address
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	//? rightmost address not added by trusted proxy is client, addresses left of it are client supplied
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip.String()) {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns client address of request authenticated by middleware
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ipKey{}).(string)
+	return ip
+}
+
+// BearerToken returns token from Authorization header
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Authenticated requires any valid account token. delegated tokens must have one of scopes
+func (m *Middleware) Authenticated(h func(http.ResponseWriter, *http.Request) error, scopes ...string) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		p, err := m.principal(r)
+		if err != nil {
+			return err
+		}
+		if p.IsService || !p.Allows(scopes...) {
+			return apperror.ErrForbidden
+		}
+		//? request isn't served when it can't be audited
+		if p.IsImpersonated() && m.Impersonations != nil {
+			err = m.Impersonations.RecordRequest(r.Context(), p, r.Method, r.URL.Path, RemoteIP(r))
+			if err != nil {
+				return err
+			}
+		}
+		return h(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+// Optional serves request with principal when it carries known token and anonymously otherwise
+func (m *Middleware) Optional(h func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		p, err := m.principal(r)
+		if err != nil {
+			if errors.Is(err, apperror.ErrUnauthorized) {
+				return h(w, r)
+			}
+			return err
+		}
+		return h(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+// Service requires service account token with one of scopes. calls are logged with client id
+func (m *Middleware) Service(h func(http.ResponseWriter, *http.Request) error, scopes ...string) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		p, err := m.principal(r)
+		if err != nil {
+			return err
+		}
+		if !p.IsService || !p.Allows(scopes...) {
+			return apperror.ErrForbidden
+		}
+		m.Logger.Infof("service %s calls %s %s", p.ClientID, r.Method, r.URL.Path)
+		return h(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+func (m *Middleware) principal(r *http.Request) (Principal, error) {
+	//? principal of signed request is set by signature middleware wrapped around router
+	if p, ok := FromContext(r.Context()); ok {
+		return p, nil
+	}
+	ctx := context.WithValue(r.Context(), ipKey{}, RemoteIP(r))
+	raw := BearerToken(r)
+	if raw == "" && m.Cookies != nil {
+		raw = m.Cookies.Token(r)
+		if raw != "" && !safeMethod(r.Method) {
+			if err := m.Cookies.VerifyCSRF(ctx, raw, r); err != nil {
+				return Principal{}, err
+			}
+		}
+	}
+	if raw == "" {
+		return Principal{}, apperror.ErrUnauthorized
+	}
+	return m.Resolve(ctx, raw)
+}
+
+//? cookie is sent by browser on cross site requests too, so every state changing request needs CSRF token
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Resolve checks token against revocations and authenticators
+func (m *Middleware) Resolve(ctx context.Context, raw string) (Principal, error) {
+	if m.Revocations != nil {
+		revoked, err := m.Revocations.IsRevoked(ctx, raw)
+		if err != nil {
+			return Principal{}, err
+		}
+		if revoked {
+			m.Logger.Debug("token is revoked")
+			return Principal{}, apperror.ErrUnauthorized
+		}
+	}
+
+	for _, a := range m.Authenticators {
+		p, err := a.Authenticate(ctx, raw)
+		if err != nil {
+			if errors.Is(err, apperror.ErrUnauthorized) {
+				continue
+			}
+			return p, err
+		}
+		return p, nil
+	}
+
+	m.Logger.Debug("token is not accepted by any authenticator")
+	return Principal{}, apperror.ErrUnauthorized
+}
+
+// Owner requires token of account from :uuid route param or of admin
+func (m *Middleware) Owner(h func(http.ResponseWriter, *http.Request) error, scopes ...string) func(http.ResponseWriter, *http.Request) error {
+	return m.Authenticated(func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+		if p.AccountUUID != params.ByName("uuid") && !p.IsAdmin {
+			return apperror.ErrForbidden
+		}
+		return h(w, r)
+	}, scopes...)
+}
+
+// Admin requires token of admin account. delegated tokens need admin scope
+func (m *Middleware) Admin(h func(http.ResponseWriter, *http.Request) error, scopes ...string) func(http.ResponseWriter, *http.Request) error {
+	return m.Authenticated(func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		if !p.IsAdmin {
+			return apperror.ErrForbidden
+		}
+		return h(w, r)
+	}, append(scopes, ScopeAdmin)...)
+}
+
+// Self requires fresh session of account from :uuid route param. unlike Owner it doesn't let admins act
+// for other accounts, so that only player can add login credentials to account
+func (m *Middleware) Self(h func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return m.Fresh(func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+		if p.AccountUUID != params.ByName("uuid") {
+			return apperror.ErrForbidden
+		}
+		return h(w, r)
+	})
+}
+
+// FirstParty requires session of account itself. delegated, service and impersonation tokens can't
+// grant other clients access to account
+func (m *Middleware) FirstParty(h func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return m.Authenticated(func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		if p.IsImpersonated() {
+			return apperror.ErrImpersonation
+		}
+		if p.SessionID == "" || p.ClientID != "" || p.Scopes != nil {
+			return apperror.ErrForbidden
+		}
+		return h(w, r)
+	})
+}
+
+// NotImpersonated rejects impersonation tokens. it wraps handler guarded by Authenticated or Owner,
+// so that staff can't add credentials that outlive impersonation
+func (m *Middleware) NotImpersonated(h func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		if p.IsImpersonated() {
+			return apperror.ErrImpersonation
+		}
+		return h(w, r)
+	}
+}
+
+// Fresh requires owner session authenticated within fresh window. delegated tokens are never fresh,
+// impersonation tokens are never allowed. with StepUp every request needs code from caller mailbox too
+func (m *Middleware) Fresh(h func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return m.Owner(func(w http.ResponseWriter, r *http.Request) error {
+		p, _ := FromContext(r.Context())
+		if p.IsImpersonated() {
+			return apperror.ErrImpersonation
+		}
+		if time.Since(p.AuthTime) > m.FreshWindow {
+			return apperror.ErrReauthRequired
+		}
+		if m.StepUp != nil {
+			code := r.Header.Get(VerificationCodeHeader)
+			if code == "" {
+				return apperror.ErrStepUpRequired
+			}
+			m.Logger.Debug("verify step up code")
+			if err := m.StepUp.VerifyStepUp(r.Context(), p.AccountUUID, code); err != nil {
+				return err
+			}
+		}
+		return h(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteIP(t *testing.T) {
+	if err := TrustProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer TrustProxies(nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"direct client spoofs real ip", "203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"direct client spoofs forwarded for", "203.0.113.7:5000", "", "198.51.100.1", "203.0.113.7"},
+		{"proxy sets real ip", "10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"proxy with invalid real ip", "10.0.0.2:5000", "nope", "", "10.0.0.2"},
+		{"proxy appends client", "10.0.0.2:5000", "", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", "", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"proxy without headers", "10.0.0.2:5000", "", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := RemoteIP(r); got != tt.want {
+				t.Errorf("RemoteIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustProxiesRejectsInvalidCIDR(t *testing.T) {
+	if err := TrustProxies([]string{"10.0.0.0"}); err == nil {
+		t.Error("TrustProxies() accepted address without prefix length")
+	}
+}
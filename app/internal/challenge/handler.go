@@ -0,0 +1,46 @@
+package challenge
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	challengeURL = "/api/challenge"
+)
+
+type Handler struct {
+	Logger           logging.Logger
+	ChallengeService Service
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, challengeURL, apperror.Middleware(h.GetChallenge))
+}
+
+func (h *Handler) GetChallenge(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET CHALLENGE")
+	w.Header().Set("Content-Type", "application/json")
+
+	puzzle, err := h.ChallengeService.Issue(r.Context(), auth.RemoteIP(r))
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal puzzle")
+	puzzleBytes, err := json.Marshal(puzzle)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(puzzleBytes)
+
+	return nil
+}
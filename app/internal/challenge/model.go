@@ -0,0 +1,34 @@
+package challenge
+
+import "time"
+
+// risk levels of client address
+const (
+	RiskLow = iota
+	RiskElevated
+	RiskHigh
+)
+
+// Algorithm of puzzle. solution is found when sha256 of "challenge:solution" starts with Difficulty zero bits
+const Algorithm = "sha256"
+
+// Options of proof of work. Networks are CIDR blocks with bad reputation, FailureThreshold failed logins
+// from address within FailureWindow elevate its risk, twice as many make it high
+type Options struct {
+	Key              string
+	TTL              time.Duration
+	Difficulty       int
+	HighDifficulty   int
+	Networks         []string
+	FailureWindow    time.Duration
+	FailureThreshold int64
+}
+
+// Puzzle is signed challenge for client. Required tells that login and registration need solution now
+type Puzzle struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	Required   bool      `json:"required"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,242 @@
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ accounts.Challenges = &service{}
+
+// FailureCounter counts failed logins from address. login history implements it
+type FailureCounter interface {
+	CountFailures(ctx context.Context, ip string, since time.Time) (int64, error)
+}
+
+// solutions longer than maxSolution are rejected without hashing
+const maxSolution = 64
+
+type service struct {
+	failures FailureCounter
+	options  Options
+	networks []*net.IPNet
+	used     *usedCache
+	logger   logging.Logger
+}
+
+func NewService(failures FailureCounter, options Options, logger logging.Logger) (Service, error) {
+	if options.Key == "" {
+		return nil, fmt.Errorf("challenge key is required")
+	}
+	if options.Difficulty <= 0 || options.HighDifficulty < options.Difficulty || options.HighDifficulty > 32 {
+		return nil, fmt.Errorf("challenge difficulty must be between 1 and 32 bits")
+	}
+
+	networks := make([]*net.IPNet, 0, len(options.Networks))
+	for _, cidr := range options.Networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse network %s. error: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+
+	used := &usedCache{seen: make(map[string]time.Time)}
+	if options.TTL > 0 {
+		go used.sweep(options.TTL)
+	}
+
+	return &service{
+		failures: failures,
+		options:  options,
+		networks: networks,
+		used:     used,
+		logger:   logger,
+	}, nil
+}
+
+type Service interface {
+	Issue(ctx context.Context, ip string) (Puzzle, error)
+	Verify(ctx context.Context, ip, challenge, solution string) error
+	Risk(ctx context.Context, ip string) int
+}
+
+//? puzzle is issued at any risk, so that clients may solve it in advance
+func (s service) Issue(ctx context.Context, ip string) (p Puzzle, err error) {
+	risk := s.Risk(ctx, ip)
+	difficulty := s.difficulty(risk)
+
+	nonce, err := token.New(16)
+	if err != nil {
+		return p, err
+	}
+	expiresAt := time.Now().Add(s.options.TTL)
+	payload := strings.Join([]string{nonce, strconv.Itoa(difficulty), strconv.FormatInt(expiresAt.Unix(), 10)}, ".")
+
+	return Puzzle{
+		Challenge:  payload + "." + s.sign(payload, ip),
+		Algorithm:  Algorithm,
+		Difficulty: difficulty,
+		Required:   risk > RiskLow,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+//? low risk clients pass without solution. puzzle is bound to address and can be used once
+func (s service) Verify(ctx context.Context, ip, challenge, solution string) error {
+	risk := s.Risk(ctx, ip)
+	if risk == RiskLow {
+		return nil
+	}
+	if challenge == "" || solution == "" {
+		s.logger.Debugf("proof of work required from %s", ip)
+		return apperror.ErrChallengeRequired
+	}
+
+	if err := s.check(ip, challenge, solution, s.difficulty(risk)); err != nil {
+		s.logger.Debugf("rejected proof of work from %s. error: %v", ip, err)
+		return apperror.ErrChallengeInvalid
+	}
+	if !s.used.add(challenge, s.options.TTL) {
+		s.logger.Debugf("rejected proof of work from %s. error: puzzle was already used", ip)
+		return apperror.ErrChallengeInvalid
+	}
+	return nil
+}
+
+//? address failing to check is treated as elevated risk
+func (s service) Risk(ctx context.Context, ip string) int {
+	risk := RiskLow
+	if addr := net.ParseIP(ip); addr != nil {
+		for _, network := range s.networks {
+			if network.Contains(addr) {
+				risk++
+				break
+			}
+		}
+	}
+
+	failures, err := s.failures.CountFailures(ctx, ip, time.Now().Add(-s.options.FailureWindow))
+	if err != nil {
+		s.logger.Errorf("failed to assess risk. error: %v", err)
+		failures = s.options.FailureThreshold
+	}
+	if failures >= s.options.FailureThreshold {
+		risk++
+	}
+	if failures >= 2*s.options.FailureThreshold {
+		risk++
+	}
+
+	if risk > RiskHigh {
+		return RiskHigh
+	}
+	return risk
+}
+
+func (s service) check(ip, challenge, solution string, required int) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return errors.New("malformed challenge")
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(s.sign(payload, ip)), []byte(parts[3])) {
+		return errors.New("signature mismatch")
+	}
+
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return errors.New("malformed difficulty")
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return errors.New("malformed expiry")
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return errors.New("challenge expired")
+	}
+	if difficulty < required {
+		return errors.New("challenge is too easy for current risk")
+	}
+
+	if len(solution) > maxSolution {
+		return errors.New("solution is too long")
+	}
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	if leadingZeros(sum[:]) < difficulty {
+		return errors.New("solution does not match difficulty")
+	}
+	return nil
+}
+
+func (s service) difficulty(risk int) int {
+	if risk == RiskHigh {
+		return s.options.HighDifficulty
+	}
+	return s.options.Difficulty
+}
+
+func (s service) sign(payload, ip string) string {
+	mac := hmac.New(sha256.New, []byte(s.options.Key))
+	mac.Write([]byte(payload + "\n" + ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeros(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// usedCache remembers solved puzzles until they expire. it is per worker instance
+type usedCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+//? expired puzzles stay in map until sweep, their signature has expired by then anyway
+func (c *usedCache) add(challenge string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[challenge]; ok {
+		return false
+	}
+	c.seen[challenge] = time.Now().Add(ttl)
+	return true
+}
+
+//? expired puzzles are removed once per interval, so add does not scan whole map
+func (c *usedCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for tNow := range ticker.C {
+		c.mu.Lock()
+		for ch, expires := range c.seen {
+			if tNow.After(expires) {
+				delete(c.seen, ch)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,166 @@
+package challenge
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const testIP = "203.0.113.7"
+
+type failures int64
+
+func (f failures) CountFailures(ctx context.Context, ip string, since time.Time) (int64, error) {
+	return int64(f), nil
+}
+
+func newTestService(t *testing.T, failed int64) service {
+	t.Helper()
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	s, err := NewService(failures(failed), Options{
+		Key:              "test key",
+		TTL:              time.Minute,
+		Difficulty:       8,
+		HighDifficulty:   12,
+		FailureWindow:    time.Hour,
+		FailureThreshold: 3,
+	}, logging.Logger{Entry: logrus.NewEntry(l)})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return *s.(*service)
+}
+
+func solve(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if leadingZeros(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func unsolved(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if leadingZeros(sum[:]) < difficulty {
+			return solution
+		}
+	}
+}
+
+func TestLeadingZeros(t *testing.T) {
+	tests := []struct {
+		sum  []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0xff}, 8},
+		{[]byte{0x00, 0x00, 0x10}, 19},
+		{[]byte{0x00, 0x00}, 16},
+		{[]byte{}, 0},
+	}
+	for _, tt := range tests {
+		if got := leadingZeros(tt.sum); got != tt.want {
+			t.Errorf("leadingZeros(%x) = %d, want %d", tt.sum, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := newTestService(t, 0)
+	puzzle, err := s.Issue(context.Background(), testIP)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	solution := solve(puzzle.Challenge, puzzle.Difficulty)
+
+	//? challenge signed by service with given difficulty and expiry
+	signed := func(difficulty int, expiresAt time.Time) string {
+		payload := strings.Join([]string{"nonce", strconv.Itoa(difficulty), strconv.FormatInt(expiresAt.Unix(), 10)}, ".")
+		return payload + "." + s.sign(payload, testIP)
+	}
+	expired := signed(8, time.Now().Add(-time.Second))
+	parts := strings.Split(puzzle.Challenge, ".")
+	tampered := strings.Join([]string{parts[0], "1", parts[2], parts[3]}, ".")
+	wrong := unsolved(puzzle.Challenge, puzzle.Difficulty)
+
+	tests := []struct {
+		name      string
+		ip        string
+		challenge string
+		solution  string
+		required  int
+		wantErr   bool
+	}{
+		{name: "valid solution", ip: testIP, challenge: puzzle.Challenge, solution: solution, required: 8},
+		{name: "other address", ip: "198.51.100.1", challenge: puzzle.Challenge, solution: solution, required: 8, wantErr: true},
+		{name: "tampered difficulty", ip: testIP, challenge: tampered, solution: solution, required: 1, wantErr: true},
+		{name: "expired", ip: testIP, challenge: expired, solution: solve(expired, 8), required: 8, wantErr: true},
+		{name: "too easy for risk", ip: testIP, challenge: puzzle.Challenge, solution: solution, required: 12, wantErr: true},
+		{name: "wrong solution", ip: testIP, challenge: puzzle.Challenge, solution: wrong, required: 8, wantErr: true},
+		{name: "solution is too long", ip: testIP, challenge: puzzle.Challenge, solution: strings.Repeat("0", maxSolution+1), required: 8, wantErr: true},
+		{name: "malformed challenge", ip: testIP, challenge: "a.b", solution: solution, required: 8, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.check(tt.ip, tt.challenge, tt.solution, tt.required)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		failed  int64
+		solved  bool
+		replay  bool
+		wantErr error
+	}{
+		{name: "low risk passes without solution", failed: 0},
+		{name: "elevated risk requires solution", failed: 3, wantErr: apperror.ErrChallengeRequired},
+		{name: "elevated risk with solution", failed: 3, solved: true},
+		{name: "high risk with solution", failed: 6, solved: true},
+		{name: "solution is used once", failed: 3, solved: true, replay: true, wantErr: apperror.ErrChallengeInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, tt.failed)
+			var challenge, solution string
+			if tt.solved {
+				puzzle, err := s.Issue(context.Background(), testIP)
+				if err != nil {
+					t.Fatalf("Issue() error = %v", err)
+				}
+				challenge, solution = puzzle.Challenge, solve(puzzle.Challenge, puzzle.Difficulty)
+			}
+
+			err := s.Verify(context.Background(), testIP, challenge, solution)
+			if tt.replay {
+				if err != nil {
+					t.Fatalf("first Verify() error = %v", err)
+				}
+				err = s.Verify(context.Background(), testIP, challenge, solution)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
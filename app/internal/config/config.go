@@ -2,6 +2,7 @@ package config
 
 import (
 	"sync"
+	"time"
 
 	"github.com/charopevez/eob-accountant-worker/pkg/logging"
 	"github.com/ilyakaznacheev/cleanenv"
@@ -10,9 +11,10 @@ import (
 type Config struct {
 	IsDebug *bool `yaml:"is_debug"`
 	Listen  struct {
-		Type   string `yaml:"type" env-default:"port"`
-		BindIP string `yaml:"bind_ip" env-default:"localhost"`
-		Port   string `yaml:"port" env-default:"8080"`
+		Type           string   `yaml:"type" env-default:"port"`
+		BindIP         string   `yaml:"bind_ip" env-default:"localhost"`
+		Port           string   `yaml:"port" env-default:"8080"`
+		TrustedProxies []string `yaml:"trusted_proxies"`
 	}
 	MongoDB struct {
 		Host       string `yaml:"host" env-required:"true"`
@@ -22,7 +24,194 @@ type Config struct {
 		AuthDB     string `yaml:"auth_db" env-required:"true"`
 		Database   string `yaml:"database" env-required:"true"`
 		Collection string `yaml:"collection" env-required:"true"`
+
+		Collections struct {
+			Passkeys           string `yaml:"passkeys" env-default:"passkeys"`
+			Ceremonies         string `yaml:"ceremonies" env-default:"webauthn_ceremonies"`
+			LoginTickets       string `yaml:"login_tickets" env-default:"login_tickets"`
+			MagicLinks         string `yaml:"magic_links" env-default:"magic_links"`
+			OTPCodes           string `yaml:"otp_codes" env-default:"otp_codes"`
+			OTPAttempts        string `yaml:"otp_attempts" env-default:"otp_attempts"`
+			Sessions           string `yaml:"sessions" env-default:"sessions"`
+			ReauthAttempts     string `yaml:"reauth_attempts" env-default:"reauth_attempts"`
+			OAuthClients       string `yaml:"oauth_clients" env-default:"oauth_clients"`
+			OAuthCodes         string `yaml:"oauth_codes" env-default:"oauth_codes"`
+			OAuthDevices       string `yaml:"oauth_devices" env-default:"oauth_device_codes"`
+			OAuthTokens        string `yaml:"oauth_tokens" env-default:"oauth_tokens"`
+			OAuthConsents      string `yaml:"oauth_consents" env-default:"oauth_consents"`
+			Revocations        string `yaml:"revocations" env-default:"revoked_tokens"`
+			AccessTokens       string `yaml:"access_tokens" env-default:"personal_access_tokens"`
+			Identities         string `yaml:"identities" env-default:"account_identities"`
+			IdentityStates     string `yaml:"identity_states" env-default:"identity_states"`
+			SAMLRequests       string `yaml:"saml_requests" env-default:"saml_requests"`
+			Impersonations     string `yaml:"impersonations" env-default:"impersonations"`
+			ImpersonationAudit string `yaml:"impersonation_audit" env-default:"impersonation_audit"`
+			LoginHistory       string `yaml:"login_history" env-default:"login_history"`
+			LoginReports       string `yaml:"login_reports" env-default:"login_reports"`
+			Invites            string `yaml:"invites" env-default:"invites"`
+			ReferralCodes      string `yaml:"referral_codes" env-default:"referral_codes"`
+			Referrals          string `yaml:"referrals" env-default:"referrals"`
+		} `yaml:"collections"`
 	} `yaml:"mongodb" env-required:"true"`
+	WebAuthn struct {
+		RPID    string        `yaml:"rp_id" env-default:"localhost"`
+		RPName  string        `yaml:"rp_name" env-default:"eob"`
+		Origins []string      `yaml:"origins" env-default:"http://localhost:10005"`
+		Timeout time.Duration `yaml:"timeout" env-default:"5m"`
+	} `yaml:"webauthn"`
+	MFA struct {
+		TicketTTL time.Duration `yaml:"ticket_ttl" env-default:"5m"`
+	} `yaml:"mfa"`
+	Mail struct {
+		Host     string `yaml:"host"`
+		Port     string `yaml:"port" env-default:"587"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from" env-default:"no-reply@eob.local"`
+	} `yaml:"mail"`
+	MagicLink struct {
+		URL            string        `yaml:"url" env-default:"http://localhost:10005/login/magic"`
+		TTL            time.Duration `yaml:"ttl" env-default:"15m"`
+		ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+		RequestLimit   int           `yaml:"request_limit" env-default:"5"`
+		RequestWindow  time.Duration `yaml:"request_window" env-default:"1m"`
+	} `yaml:"magic_link"`
+	OTP struct {
+		TTL            time.Duration `yaml:"ttl" env-default:"10m"`
+		ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+		MaxAttempts    int           `yaml:"max_attempts" env-default:"5"`
+		AttemptWindow  time.Duration `yaml:"attempt_window" env-default:"1h"`
+		RequireStepUp  bool          `yaml:"require_step_up" env-default:"false"`
+	} `yaml:"otp"`
+	Session struct {
+		TTL            time.Duration `yaml:"ttl" env-default:"720h"`
+		IdleTimeout    time.Duration `yaml:"idle_timeout" env-default:"30m"`
+		FreshWindow    time.Duration `yaml:"fresh_window" env-default:"5m"`
+		ReauthAttempts int           `yaml:"reauth_attempts" env-default:"5"`
+		ReauthWindow   time.Duration `yaml:"reauth_window" env-default:"15m"`
+		Cookie         struct {
+			Enabled    bool   `yaml:"enabled"`
+			Name       string `yaml:"name" env-default:"eob_session"`
+			CSRFName   string `yaml:"csrf_name" env-default:"eob_csrf"`
+			CSRFHeader string `yaml:"csrf_header" env-default:"X-CSRF-Token"`
+			Domain     string `yaml:"domain"`
+			Secure     bool   `yaml:"secure" env-default:"true"`
+			SameSite   string `yaml:"same_site" env-default:"lax"`
+		} `yaml:"cookie"`
+	} `yaml:"session"`
+	OAuth struct {
+		CodeTTL         time.Duration `yaml:"code_ttl" env-default:"1m"`
+		AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-default:"1h"`
+		RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+		DeviceCodeTTL   time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+		DeviceInterval  time.Duration `yaml:"device_interval" env-default:"5s"`
+		VerificationURL string        `yaml:"verification_url" env-default:"http://localhost:10005/device"`
+	} `yaml:"oauth"`
+	OIDC struct {
+		Issuer     string        `yaml:"issuer" env-default:"http://localhost:10005"`
+		SigningKey string        `yaml:"signing_key"`
+		IDTokenTTL time.Duration `yaml:"id_token_ttl" env-default:"1h"`
+	} `yaml:"oidc"`
+	PAT struct {
+		DefaultTTL time.Duration `yaml:"default_ttl" env-default:"720h"`
+		MaxTTL     time.Duration `yaml:"max_ttl" env-default:"8760h"`
+	} `yaml:"pat"`
+	Signing struct {
+		ClockSkew time.Duration `yaml:"clock_skew" env-default:"5m"`
+		Keys      []struct {
+			ID     string   `yaml:"id"`
+			Secret string   `yaml:"secret"`
+			Scopes []string `yaml:"scopes"`
+		} `yaml:"keys"`
+	} `yaml:"signing"`
+	ExternalLogin struct {
+		StateTTL  time.Duration `yaml:"state_ttl" env-default:"10m"`
+		Providers []struct {
+			Name         string   `yaml:"name"`
+			Issuer       string   `yaml:"issuer"`
+			ClientID     string   `yaml:"client_id"`
+			ClientSecret string   `yaml:"client_secret"`
+			RedirectURL  string   `yaml:"redirect_url"`
+			Scopes       []string `yaml:"scopes"`
+		} `yaml:"providers"`
+	} `yaml:"external_login"`
+	SAML struct {
+		Enabled           bool              `yaml:"enabled"`
+		RootURL           string            `yaml:"root_url" env-default:"http://localhost:10005"`
+		EntityID          string            `yaml:"entity_id"`
+		CertFile          string            `yaml:"cert_file"`
+		KeyFile           string            `yaml:"key_file"`
+		IDPMetadataURL    string            `yaml:"idp_metadata_url"`
+		IDPMetadataFile   string            `yaml:"idp_metadata_file"`
+		EmailAttribute    string            `yaml:"email_attribute" env-default:"email"`
+		NameAttribute     string            `yaml:"name_attribute" env-default:"displayName"`
+		RoleAttribute     string            `yaml:"role_attribute" env-default:"groups"`
+		RoleMapping       map[string]string `yaml:"role_mapping"`
+		AllowIDPInitiated bool              `yaml:"allow_idp_initiated"`
+	} `yaml:"saml"`
+	Impersonation struct {
+		TTL time.Duration `yaml:"ttl" env-default:"30m"`
+	} `yaml:"impersonation"`
+	LDAP struct {
+		Domains []struct {
+			Domain             string            `yaml:"domain"`
+			URL                string            `yaml:"url"`
+			StartTLS           bool              `yaml:"start_tls"`
+			InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+			CAFile             string            `yaml:"ca_file"`
+			BindDN             string            `yaml:"bind_dn"`
+			NameAttribute      string            `yaml:"name_attribute" env-default:"cn"`
+			GroupBaseDN        string            `yaml:"group_base_dn"`
+			GroupFilter        string            `yaml:"group_filter"`
+			GroupAttribute     string            `yaml:"group_attribute" env-default:"cn"`
+			RoleMapping        map[string]string `yaml:"role_mapping"`
+		} `yaml:"domains"`
+	} `yaml:"ldap"`
+	SCIM struct {
+		BaseURL    string `yaml:"base_url" env-default:"http://localhost:10005"`
+		MaxResults int    `yaml:"max_results" env-default:"200"`
+		Tokens     []struct {
+			Name  string `yaml:"name"`
+			Token string `yaml:"token"`
+		} `yaml:"tokens"`
+	} `yaml:"scim"`
+	LoginHistory struct {
+		Retention  time.Duration `yaml:"retention" env-default:"2160h"`
+		MaxResults int64         `yaml:"max_results" env-default:"100"`
+	} `yaml:"login_history"`
+	LoginAlerts struct {
+		ReportURL string        `yaml:"report_url" env-default:"http://localhost:10005/security/report"`
+		ReportTTL time.Duration `yaml:"report_ttl" env-default:"24h"`
+	} `yaml:"login_alerts"`
+	GeoIP struct {
+		Path           string        `yaml:"path"`
+		ReloadInterval time.Duration `yaml:"reload_interval" env-default:"1m"`
+	} `yaml:"geoip"`
+	Challenge struct {
+		Enabled          bool          `yaml:"enabled"`
+		Key              string        `yaml:"key"`
+		TTL              time.Duration `yaml:"ttl" env-default:"5m"`
+		Difficulty       int           `yaml:"difficulty" env-default:"18"`
+		HighDifficulty   int           `yaml:"high_difficulty" env-default:"22"`
+		Networks         []string      `yaml:"networks"`
+		FailureWindow    time.Duration `yaml:"failure_window" env-default:"15m"`
+		FailureThreshold int64         `yaml:"failure_threshold" env-default:"5"`
+	} `yaml:"challenge"`
+	Registration struct {
+		Mode string `yaml:"mode" env-default:"open"`
+	} `yaml:"registration"`
+	Referrals struct {
+		MaxResults int64 `yaml:"max_results" env-default:"100"`
+	} `yaml:"referrals"`
+	Usernames struct {
+		MinLength     int           `yaml:"min_length" env-default:"3"`
+		MaxLength     int           `yaml:"max_length" env-default:"20"`
+		Pattern       string        `yaml:"pattern" env-default:"^[A-Za-z0-9_.-]+$"`
+		Reserved      []string      `yaml:"reserved" env-default:"admin,administrator,support,moderator,staff,system,root,eob"`
+		ProfanityPath string        `yaml:"profanity_path"`
+		CheckLimit    int           `yaml:"check_limit" env-default:"30"`
+		CheckWindow   time.Duration `yaml:"check_window" env-default:"1m"`
+	} `yaml:"usernames"`
 }
 
 var instance *Config
@@ -0,0 +1,209 @@
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/go-ldap/ldap/v3"
+)
+
+var _ accounts.Directory = &LDAP{}
+
+const timeout = 5 * time.Second
+
+// Domain is LDAP directory serving staff of one email domain.
+// {username} and {email} placeholders are replaced in BindDN and GroupFilter, {dn} in GroupFilter.
+// users whose groups map to no role are refused
+type Domain struct {
+	Domain             string
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CAFile             string
+	BindDN             string
+	NameAttribute      string
+	GroupBaseDN        string
+	GroupFilter        string
+	GroupAttribute     string
+	RoleMapping        map[string]string
+}
+
+type domain struct {
+	Domain
+	tls *tls.Config
+}
+
+// LDAP authenticates staff by binding as user
+type LDAP struct {
+	domains map[string]domain
+	logger  logging.Logger
+}
+
+func NewLDAP(domains []Domain, logger logging.Logger) (*LDAP, error) {
+	d := &LDAP{
+		domains: make(map[string]domain, len(domains)),
+		logger:  logger,
+	}
+	for _, cfg := range domains {
+		if cfg.Domain == "" || cfg.URL == "" || cfg.BindDN == "" {
+			return nil, fmt.Errorf("ldap domain requires domain, url and bind dn")
+		}
+
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.CAFile != "" {
+			pem, err := ioutil.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ldap ca file. error: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in ldap ca file %s", cfg.CAFile)
+			}
+		}
+		d.domains[strings.ToLower(cfg.Domain)] = domain{Domain: cfg, tls: tlsConfig}
+	}
+	return d, nil
+}
+
+func (d *LDAP) Handles(email string) bool {
+	_, ok := d.domains[emailDomain(email)]
+	return ok
+}
+
+//? wrong credentials are reported like wrong local password
+func (d *LDAP) Authenticate(ctx context.Context, email, password string) (user accounts.DirectoryUser, err error) {
+	cfg, ok := d.domains[emailDomain(email)]
+	if !ok {
+		return user, apperror.ErrNotFound
+	}
+	//? empty password would be unauthenticated bind which always succeeds
+	if password == "" {
+		return user, apperror.ErrNotFound
+	}
+
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}), ldap.DialWithTLSConfig(cfg.tls))
+	if err != nil {
+		return user, fmt.Errorf("failed to connect to ldap. error: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(timeout)
+
+	if cfg.StartTLS {
+		if err = conn.StartTLS(cfg.tls); err != nil {
+			return user, fmt.Errorf("failed to start tls. error: %w", err)
+		}
+	}
+
+	username := email[:strings.LastIndex(email, "@")]
+	userDN := expand(cfg.BindDN, escapeDN, map[string]string{"{username}": username, "{email}": email})
+
+	d.logger.Debugf("bind ldap user %s", userDN)
+	if err = conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return user, apperror.ErrNotFound
+		}
+		return user, fmt.Errorf("failed to bind ldap user. error: %w", err)
+	}
+
+	if cfg.NameAttribute != "" {
+		user.Name, err = d.name(conn, cfg, userDN)
+		if err != nil {
+			return user, err
+		}
+	}
+	if cfg.GroupFilter != "" {
+		user.Roles, err = d.roles(conn, cfg, userDN, username, email)
+		if err != nil {
+			return user, err
+		}
+	}
+	//? directory account without staff role is not staff member
+	if len(user.Roles) == 0 {
+		d.logger.Warnf("staff %s has no mapped roles", email)
+		return user, apperror.ErrForbidden
+	}
+	return user, nil
+}
+
+func (d *LDAP) name(conn *ldap.Conn, cfg domain, userDN string) (string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(userDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		1, int(timeout.Seconds()), false, "(objectClass=*)", []string{cfg.NameAttribute}, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to read ldap user. error: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return "", nil
+	}
+	return result.Entries[0].GetAttributeValue(cfg.NameAttribute), nil
+}
+
+func (d *LDAP) roles(conn *ldap.Conn, cfg domain, userDN, username, email string) ([]string, error) {
+	filter := expand(cfg.GroupFilter, ldap.EscapeFilter,
+		map[string]string{"{dn}": userDN, "{username}": username, "{email}": email})
+	result, err := conn.Search(ldap.NewSearchRequest(cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(timeout.Seconds()), false, filter, []string{cfg.GroupAttribute}, nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ldap groups. error: %w", err)
+	}
+
+	roles := make([]string, 0)
+	for _, entry := range result.Entries {
+		role, ok := cfg.RoleMapping[entry.GetAttributeValue(cfg.GroupAttribute)]
+		if ok && !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 1 {
+		return ""
+	}
+	return strings.ToLower(email[i+1:])
+}
+
+func expand(template string, escape func(string) string, values map[string]string) string {
+	for placeholder, value := range values {
+		template = strings.ReplaceAll(template, placeholder, escape(value))
+	}
+	return template
+}
+
+// escapeDN escapes attribute value of distinguished name, RFC 4514 2.4
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			(r == ' ' || r == '#') && i == 0,
+			r == ' ' && i == len(value)-1:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testPeople = "ou=people,dc=corp,dc=local"
+	testGroups = "ou=groups,dc=corp,dc=local"
+)
+
+type group struct {
+	cn      string
+	members []string
+}
+
+// server is in-process LDAP directory answering simple bind and search requests
+type server struct {
+	listener  net.Listener
+	passwords map[string]string
+	names     map[string]string
+	groups    []group
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	alice := "uid=alice," + testPeople
+	bob := "uid=bob," + testPeople
+	obrien := `uid=o\+brien,` + testPeople
+	s := &server{
+		listener:  listener,
+		passwords: map[string]string{alice: "alice pass", bob: "bob pass", obrien: "obrien pass"},
+		names:     map[string]string{alice: "Alice Admin", bob: "Bob Builder", obrien: "Pat O'Brien"},
+		groups: []group{
+			{cn: "eob-admins", members: []string{alice}},
+			{cn: "eob-support", members: []string{alice, obrien}},
+			{cn: "engineering", members: []string{alice, bob}},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *server) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := ber.DecodeString(op.Children[1].Data.Bytes())
+			password := ber.DecodeString(op.Children[2].Data.Bytes())
+			code := ldap.LDAPResultInvalidCredentials
+			if p, ok := s.passwords[dn]; ok && p == password {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			base := ber.DecodeString(op.Children[0].Data.Bytes())
+			scope, _ := op.Children[1].Value.(int64)
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				s.write(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+			if scope == ldap.ScopeBaseObject {
+				if name, ok := s.names[base]; ok {
+					s.write(conn, id, entry(base, "cn", name))
+				}
+			} else if base == testGroups {
+				for _, g := range s.groups {
+					for _, member := range g.members {
+						if filter == "(member="+ldap.EscapeFilter(member)+")" {
+							s.write(conn, id, entry("cn="+g.cn+","+testGroups, "cn", g.cn))
+						}
+					}
+				}
+			}
+			s.write(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func (s *server) write(conn net.Conn, id int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	envelope.AppendChild(op)
+	conn.Write(envelope.Bytes())
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return op
+}
+
+func entry(dn, attribute, value string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+	attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "Type"))
+	values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+	values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+	attr.AppendChild(values)
+	attributes.AppendChild(attr)
+	op.AppendChild(attributes)
+	return op
+}
+
+func newTestLDAP(t *testing.T, url string) *LDAP {
+	t.Helper()
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	d, err := NewLDAP([]Domain{{
+		Domain:         "corp.local",
+		URL:            url,
+		BindDN:         "uid={username}," + testPeople,
+		NameAttribute:  "cn",
+		GroupBaseDN:    testGroups,
+		GroupFilter:    "(member={dn})",
+		GroupAttribute: "cn",
+		RoleMapping:    map[string]string{"eob-admins": "admin", "eob-support": "support"},
+	}}, logging.Logger{Entry: logrus.NewEntry(l)})
+	if err != nil {
+		t.Fatalf("NewLDAP() error = %v", err)
+	}
+	return d
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newTestLDAP(t, newServer(t).url())
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantName  string
+		wantRoles []string
+		wantErr   error
+	}{
+		{name: "mapped roles", email: "alice@corp.local", password: "alice pass", wantName: "Alice Admin", wantRoles: []string{"admin", "support"}},
+		{name: "domain is case insensitive", email: "alice@CORP.local", password: "alice pass", wantName: "Alice Admin", wantRoles: []string{"admin", "support"}},
+		{name: "escaped username", email: "o+brien@corp.local", password: "obrien pass", wantName: "Pat O'Brien", wantRoles: []string{"support"}},
+		{name: "wrong password", email: "alice@corp.local", password: "bob pass", wantErr: apperror.ErrNotFound},
+		{name: "unknown user", email: "carol@corp.local", password: "carol pass", wantErr: apperror.ErrNotFound},
+		{name: "empty password", email: "alice@corp.local", wantErr: apperror.ErrNotFound},
+		{name: "other domain", email: "alice@eob.local", password: "alice pass", wantErr: apperror.ErrNotFound},
+		{name: "no mapped roles", email: "bob@corp.local", password: "bob pass", wantErr: apperror.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := d.Authenticate(context.Background(), tt.email, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if user.Name != tt.wantName || !reflect.DeepEqual(user.Roles, tt.wantRoles) {
+				t.Errorf("Authenticate() = %+v, want name %q roles %v", user, tt.wantName, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	url := "ldap://" + listener.Addr().String()
+	listener.Close()
+
+	d := newTestLDAP(t, url)
+	_, err = d.Authenticate(context.Background(), "alice@corp.local", "alice pass")
+	if err == nil || errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("Authenticate() error = %v, want connection error", err)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"o+brien", `o\+brien`},
+		{`a,b=c"d\e<f>g;h`, `a\,b\=c\"d\\e\<f\>g\;h`},
+		{" #lead", `\ #lead`},
+		{"#hash", `\#hash`},
+		{"trail ", `trail\ `},
+		{"nul\x00", `nul\00`},
+	}
+	for _, tt := range tests {
+		if got := escapeDN(tt.value); got != tt.want {
+			t.Errorf("escapeDN(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
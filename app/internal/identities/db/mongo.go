@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/identities"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ identities.Storage = &db{}
+
+type db struct {
+	identities *mongo.Collection
+	states     *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, identityCollection, stateCollection string, logger logging.Logger) identities.Storage {
+	s := &db{
+		identities: storage.Collection(identityCollection),
+		states:     storage.Collection(stateCollection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.identities.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "account_uuid", Value: 1}, {Key: "provider", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create identity indexes. error: %v", err)
+	}
+	_, err = s.states.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create identity state indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, identity identities.Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.identities.InsertOne(ctx, identity)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (identity identities.Identity, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.identities.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return identity, apperror.ErrNotFound
+		}
+		return identity, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&identity); err != nil {
+		return identity, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return identity, nil
+}
+
+func (s *db) FindByAccount(ctx context.Context, accountUUID string) (list []identities.Identity, err error) {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := s.identities.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	list = make([]identities.Identity, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+
+	return list, nil
+}
+
+func (s *db) Delete(ctx context.Context, accountUUID, provider string) error {
+	filter := bson.M{"account_uuid": accountUUID, "provider": provider}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.identities.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+func (s *db) CreateState(ctx context.Context, state identities.State) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.states.InsertOne(ctx, state)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) TakeState(ctx context.Context, id string) (state identities.State, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.states.FindOneAndDelete(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return state, apperror.ErrNotFound
+		}
+		return state, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&state); err != nil {
+		return state, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,182 @@
+package identities
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	externalLoginURL    = "/api/login/external/:provider"
+	externalCallbackURL = "/api/login/external/:provider/callback"
+	identitiesURL       = "/api/account/:uuid/identities"
+	identityURL         = "/api/account/:uuid/identities/:provider"
+
+	stateCookie     = "eob_external_state"
+	stateCookiePath = "/api/login/external"
+)
+
+// Handler keeps state of started sign in in HttpOnly cookie. SecureCookie is false only in local development
+type Handler struct {
+	Logger          logging.Logger
+	IdentityService Service
+	Login           *accounts.Login
+	Auth            *auth.Middleware
+	SecureCookie    bool
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, externalLoginURL, apperror.Middleware(h.BeginLogin))
+	router.HandlerFunc(http.MethodGet, externalCallbackURL, apperror.Middleware(h.Auth.Optional(h.Callback)))
+	router.HandlerFunc(http.MethodGet, identitiesURL, apperror.Middleware(h.Auth.Owner(h.GetIdentities, auth.ScopeAccountRead)))
+	router.HandlerFunc(http.MethodPost, identityURL, apperror.Middleware(h.Auth.Self(h.BeginLink)))
+	router.HandlerFunc(http.MethodDelete, identityURL, apperror.Middleware(h.Auth.Fresh(h.Unlink)))
+}
+
+func (h *Handler) BeginLogin(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("BEGIN EXTERNAL LOGIN")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	provider := params.ByName("provider")
+
+	redirect, err := h.IdentityService.Begin(r.Context(), provider, "")
+	if err != nil {
+		return err
+	}
+
+	return h.writeRedirect(w, redirect)
+}
+
+//? provider redirects browser here for both login and linking. linking requires session of account
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("EXTERNAL LOGIN CALLBACK")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	provider := params.ByName("provider")
+	q := r.URL.Query()
+	dto := CallbackDTO{
+		Code:             q.Get("code"),
+		State:            q.Get("state"),
+		Error:            q.Get("error"),
+		ErrorDescription: q.Get("error_description"),
+	}
+	if cookie, err := r.Cookie(stateCookie); err == nil {
+		dto.StateCookie = cookie.Value
+	}
+	if p, ok := auth.FromContext(r.Context()); ok && p.SessionID != "" && p.ClientID == "" && !p.IsImpersonated() {
+		dto.AccountUUID = p.AccountUUID
+	}
+	http.SetCookie(w, h.stateCookie("", time.Unix(0, 0)))
+
+	result, err := h.IdentityService.Callback(r.Context(), provider, dto)
+	if err != nil {
+		return err
+	}
+	if !result.Linked {
+		return h.Login.FirstFactor(w, r, result.Account)
+	}
+
+	h.Logger.Debug("marshal identity")
+	identityBytes, err := json.Marshal(result.Identity)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(identityBytes)
+
+	return nil
+}
+
+func (h *Handler) GetIdentities(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET LINKED IDENTITIES")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	identities, err := h.IdentityService.GetIdentities(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal identities")
+	identitiesBytes, err := json.Marshal(identities)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(identitiesBytes)
+
+	return nil
+}
+
+func (h *Handler) BeginLink(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("BEGIN IDENTITY LINK")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	provider := params.ByName("provider")
+
+	redirect, err := h.IdentityService.Begin(r.Context(), provider, accountUUID)
+	if err != nil {
+		return err
+	}
+
+	return h.writeRedirect(w, redirect)
+}
+
+func (h *Handler) Unlink(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("UNLINK IDENTITY")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	provider := params.ByName("provider")
+
+	err := h.IdentityService.Unlink(r.Context(), accountUUID, provider)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) writeRedirect(w http.ResponseWriter, redirect RedirectDTO) error {
+	http.SetCookie(w, h.stateCookie(redirect.State, redirect.ExpiresAt))
+
+	h.Logger.Debug("marshal redirect")
+	redirectBytes, err := json.Marshal(redirect)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(redirectBytes)
+
+	return nil
+}
+
+//? lax cookie is sent on top level redirect back from provider
+func (h *Handler) stateCookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     stateCookie,
+		Value:    value,
+		Path:     stateCookiePath,
+		Expires:  expires,
+		Secure:   h.SecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
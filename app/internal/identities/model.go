@@ -0,0 +1,88 @@
+package identities
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+// Provider is external OpenID Connect identity provider from config
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity links subject of external provider to account
+type Identity struct {
+	ID          string `json:"-" bson:"_id"`
+	Provider    string `json:"provider" bson:"provider"`
+	Subject     string `json:"subject" bson:"subject"`
+	AccountUUID string `json:"-" bson:"account_uuid"`
+	Email       string `json:"email,omitempty" bson:"email,omitempty"`
+	LinkedAt    int64  `json:"linked_at" bson:"linked_at"`
+}
+
+// State is pending external login. AccountUUID is set when logged in user links provider
+type State struct {
+	ID          string    `bson:"_id"`
+	Provider    string    `bson:"provider"`
+	AccountUUID string    `bson:"account_uuid,omitempty"`
+	Nonce       string    `bson:"nonce"`
+	Verifier    string    `bson:"verifier"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Claims are ID token claims used to link and create accounts
+type Claims struct {
+	Subject           string `json:"sub"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	Locale            string `json:"locale"`
+}
+
+// RedirectDTO sends browser to provider. State is kept in browser cookie until ExpiresAt
+type RedirectDTO struct {
+	RedirectTo string    `json:"redirect_to"`
+	State      string    `json:"-"`
+	ExpiresAt  time.Time `json:"-"`
+}
+
+// CallbackDTO is query of redirect back from provider. StateCookie is state from cookie of browser
+// that started sign in, AccountUUID is account of session finishing callback
+type CallbackDTO struct {
+	Code             string
+	State            string
+	Error            string
+	ErrorDescription string
+	StateCookie      string
+	AccountUUID      string
+}
+
+// Result of callback. Linked is set when provider was linked to logged in account
+type Result struct {
+	Account  accounts.Account
+	Identity Identity
+	Linked   bool
+}
+
+func NewIdentity(provider, accountUUID string, claims Claims) Identity {
+	return Identity{
+		ID:          identityID(provider, claims.Subject),
+		Provider:    provider,
+		Subject:     claims.Subject,
+		AccountUUID: accountUUID,
+		Email:       claims.Email,
+		LinkedAt:    time.Now().UnixNano(),
+	}
+}
+
+func identityID(provider, subject string) string {
+	return provider + ":" + subject
+}
@@ -0,0 +1,49 @@
+package identities
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// client discovers provider on first use so unreachable provider doesn't stop worker
+type client struct {
+	mu       sync.Mutex
+	provider Provider
+	config   *oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+func (c *client) discover() (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config != nil {
+		return c.config, c.verifier, nil
+	}
+
+	//? context is kept by go-oidc to refresh provider keys later
+	ctx := gooidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	p, err := gooidc.NewProvider(ctx, c.provider.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover provider %s. error: %w", c.provider.Name, err)
+	}
+
+	scopes := c.provider.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+	}
+	c.config = &oauth2.Config{
+		ClientID:     c.provider.ClientID,
+		ClientSecret: c.provider.ClientSecret,
+		RedirectURL:  c.provider.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       scopes,
+	}
+	c.verifier = p.Verifier(&gooidc.Config{ClientID: c.provider.ClientID})
+	return c.config, c.verifier, nil
+}
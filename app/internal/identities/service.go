@@ -0,0 +1,270 @@
+package identities
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var _ Service = &service{}
+
+type service struct {
+	storage  Storage
+	accounts accounts.Service
+	clients  map[string]*client
+	stateTTL time.Duration
+	logger   logging.Logger
+}
+
+func NewService(identityStorage Storage, accountService accounts.Service, providers []Provider,
+	stateTTL time.Duration, logger logging.Logger) (Service, error) {
+	clients := make(map[string]*client, len(providers))
+	for _, p := range providers {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("identity provider requires name, issuer and client id")
+		}
+		clients[p.Name] = &client{provider: p}
+	}
+	return &service{
+		storage:  identityStorage,
+		accounts: accountService,
+		clients:  clients,
+		stateTTL: stateTTL,
+		logger:   logger,
+	}, nil
+}
+
+type Service interface {
+	Begin(ctx context.Context, provider, accountUUID string) (RedirectDTO, error)
+	Callback(ctx context.Context, provider string, dto CallbackDTO) (Result, error)
+	GetIdentities(ctx context.Context, accountUUID string) ([]Identity, error)
+	Unlink(ctx context.Context, accountUUID, provider string) error
+}
+
+//? empty account uuid starts login, otherwise provider is linked to account
+func (s service) Begin(ctx context.Context, provider, accountUUID string) (r RedirectDTO, err error) {
+	c, ok := s.clients[provider]
+	if !ok {
+		return r, apperror.ErrNotFound
+	}
+	config, _, err := c.discover()
+	if err != nil {
+		return r, err
+	}
+
+	s.logger.Debug("generate state, nonce and PKCE verifier")
+	state, err := token.New(32)
+	if err != nil {
+		return r, err
+	}
+	nonce, err := token.New(16)
+	if err != nil {
+		return r, err
+	}
+	verifier, err := token.New(32)
+	if err != nil {
+		return r, err
+	}
+
+	err = s.storage.CreateState(ctx, State{
+		ID:          token.Hash(state),
+		Provider:    provider,
+		AccountUUID: accountUUID,
+		Nonce:       nonce,
+		Verifier:    verifier,
+		ExpiresAt:   time.Now().Add(s.stateTTL),
+	})
+	if err != nil {
+		return r, fmt.Errorf("failed to create state. error: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	r.State = state
+	r.ExpiresAt = time.Now().Add(s.stateTTL)
+	r.RedirectTo = config.AuthCodeURL(state, gooidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	return r, nil
+}
+
+func (s service) Callback(ctx context.Context, provider string, dto CallbackDTO) (r Result, err error) {
+	if dto.Error != "" {
+		return r, apperror.BadRequestError(fmt.Sprintf("identity provider returned %s: %s", dto.Error, dto.ErrorDescription))
+	}
+	c, ok := s.clients[provider]
+	if !ok {
+		return r, apperror.ErrNotFound
+	}
+	//? state must come back to browser that started sign in, otherwise link sent to victim would
+	//? sign victim in or link victim's identity to account of sender
+	if dto.StateCookie == "" || subtle.ConstantTimeCompare([]byte(dto.StateCookie), []byte(dto.State)) != 1 {
+		return r, apperror.ErrExternalLogin
+	}
+
+	state, err := s.storage.TakeState(ctx, token.Hash(dto.State))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return r, apperror.ErrExternalLogin
+		}
+		return r, fmt.Errorf("failed to find state. error: %w", err)
+	}
+	if state.Provider != provider || time.Now().After(state.ExpiresAt) {
+		return r, apperror.ErrExternalLogin
+	}
+	//? provider is linked only by session of account which started linking
+	if state.AccountUUID != "" && state.AccountUUID != dto.AccountUUID {
+		return r, apperror.ErrForbidden
+	}
+
+	claims, err := s.exchange(ctx, c, state, dto.Code)
+	if err != nil {
+		return r, err
+	}
+
+	if state.AccountUUID != "" {
+		return s.link(ctx, provider, state.AccountUUID, claims)
+	}
+	return s.login(ctx, provider, claims)
+}
+
+func (s service) GetIdentities(ctx context.Context, accountUUID string) ([]Identity, error) {
+	identities, err := s.storage.FindByAccount(ctx, accountUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find identities. error: %w", err)
+	}
+	return identities, nil
+}
+
+//? account without password must keep at least one identity to be able to login
+func (s service) Unlink(ctx context.Context, accountUUID, provider string) error {
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return err
+	}
+	if account.Password == "" {
+		identities, err := s.GetIdentities(ctx, accountUUID)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return apperror.BadRequestError("set password before unlinking last identity provider")
+		}
+	}
+
+	err = s.storage.Delete(ctx, accountUUID, provider)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete identity. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) exchange(ctx context.Context, c *client, state State, code string) (claims Claims, err error) {
+	config, verifier, err := c.discover()
+	if err != nil {
+		return claims, err
+	}
+
+	s.logger.Debug("exchange authorization code")
+	ctx = gooidc.ClientContext(ctx, &http.Client{Timeout: 10 * time.Second})
+	t, err := config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", state.Verifier))
+	if err != nil {
+		s.logger.Warnf("failed to exchange code with %s. error: %v", state.Provider, err)
+		return claims, apperror.ErrExternalLogin
+	}
+	raw, ok := t.Extra("id_token").(string)
+	if !ok {
+		return claims, apperror.BadRequestError("identity provider didn't return id token")
+	}
+
+	s.logger.Debug("verify id token")
+	idToken, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		s.logger.Warnf("failed to verify id token of %s. error: %v", state.Provider, err)
+		return claims, apperror.ErrExternalLogin
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return claims, fmt.Errorf("failed to decode id token claims. error: %w", err)
+	}
+	if claims.Nonce != state.Nonce {
+		return claims, apperror.ErrExternalLogin
+	}
+	return claims, nil
+}
+
+func (s service) link(ctx context.Context, provider, accountUUID string, claims Claims) (r Result, err error) {
+	identity := NewIdentity(provider, accountUUID, claims)
+	existing, err := s.storage.FindOne(ctx, identity.ID)
+	if err == nil {
+		if existing.AccountUUID != accountUUID {
+			return r, apperror.BadRequestError("identity is linked to another account")
+		}
+		return Result{Identity: existing, Linked: true}, nil
+	}
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return r, fmt.Errorf("failed to find identity. error: %w", err)
+	}
+
+	if err = s.storage.Create(ctx, identity); err != nil {
+		if errors.Is(err, apperror.ErrAlreadyExists) {
+			return r, apperror.BadRequestError("another identity of this provider is already linked")
+		}
+		return r, fmt.Errorf("failed to create identity. error: %w", err)
+	}
+	return Result{Identity: identity, Linked: true}, nil
+}
+
+//? first login creates account. existing account with same email must link provider itself
+func (s service) login(ctx context.Context, provider string, claims Claims) (r Result, err error) {
+	identity, err := s.storage.FindOne(ctx, identityID(provider, claims.Subject))
+	if err == nil {
+		r.Identity = identity
+		r.Account, err = s.accounts.GetAccount(ctx, identity.AccountUUID)
+		if err != nil {
+			return r, err
+		}
+		return r, r.Account.CheckSignIn()
+	}
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return r, fmt.Errorf("failed to find identity. error: %w", err)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return r, apperror.BadRequestError("identity provider didn't share verified email")
+	}
+
+	s.logger.Debug("create account for external identity")
+	accountUUID, err := s.accounts.CreateExternal(ctx, accounts.ExternalAccountDTO{
+		Email:     claims.Email,
+		Username:  claims.PreferredUsername,
+		AvatarURL: claims.Picture,
+		Language:  claims.Locale,
+	})
+	if err != nil {
+		if errors.Is(err, apperror.ErrAlreadyExists) {
+			return r, apperror.BadRequestError("account with this email exists. sign in and link provider in account settings")
+		}
+		return r, err
+	}
+
+	r.Identity = NewIdentity(provider, accountUUID, claims)
+	if err = s.storage.Create(ctx, r.Identity); err != nil {
+		return r, fmt.Errorf("failed to create identity. error: %w", err)
+	}
+	r.Account, err = s.accounts.GetAccount(ctx, accountUUID)
+	return r, err
+}
@@ -0,0 +1,438 @@
+package identities
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testProvider = "mock"
+	testClientID = "eob"
+	testRedirect = "http://localhost:10005/login/external/mock/callback"
+)
+
+// grant is authorization issued by mock provider and waiting for code exchange
+type grant struct {
+	challenge string
+	nonce     string
+	claims    Claims
+}
+
+// idp is mock OpenID Connect provider with discovery, key set and PKCE token endpoint
+type idp struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	audience string
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func newIDP(t *testing.T) *idp {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	p := &idp{key: key, audience: testClientID, grants: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+//? code is single use and requires verifier of challenge sent to authorization endpoint
+func (p *idp) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	idToken, err := p.sign(g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *idp) sign(g grant) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.URL,
+		"aud":                p.audience,
+		"sub":                g.claims.Subject,
+		"nonce":              g.nonce,
+		"email":              g.claims.Email,
+		"email_verified":     g.claims.EmailVerified,
+		"preferred_username": g.claims.PreferredUsername,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	})
+	t.Header["kid"] = "test"
+	return t.SignedString(p.key)
+}
+
+//? user signs in at provider. nonce of claims overrides nonce from authorization request
+func (p *idp) authorize(t *testing.T, redirectTo string, claims Claims) CallbackDTO {
+	t.Helper()
+	u, err := url.Parse(redirectTo)
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization request %s", redirectTo)
+	}
+	nonce := q.Get("nonce")
+	if claims.Nonce != "" {
+		nonce = claims.Nonce
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := "code-" + strconv.Itoa(len(p.grants)+1)
+	p.grants[code] = grant{challenge: q.Get("code_challenge"), nonce: nonce, claims: claims}
+	return CallbackDTO{Code: code, State: q.Get("state"), StateCookie: q.Get("state")}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// memoryStorage keeps identities and states in maps
+type memoryStorage struct {
+	Storage
+	identities map[string]Identity
+	states     map[string]State
+}
+
+func (m *memoryStorage) Create(ctx context.Context, identity Identity) error {
+	if _, ok := m.identities[identity.ID]; ok {
+		return apperror.ErrAlreadyExists
+	}
+	m.identities[identity.ID] = identity
+	return nil
+}
+
+func (m *memoryStorage) FindOne(ctx context.Context, id string) (Identity, error) {
+	i, ok := m.identities[id]
+	if !ok {
+		return i, apperror.ErrNotFound
+	}
+	return i, nil
+}
+
+func (m *memoryStorage) CreateState(ctx context.Context, state State) error {
+	m.states[state.ID] = state
+	return nil
+}
+
+func (m *memoryStorage) TakeState(ctx context.Context, id string) (State, error) {
+	s, ok := m.states[id]
+	if !ok {
+		return s, apperror.ErrNotFound
+	}
+	delete(m.states, id)
+	return s, nil
+}
+
+// memoryAccounts keeps accounts by uuid. other methods are not used by tests
+type memoryAccounts struct {
+	accounts.Service
+	accounts map[string]accounts.Account
+}
+
+func (m *memoryAccounts) GetAccount(ctx context.Context, uuid string) (accounts.Account, error) {
+	a, ok := m.accounts[uuid]
+	if !ok {
+		return a, apperror.ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *memoryAccounts) CreateExternal(ctx context.Context, dto accounts.ExternalAccountDTO) (string, error) {
+	for _, a := range m.accounts {
+		if a.Email == dto.Email {
+			return "", apperror.ErrAlreadyExists
+		}
+	}
+	uuid := "external-" + strconv.Itoa(len(m.accounts)+1)
+	m.accounts[uuid] = accounts.Account{UUID: uuid, Email: dto.Email, Username: dto.Username, IsActive: true}
+	return uuid, nil
+}
+
+func newTestService(t *testing.T, issuer string) (service, *memoryStorage, *memoryAccounts) {
+	t.Helper()
+	storage := &memoryStorage{identities: make(map[string]Identity), states: make(map[string]State)}
+	accountService := &memoryAccounts{accounts: map[string]accounts.Account{
+		"player":    {UUID: "player", Email: "player@eob.local", IsActive: true},
+		"blocked":   {UUID: "blocked", Email: "blocked@eob.local"},
+		"linked":    {UUID: "linked", Email: "linked@eob.local", IsActive: true},
+		"resetting": {UUID: "resetting", Email: "resetting@eob.local", IsActive: true, PasswordReset: true},
+	}}
+	for _, uuid := range []string{"linked", "blocked", "resetting"} {
+		identity := NewIdentity(testProvider, uuid, Claims{Subject: "sub-" + uuid})
+		storage.identities[identity.ID] = identity
+	}
+
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	s, err := NewService(storage, accountService, []Provider{{
+		Name:         testProvider,
+		Issuer:       issuer,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  testRedirect,
+	}}, time.Minute, logging.Logger{Entry: logrus.NewEntry(l)})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return *s.(*service), storage, accountService
+}
+
+func wantAppError(t *testing.T, err error, code string) {
+	t.Helper()
+	var appErr *apperror.AppError
+	if !errors.As(err, &appErr) || appErr.Code != code {
+		t.Fatalf("error = %v, want %s", err, code)
+	}
+}
+
+func TestCallback(t *testing.T) {
+	badRequest := apperror.BadRequestError("").Code
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tests := []struct {
+		name        string
+		accountUUID string
+		claims      Claims
+		modify      func(p *idp, dto *CallbackDTO)
+		wantAccount string
+		wantLinked  bool
+		wantCode    string
+	}{
+		{
+			name:        "first login creates account",
+			claims:      Claims{Subject: "new", Email: "new@eob.local", EmailVerified: true, PreferredUsername: "newbie"},
+			wantAccount: "external-5",
+		},
+		{
+			name:        "linked identity logs in",
+			claims:      Claims{Subject: "sub-linked", Email: "other@eob.local", EmailVerified: true},
+			wantAccount: "linked",
+		},
+		{
+			name:     "inactive account",
+			claims:   Claims{Subject: "sub-blocked"},
+			wantCode: apperror.ErrNotActive.Code,
+		},
+		{
+			name:     "account waiting for password reset",
+			claims:   Claims{Subject: "sub-resetting"},
+			wantCode: apperror.ErrPasswordReset.Code,
+		},
+		{
+			name:     "unverified email",
+			claims:   Claims{Subject: "new", Email: "new@eob.local"},
+			wantCode: badRequest,
+		},
+		{
+			name:     "email of existing account",
+			claims:   Claims{Subject: "new", Email: "player@eob.local", EmailVerified: true},
+			wantCode: badRequest,
+		},
+		{
+			name:        "link provider to account",
+			accountUUID: "player",
+			claims:      Claims{Subject: "new"},
+			wantAccount: "player",
+			wantLinked:  true,
+		},
+		{
+			name:        "link identity of another account",
+			accountUUID: "player",
+			claims:      Claims{Subject: "sub-linked"},
+			wantCode:    badRequest,
+		},
+		{
+			name:        "link callback without session",
+			accountUUID: "player",
+			claims:      Claims{Subject: "new"},
+			modify:      func(p *idp, dto *CallbackDTO) { dto.AccountUUID = "" },
+			wantCode:    apperror.ErrForbidden.Code,
+		},
+		{
+			name:        "link callback from session of other account",
+			accountUUID: "player",
+			claims:      Claims{Subject: "new"},
+			modify:      func(p *idp, dto *CallbackDTO) { dto.AccountUUID = "linked" },
+			wantCode:    apperror.ErrForbidden.Code,
+		},
+		{
+			name:     "callback without state cookie",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { dto.StateCookie = "" },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "state cookie of other sign in",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { dto.StateCookie = "other" },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "provider error",
+			claims:   Claims{Subject: "new"},
+			modify:   func(p *idp, dto *CallbackDTO) { dto.Error = "access_denied" },
+			wantCode: badRequest,
+		},
+		{
+			name:     "unknown state",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { dto.State, dto.StateCookie = "unknown", "unknown" },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "unknown code",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { dto.Code = "unknown" },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "other nonce",
+			claims:   Claims{Subject: "sub-linked", Nonce: "other"},
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "token for other client",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { p.audience = "other" },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+		{
+			name:     "token signed with other key",
+			claims:   Claims{Subject: "sub-linked"},
+			modify:   func(p *idp, dto *CallbackDTO) { p.key = otherKey },
+			wantCode: apperror.ErrExternalLogin.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newIDP(t)
+			s, storage, _ := newTestService(t, p.URL)
+
+			redirect, err := s.Begin(context.Background(), testProvider, tt.accountUUID)
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			dto := p.authorize(t, redirect.RedirectTo, tt.claims)
+			dto.AccountUUID = tt.accountUUID
+			if tt.modify != nil {
+				tt.modify(p, &dto)
+			}
+
+			r, err := s.Callback(context.Background(), testProvider, dto)
+			if tt.wantCode != "" {
+				wantAppError(t, err, tt.wantCode)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Callback() error = %v", err)
+			}
+			if r.Linked != tt.wantLinked {
+				t.Errorf("Callback() linked = %v, want %v", r.Linked, tt.wantLinked)
+			}
+			if r.Identity.AccountUUID != tt.wantAccount {
+				t.Errorf("Callback() identity account = %q, want %q", r.Identity.AccountUUID, tt.wantAccount)
+			}
+			if !tt.wantLinked && r.Account.UUID != tt.wantAccount {
+				t.Errorf("Callback() account = %q, want %q", r.Account.UUID, tt.wantAccount)
+			}
+			if _, err = storage.FindOne(context.Background(), identityID(testProvider, tt.claims.Subject)); err != nil {
+				t.Errorf("identity is not stored. error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCallbackStateIsSingleUse(t *testing.T) {
+	p := newIDP(t)
+	s, _, _ := newTestService(t, p.URL)
+
+	redirect, err := s.Begin(context.Background(), testProvider, "")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	dto := p.authorize(t, redirect.RedirectTo, Claims{Subject: "sub-linked"})
+	if _, err = s.Callback(context.Background(), testProvider, dto); err != nil {
+		t.Fatalf("Callback() error = %v", err)
+	}
+
+	replay := p.authorize(t, redirect.RedirectTo, Claims{Subject: "sub-linked"})
+	_, err = s.Callback(context.Background(), testProvider, replay)
+	wantAppError(t, err, apperror.ErrExternalLogin.Code)
+}
@@ -0,0 +1,12 @@
+package identities
+
+import "context"
+
+type Storage interface {
+	Create(ctx context.Context, identity Identity) error
+	FindOne(ctx context.Context, id string) (Identity, error)
+	FindByAccount(ctx context.Context, accountUUID string) ([]Identity, error)
+	Delete(ctx context.Context, accountUUID, provider string) error
+	CreateState(ctx context.Context, state State) error
+	TakeState(ctx context.Context, id string) (State, error)
+}
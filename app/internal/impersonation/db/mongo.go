@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/impersonation"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ impersonation.Storage = &db{}
+
+type db struct {
+	impersonations *mongo.Collection
+	audit          *mongo.Collection
+	logger         logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, impersonations, audit string, logger logging.Logger) impersonation.Storage {
+	s := &db{
+		impersonations: storage.Collection(impersonations),
+		audit:          storage.Collection(audit),
+		logger:         logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.impersonations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create impersonation indexes. error: %v", err)
+	}
+	_, err = s.audit.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "account_uuid", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_uuid", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create impersonation audit indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, i impersonation.Impersonation) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.impersonations.InsertOne(ctx, i)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (i impersonation.Impersonation, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.impersonations.FindOne(ctx, bson.M{"_id": id})
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return i, apperror.ErrNotFound
+		}
+		return i, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&i); err != nil {
+		return i, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return i, nil
+}
+
+func (s *db) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.impersonations.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+func (s *db) CreateAuditEntry(ctx context.Context, entry impersonation.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.audit.InsertOne(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+//? newest entries first
+func (s *db) FindAuditEntries(ctx context.Context, f impersonation.AuditFilter) (entries []impersonation.AuditEntry, err error) {
+	filter := bson.M{}
+	if f.AccountUUID != "" {
+		filter["account_uuid"] = f.AccountUUID
+	}
+	if f.ActorUUID != "" {
+		filter["actor_uuid"] = f.ActorUUID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(f.Limit)
+	cursor, err := s.audit.Find(ctx, filter, opts)
+	if err != nil {
+		return entries, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	entries = make([]impersonation.AuditEntry, 0)
+	if err = cursor.All(ctx, &entries); err != nil {
+		return entries, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+	return entries, nil
+}
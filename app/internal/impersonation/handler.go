@@ -0,0 +1,111 @@
+package impersonation
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	impersonateURL   = "/api/account/:uuid/impersonation"
+	impersonationURL = "/api/impersonation"
+	auditURL         = "/api/impersonation/audit"
+)
+
+type Handler struct {
+	Logger               logging.Logger
+	ImpersonationService Service
+	Auth                 *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, impersonateURL, apperror.Middleware(h.Auth.Authenticated(h.Start)))
+	router.HandlerFunc(http.MethodDelete, impersonationURL, apperror.Middleware(h.Auth.Authenticated(h.End)))
+	router.HandlerFunc(http.MethodGet, auditURL, apperror.Middleware(h.Auth.Admin(h.GetAuditLog)))
+}
+
+func (h *Handler) Start(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("START IMPERSONATION")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	h.Logger.Debug("decode start impersonation dto")
+	var dto StartDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+	dto.IP = auth.RemoteIP(r)
+
+	principal, _ := auth.FromContext(r.Context())
+	started, err := h.ImpersonationService.Start(r.Context(), principal, accountUUID, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal impersonation")
+	startedBytes, err := json.Marshal(started)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(startedBytes)
+
+	return nil
+}
+
+func (h *Handler) End(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("END IMPERSONATION")
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, _ := auth.FromContext(r.Context())
+	err := h.ImpersonationService.End(r.Context(), principal)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET IMPERSONATION AUDIT LOG")
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	filter := AuditFilter{
+		AccountUUID: q.Get("account_uuid"),
+		ActorUUID:   q.Get("actor_uuid"),
+	}
+	if limit := q.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return apperror.BadRequestError("limit must be integer")
+		}
+	}
+
+	entries, err := h.ImpersonationService.GetAuditLog(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal audit entries")
+	entriesBytes, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(entriesBytes)
+
+	return nil
+}
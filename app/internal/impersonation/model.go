@@ -0,0 +1,76 @@
+package impersonation
+
+import "time"
+
+// audit actions
+const (
+	ActionStart   = "start"
+	ActionRequest = "request"
+	ActionEnd     = "end"
+)
+
+// Impersonation is time limited token of staff acting as account. only token hash is stored
+type Impersonation struct {
+	ID          string    `json:"-" bson:"_id"`
+	AccountUUID string    `json:"account_uuid" bson:"account_uuid"`
+	ActorUUID   string    `json:"actor_uuid" bson:"actor_uuid"`
+	Reason      string    `json:"reason" bson:"reason"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// AuditEntry is record of impersonation start, end or request made with its token
+type AuditEntry struct {
+	ID              string    `json:"id" bson:"_id,omitempty"`
+	ImpersonationID string    `json:"impersonation_id" bson:"impersonation_id"`
+	AccountUUID     string    `json:"account_uuid" bson:"account_uuid"`
+	ActorUUID       string    `json:"actor_uuid" bson:"actor_uuid"`
+	Action          string    `json:"action" bson:"action"`
+	Reason          string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Method          string    `json:"method,omitempty" bson:"method,omitempty"`
+	Path            string    `json:"path,omitempty" bson:"path,omitempty"`
+	IP              string    `json:"ip,omitempty" bson:"ip,omitempty"`
+	CreatedAt       time.Time `json:"created_at" bson:"created_at"`
+}
+
+type StartDTO struct {
+	Reason string `json:"reason"`
+	IP     string `json:"-"`
+}
+
+// StartedDTO is returned once when impersonation starts
+type StartedDTO struct {
+	Token       string    `json:"token"`
+	AccountUUID string    `json:"account_uuid"`
+	ActorUUID   string    `json:"actor_uuid"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// AuditFilter selects audit entries. empty fields match any
+type AuditFilter struct {
+	AccountUUID string
+	ActorUUID   string
+	Limit       int64
+}
+
+func NewImpersonation(id, accountUUID, actorUUID, reason string, ttl time.Duration) Impersonation {
+	tNow := time.Now()
+	return Impersonation{
+		ID:          id,
+		AccountUUID: accountUUID,
+		ActorUUID:   actorUUID,
+		Reason:      reason,
+		CreatedAt:   tNow,
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
+
+func NewAuditEntry(i Impersonation, action string) AuditEntry {
+	return AuditEntry{
+		ImpersonationID: i.ID,
+		AccountUUID:     i.AccountUUID,
+		ActorUUID:       i.ActorUUID,
+		Action:          action,
+		CreatedAt:       time.Now(),
+	}
+}
@@ -0,0 +1,201 @@
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ auth.Authenticator = &service{}
+var _ auth.ImpersonationAuditor = &service{}
+
+const maxAuditEntries = 500
+
+type service struct {
+	storage  Storage
+	accounts accounts.Service
+	ttl      time.Duration
+	logger   logging.Logger
+}
+
+func NewService(impersonationStorage Storage, accountService accounts.Service, ttl time.Duration,
+	logger logging.Logger) (Service, error) {
+	return &service{
+		storage:  impersonationStorage,
+		accounts: accountService,
+		ttl:      ttl,
+		logger:   logger,
+	}, nil
+}
+
+type Service interface {
+	Start(ctx context.Context, actor auth.Principal, accountUUID string, dto StartDTO) (StartedDTO, error)
+	End(ctx context.Context, p auth.Principal) error
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+	RecordRequest(ctx context.Context, p auth.Principal, method, path, ip string) error
+	GetAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+//? support staff and admins act as player. staff accounts can't be impersonated
+func (s service) Start(ctx context.Context, actor auth.Principal, accountUUID string, dto StartDTO) (started StartedDTO, err error) {
+	if actor.IsImpersonated() || actor.ClientID != "" || actor.Scopes != nil {
+		return started, apperror.ErrForbidden
+	}
+	if dto.Reason == "" {
+		return started, apperror.BadRequestError("reason is required")
+	}
+	if actor.AccountUUID == accountUUID {
+		return started, apperror.BadRequestError("can't impersonate own account")
+	}
+
+	s.logger.Debug("check actor role")
+	actorAccount, err := s.accounts.GetAccount(ctx, actor.AccountUUID)
+	if err != nil {
+		return started, err
+	}
+	if !canImpersonate(actorAccount) {
+		return started, apperror.ErrForbidden
+	}
+
+	s.logger.Debug("check impersonated account")
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return started, err
+	}
+	if account.IsAdmin || len(account.Roles) > 0 {
+		return started, apperror.ErrForbidden
+	}
+	if err = account.CheckStatus(); err != nil {
+		return started, err
+	}
+
+	raw, err := token.New(32)
+	if err != nil {
+		return started, err
+	}
+	i := NewImpersonation(token.Hash(raw), account.UUID, actorAccount.UUID, dto.Reason, s.ttl)
+	if err = s.storage.Create(ctx, i); err != nil {
+		return started, fmt.Errorf("failed to create impersonation. error: %w", err)
+	}
+
+	entry := NewAuditEntry(i, ActionStart)
+	entry.Reason = dto.Reason
+	entry.IP = dto.IP
+	if err = s.audit(ctx, entry); err != nil {
+		return started, err
+	}
+	s.logger.Infof("account %s impersonates account %s", i.ActorUUID, i.AccountUUID)
+
+	return StartedDTO{
+		Token:       raw,
+		AccountUUID: i.AccountUUID,
+		ActorUUID:   i.ActorUUID,
+		ExpiresAt:   i.ExpiresAt,
+	}, nil
+}
+
+//? impersonation is ended with its own token
+func (s service) End(ctx context.Context, p auth.Principal) error {
+	if !p.IsImpersonated() {
+		return apperror.BadRequestError("token is not impersonation token")
+	}
+	i, err := s.storage.FindOne(ctx, p.SessionID)
+	if err != nil {
+		return err
+	}
+	if err = s.storage.Delete(ctx, i.ID); err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete impersonation. error: %w", err)
+	}
+
+	return s.audit(ctx, NewAuditEntry(i, ActionEnd))
+}
+
+//? actor must keep impersonating role for whole impersonation
+func (s service) Authenticate(ctx context.Context, raw string) (p auth.Principal, err error) {
+	i, err := s.storage.FindOne(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, fmt.Errorf("failed to find impersonation. error: %w", err)
+	}
+	if time.Now().After(i.ExpiresAt) {
+		return p, apperror.ErrUnauthorized
+	}
+
+	actor, err := s.accounts.GetAccount(ctx, i.ActorUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, err
+	}
+	if actor.CheckStatus() != nil || !canImpersonate(actor) {
+		return p, apperror.ErrUnauthorized
+	}
+
+	account, err := s.accounts.GetAccount(ctx, i.AccountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, err
+	}
+	if err = account.CheckStatus(); err != nil {
+		return p, apperror.ErrUnauthorized
+	}
+
+	return auth.Principal{
+		AccountUUID: account.UUID,
+		SessionID:   i.ID,
+		AuthTime:    i.CreatedAt,
+		ExpiresAt:   i.ExpiresAt,
+		ActorUUID:   i.ActorUUID,
+	}, nil
+}
+
+func (s service) RecordRequest(ctx context.Context, p auth.Principal, method, path, ip string) error {
+	return s.audit(ctx, AuditEntry{
+		ImpersonationID: p.SessionID,
+		AccountUUID:     p.AccountUUID,
+		ActorUUID:       p.ActorUUID,
+		Action:          ActionRequest,
+		Method:          method,
+		Path:            path,
+		IP:              ip,
+		CreatedAt:       time.Now(),
+	})
+}
+
+func (s service) GetAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > maxAuditEntries {
+		filter.Limit = maxAuditEntries
+	}
+	entries, err := s.storage.FindAuditEntries(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find audit entries. error: %w", err)
+	}
+	return entries, nil
+}
+
+func (s service) audit(ctx context.Context, entry AuditEntry) error {
+	if err := s.storage.CreateAuditEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to create audit entry. error: %w", err)
+	}
+	return nil
+}
+
+func canImpersonate(account accounts.Account) bool {
+	return account.HasRole(accounts.RoleSupport) || account.HasRole(accounts.RoleAdmin)
+}
@@ -0,0 +1,14 @@
+package impersonation
+
+import (
+	"context"
+)
+
+type Storage interface {
+	Create(ctx context.Context, impersonation Impersonation) error
+	FindOne(ctx context.Context, id string) (Impersonation, error)
+	Delete(ctx context.Context, id string) error
+
+	CreateAuditEntry(ctx context.Context, entry AuditEntry) error
+	FindAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/invites"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ invites.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) invites.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"code_hash": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create invite indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, invite invites.Invite) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.InsertOne(ctx, invite)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	oid, ok := result.InsertedID.(primitive.ObjectID)
+	if ok {
+		return oid.Hex(), nil
+	}
+	return "", fmt.Errorf("failed to convet objectid to hex")
+}
+
+func (s *db) FindByCode(ctx context.Context, codeHash string) (invite invites.Invite, err error) {
+	filter := bson.M{"code_hash": codeHash}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return invite, apperror.ErrNotFound
+		}
+		return invite, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&invite); err != nil {
+		return invite, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return invite, nil
+}
+
+//? newest invites first
+func (s *db) FindAll(ctx context.Context) (list []invites.Invite, err error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	list = make([]invites.Invite, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+	return list, nil
+}
+
+//? use is counted only while invite has uses left
+func (s *db) Use(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert hex to objectid. error: %w", err)
+	}
+	filter := bson.M{
+		"_id":   objectID,
+		"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+	}
+	update := bson.M{"$inc": bson.M{"uses": 1}}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *db) Release(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert hex to objectid. error: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "uses": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"uses": -1}}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *db) Delete(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return apperror.ErrNotFound
+	}
+	filter := bson.M{"_id": objectID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package invites
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	invitesURL = "/api/invites"
+	inviteURL  = "/api/invites/:id"
+)
+
+type Handler struct {
+	Logger        logging.Logger
+	InviteService Service
+	Auth          *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, invitesURL, apperror.Middleware(h.Auth.Admin(h.CreateInvite)))
+	router.HandlerFunc(http.MethodGet, invitesURL, apperror.Middleware(h.Auth.Admin(h.GetInvites)))
+	router.HandlerFunc(http.MethodDelete, inviteURL, apperror.Middleware(h.Auth.Admin(h.DeleteInvite)))
+}
+
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("CREATE INVITE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode create invite dto")
+	var dto CreateInviteDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	created, err := h.InviteService.Create(r.Context(), principal.AccountUUID, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal invite")
+	createdBytes, err := json.Marshal(created)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", invitesURL+"/"+created.ID)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(createdBytes)
+
+	return nil
+}
+
+func (h *Handler) GetInvites(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET INVITES")
+	w.Header().Set("Content-Type", "application/json")
+
+	list, err := h.InviteService.GetInvites(r.Context())
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal invites")
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(listBytes)
+
+	return nil
+}
+
+func (h *Handler) DeleteInvite(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DELETE INVITE")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	id := params.ByName("id")
+
+	err := h.InviteService.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
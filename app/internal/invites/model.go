@@ -0,0 +1,39 @@
+package invites
+
+import "time"
+
+// Invite lets MaxUses accounts register while registration is invite only. invite bound to Email
+// is accepted for that email only, zero ExpiresAt never expires. only hash of code is stored
+type Invite struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	CodeHash  string    `json:"-" bson:"code_hash"`
+	Email     string    `json:"email,omitempty" bson:"email,omitempty"`
+	MaxUses   int       `json:"max_uses" bson:"max_uses"`
+	Uses      int       `json:"uses" bson:"uses"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at,omitempty"`
+}
+
+type CreateInviteDTO struct {
+	Email     string    `json:"email"`
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreatedInviteDTO is new invite with its code. code is shown only once
+type CreatedInviteDTO struct {
+	Code string `json:"code"`
+	Invite
+}
+
+func NewInvite(codeHash, createdBy string, dto CreateInviteDTO) Invite {
+	return Invite{
+		CodeHash:  codeHash,
+		Email:     dto.Email,
+		MaxUses:   dto.MaxUses,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: dto.ExpiresAt,
+	}
+}
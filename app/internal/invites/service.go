@@ -0,0 +1,145 @@
+package invites
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ accounts.Invites = &service{}
+
+// codes are 16 characters of base32 alphabet, shown in groups of four
+const codeBytes = 10
+
+var codeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type service struct {
+	storage Storage
+	logger  logging.Logger
+}
+
+func NewService(inviteStorage Storage, logger logging.Logger) (Service, error) {
+	return &service{
+		storage: inviteStorage,
+		logger:  logger,
+	}, nil
+}
+
+type Service interface {
+	Create(ctx context.Context, createdBy string, dto CreateInviteDTO) (CreatedInviteDTO, error)
+	GetInvites(ctx context.Context) ([]Invite, error)
+	Delete(ctx context.Context, id string) error
+	Redeem(ctx context.Context, code, email string) (string, error)
+	Release(ctx context.Context, id string) error
+}
+
+//? invite is single use unless max uses is given
+func (s service) Create(ctx context.Context, createdBy string, dto CreateInviteDTO) (created CreatedInviteDTO, err error) {
+	if dto.MaxUses < 0 {
+		return created, apperror.BadRequestError("max_uses must not be negative")
+	}
+	if dto.MaxUses == 0 {
+		dto.MaxUses = 1
+	}
+	if !dto.ExpiresAt.IsZero() && time.Now().After(dto.ExpiresAt) {
+		return created, apperror.BadRequestError("expires_at must be in the future")
+	}
+	dto.Email = strings.TrimSpace(dto.Email)
+
+	s.logger.Debug("generate invite code")
+	b, err := token.Bytes(codeBytes)
+	if err != nil {
+		return created, err
+	}
+	code := formatCode(codeEncoding.EncodeToString(b))
+
+	invite := NewInvite(token.Hash(normalizeCode(code)), createdBy, dto)
+	invite.ID, err = s.storage.Create(ctx, invite)
+	if err != nil {
+		return created, fmt.Errorf("failed to create invite. error: %w", err)
+	}
+	return CreatedInviteDTO{Code: code, Invite: invite}, nil
+}
+
+func (s service) GetInvites(ctx context.Context) ([]Invite, error) {
+	list, err := s.storage.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find invites. error: %w", err)
+	}
+	return list, nil
+}
+
+func (s service) Delete(ctx context.Context, id string) error {
+	err := s.storage.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete invite. error: %w", err)
+	}
+	return nil
+}
+
+//? use is counted atomically, so concurrent registrations can't exceed max uses
+func (s service) Redeem(ctx context.Context, code, email string) (string, error) {
+	invite, err := s.storage.FindByCode(ctx, token.Hash(normalizeCode(code)))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return "", apperror.ErrInviteInvalid
+		}
+		return "", fmt.Errorf("failed to find invite. error: %w", err)
+	}
+	if !invite.ExpiresAt.IsZero() && time.Now().After(invite.ExpiresAt) {
+		s.logger.Debugf("invite %s is expired", invite.ID)
+		return "", apperror.ErrInviteInvalid
+	}
+	if invite.Email != "" && !strings.EqualFold(invite.Email, strings.TrimSpace(email)) {
+		s.logger.Debugf("invite %s is bound to other email", invite.ID)
+		return "", apperror.ErrInviteInvalid
+	}
+
+	err = s.storage.Use(ctx, invite.ID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			s.logger.Debugf("invite %s is used up", invite.ID)
+			return "", apperror.ErrInviteInvalid
+		}
+		return "", fmt.Errorf("failed to use invite. error: %w", err)
+	}
+	return invite.ID, nil
+}
+
+//? use of redeemed invite is given back when account was not created after all
+func (s service) Release(ctx context.Context, id string) error {
+	if err := s.storage.Release(ctx, id); err != nil {
+		return fmt.Errorf("failed to release invite. error: %w", err)
+	}
+	return nil
+}
+
+func formatCode(code string) string {
+	groups := make([]string, 0, len(code)/4)
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
+
+//? codes are typed by players, so case, dashes and spaces don't matter
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,12 @@
+package invites
+
+import "context"
+
+type Storage interface {
+	Create(ctx context.Context, invite Invite) (string, error)
+	FindByCode(ctx context.Context, codeHash string) (Invite, error)
+	FindAll(ctx context.Context) ([]Invite, error)
+	Use(ctx context.Context, id string) error
+	Release(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/logins"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ logins.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) logins.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "account_uuid", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create login history indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, entry logins.Entry) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+//? newest entries first
+func (s *db) Find(ctx context.Context, f logins.Filter) (entries []logins.Entry, total int64, err error) {
+	filter := bson.M{"account_uuid": f.AccountUUID}
+	if f.Outcome != "" {
+		filter["outcome"] = f.Outcome
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	total, err = s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return entries, total, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetSkip(f.Offset).SetLimit(f.Limit)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return entries, total, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	entries = make([]logins.Entry, 0)
+	if err = cursor.All(ctx, &entries); err != nil {
+		return entries, total, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+	return entries, total, nil
+}
+
+//? empty device and country match any
+func (s *db) HasSuccess(ctx context.Context, accountUUID, device, country string) (bool, error) {
+	filter := bson.M{"account_uuid": accountUUID, "outcome": accounts.LoginSuccess}
+	if device != "" {
+		filter["device"] = device
+	}
+	if country != "" {
+		filter["country"] = country
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	count, err := s.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *db) CountFailures(ctx context.Context, ip string, since time.Time) (int64, error) {
+	filter := bson.M{
+		"ip":         ip,
+		"outcome":    accounts.LoginFailure,
+		"created_at": bson.M{"$gte": since},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	count, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,65 @@
+package logins
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	historyURL = "/api/account/:uuid/logins"
+)
+
+type Handler struct {
+	Logger         logging.Logger
+	HistoryService Service
+	Auth           *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, historyURL, apperror.Middleware(h.Auth.Owner(h.GetHistory, auth.ScopeAccountRead)))
+}
+
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET LOGIN HISTORY")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	q := r.URL.Query()
+	filter := Filter{
+		AccountUUID: params.ByName("uuid"),
+		Outcome:     q.Get("outcome"),
+	}
+	var err error
+	if offset := q.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+			return apperror.BadRequestError("offset must be integer")
+		}
+	}
+	if limit := q.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return apperror.BadRequestError("limit must be integer")
+		}
+	}
+
+	page, err := h.HistoryService.GetHistory(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal login history")
+	pageBytes, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(pageBytes)
+
+	return nil
+}
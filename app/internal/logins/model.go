@@ -0,0 +1,52 @@
+package logins
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+// Entry is recorded login attempt. entries are removed after retention period.
+// Device is name of device, Country is known when locator is configured
+type Entry struct {
+	ID          string    `json:"-" bson:"_id,omitempty"`
+	AccountUUID string    `json:"-" bson:"account_uuid,omitempty"`
+	Email       string    `json:"-" bson:"email"`
+	Outcome     string    `json:"outcome" bson:"outcome"`
+	Reason      string    `json:"reason" bson:"reason"`
+	Device      string    `json:"device" bson:"device"`
+	IP          string    `json:"ip" bson:"ip,omitempty"`
+	Country     string    `json:"country,omitempty" bson:"country,omitempty"`
+	UserAgent   string    `json:"user_agent" bson:"user_agent,omitempty"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time `json:"-" bson:"expires_at"`
+}
+
+// Filter selects entries of account. empty Outcome matches any
+type Filter struct {
+	AccountUUID string
+	Outcome     string
+	Offset      int64
+	Limit       int64
+}
+
+// Page is part of login history, newest entries first
+type Page struct {
+	Total   int64   `json:"total"`
+	Entries []Entry `json:"entries"`
+}
+
+func NewEntry(attempt accounts.LoginAttempt, retention time.Duration) Entry {
+	tNow := time.Now()
+	return Entry{
+		AccountUUID: attempt.AccountUUID,
+		Email:       attempt.Email,
+		Outcome:     attempt.Outcome,
+		Reason:      attempt.Reason,
+		Device:      attempt.Device.DisplayName(),
+		IP:          attempt.Device.IP,
+		UserAgent:   attempt.Device.UserAgent,
+		CreatedAt:   tNow,
+		ExpiresAt:   tNow.Add(retention),
+	}
+}
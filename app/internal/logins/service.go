@@ -0,0 +1,134 @@
+package logins
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+var _ Service = &service{}
+var _ accounts.LoginHistory = &service{}
+
+// Locator resolves country of client address. empty string when it is unknown
+type Locator interface {
+	Country(ip string) string
+}
+
+// Notifier tells account owner about login from device or country not seen before
+type Notifier interface {
+	NotifyLogin(ctx context.Context, email string, entry Entry) error
+}
+
+// page size when limit is not set
+const defaultLimit = 20
+
+type service struct {
+	storage    Storage
+	locator    Locator
+	notifier   Notifier
+	retention  time.Duration
+	maxResults int64
+	logger     logging.Logger
+}
+
+//? locator and notifier are optional
+func NewService(historyStorage Storage, locator Locator, notifier Notifier, retention time.Duration, maxResults int64,
+	logger logging.Logger) (Service, error) {
+	return &service{
+		storage:    historyStorage,
+		locator:    locator,
+		notifier:   notifier,
+		retention:  retention,
+		maxResults: maxResults,
+		logger:     logger,
+	}, nil
+}
+
+type Service interface {
+	Record(ctx context.Context, attempt accounts.LoginAttempt) error
+	GetHistory(ctx context.Context, filter Filter) (Page, error)
+	CountFailures(ctx context.Context, ip string, since time.Time) (int64, error)
+}
+
+//? successful login is compared with history before it is recorded
+func (s service) Record(ctx context.Context, attempt accounts.LoginAttempt) error {
+	s.logger.Debugf("record login %s. reason: %s", attempt.Outcome, attempt.Reason)
+	entry := NewEntry(attempt, s.retention)
+	if s.locator != nil && entry.IP != "" {
+		entry.Country = s.locator.Country(entry.IP)
+	}
+	if s.notifier != nil && attempt.Alerts && attempt.Outcome == accounts.LoginSuccess {
+		s.checkNewDevice(ctx, attempt.Email, entry)
+	}
+
+	if err := s.storage.Create(ctx, entry); err != nil {
+		return fmt.Errorf("failed to create login history entry. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) GetHistory(ctx context.Context, filter Filter) (page Page, err error) {
+	switch filter.Outcome {
+	case "", accounts.LoginSuccess, accounts.LoginFailure:
+	default:
+		return page, apperror.BadRequestError("outcome must be success or failure")
+	}
+	if filter.Offset < 0 {
+		return page, apperror.BadRequestError("offset must not be negative")
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > s.maxResults {
+		filter.Limit = s.maxResults
+	}
+
+	page.Entries, page.Total, err = s.storage.Find(ctx, filter)
+	if err != nil {
+		return page, fmt.Errorf("failed to find login history. error: %w", err)
+	}
+	return page, nil
+}
+
+//? failed attempts from address for any account
+func (s service) CountFailures(ctx context.Context, ip string, since time.Time) (int64, error) {
+	count, err := s.storage.CountFailures(ctx, ip, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count failed logins. error: %w", err)
+	}
+	return count, nil
+}
+
+//? first login is not reported, there is nothing to compare it with.
+// devices are remembered for retention period of history
+func (s service) checkNewDevice(ctx context.Context, email string, entry Entry) {
+	known, err := s.storage.HasSuccess(ctx, entry.AccountUUID, "", "")
+	if err != nil || !known {
+		return
+	}
+	knownDevice, err := s.storage.HasSuccess(ctx, entry.AccountUUID, entry.Device, "")
+	if err != nil {
+		s.logger.Errorf("failed to check login device. error: %v", err)
+		return
+	}
+	knownCountry := true
+	if entry.Country != "" {
+		knownCountry, err = s.storage.HasSuccess(ctx, entry.AccountUUID, "", entry.Country)
+		if err != nil {
+			s.logger.Errorf("failed to check login country. error: %v", err)
+			return
+		}
+	}
+	if knownDevice && knownCountry {
+		return
+	}
+
+	s.logger.Debug("login from new device or country")
+	if err = s.notifier.NotifyLogin(ctx, email, entry); err != nil {
+		s.logger.Errorf("failed to notify about login. error: %v", err)
+	}
+}
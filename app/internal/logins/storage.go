@@ -0,0 +1,13 @@
+package logins
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	Create(ctx context.Context, entry Entry) error
+	Find(ctx context.Context, filter Filter) ([]Entry, int64, error)
+	HasSuccess(ctx context.Context, accountUUID, device, country string) (bool, error)
+	CountFailures(ctx context.Context, ip string, since time.Time) (int64, error)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/magiclink"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ magiclink.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) magiclink.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+//? expired links are removed by mongo TTL monitor
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "account_uuid", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create magic link indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, link magiclink.Link) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, link)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) Take(ctx context.Context, id string) (l magiclink.Link, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOneAndDelete(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return l, apperror.ErrNotFound
+		}
+		return l, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&l); err != nil {
+		return l, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return l, nil
+}
+
+func (s *db) FindLatest(ctx context.Context, accountUUID string) (l magiclink.Link, err error) {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"created_at": -1}))
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return l, apperror.ErrNotFound
+		}
+		return l, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&l); err != nil {
+		return l, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return l, nil
+}
+
+func (s *db) DeleteByAccount(ctx context.Context, accountUUID string) error {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
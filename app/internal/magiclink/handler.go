@@ -0,0 +1,77 @@
+package magiclink
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/ratelimit"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	requestURL = "/api/login/magic"
+	redeemURL  = "/api/login/magic/redeem"
+)
+
+// Handler limits link requests per client address with RequestLimiter
+type Handler struct {
+	Logger           logging.Logger
+	MagicLinkService Service
+	Login            *accounts.Login
+	RequestLimiter   *ratelimit.Limiter
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, requestURL, apperror.Middleware(h.RequestLink))
+	router.HandlerFunc(http.MethodPost, redeemURL, apperror.Middleware(h.RedeemLink))
+}
+
+func (h *Handler) RequestLink(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REQUEST MAGIC LINK")
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.RequestLimiter.Allow(auth.RemoteIP(r)) {
+		return apperror.ErrRateLimited
+	}
+
+	h.Logger.Debug("decode request link dto")
+	var dto RequestLinkDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+	if dto.Email == "" {
+		return apperror.BadRequestError("email is required")
+	}
+
+	err := h.MagicLinkService.Request(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *Handler) RedeemLink(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REDEEM MAGIC LINK")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode redeem link dto")
+	var dto RedeemLinkDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	account, err := h.MagicLinkService.Redeem(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+
+	return h.Login.FirstFactor(w, r, account)
+}
@@ -0,0 +1,28 @@
+package magiclink
+
+import "time"
+
+type Link struct {
+	ID          string    `bson:"_id"`
+	AccountUUID string    `bson:"account_uuid"`
+	CreatedAt   int64     `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type RequestLinkDTO struct {
+	Email string `json:"email"`
+}
+
+type RedeemLinkDTO struct {
+	Token string `json:"token"`
+}
+
+func NewLink(id, accountUUID string, ttl time.Duration) Link {
+	tNow := time.Now()
+	return Link{
+		ID:          id,
+		AccountUUID: accountUUID,
+		CreatedAt:   tNow.UnixNano(),
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
@@ -0,0 +1,129 @@
+package magiclink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/mail"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+
+type service struct {
+	storage        Storage
+	accounts       accounts.Service
+	sender         mail.Sender
+	linkURL        string
+	ttl            time.Duration
+	resendInterval time.Duration
+	logger         logging.Logger
+}
+
+func NewService(linkStorage Storage, accountService accounts.Service, sender mail.Sender,
+	linkURL string, ttl, resendInterval time.Duration, logger logging.Logger) (Service, error) {
+	if _, err := url.Parse(linkURL); err != nil {
+		return nil, fmt.Errorf("failed to parse magic link url. error: %w", err)
+	}
+	return &service{
+		storage:        linkStorage,
+		accounts:       accountService,
+		sender:         sender,
+		linkURL:        linkURL,
+		ttl:            ttl,
+		resendInterval: resendInterval,
+		logger:         logger,
+	}, nil
+}
+
+type Service interface {
+	Request(ctx context.Context, dto RequestLinkDTO) error
+	Redeem(ctx context.Context, dto RedeemLinkDTO) (accounts.Account, error)
+}
+
+//? send sign in link. unknown emails and requests within resend interval are ignored so that accounts
+//? can't be enumerated. new link replaces links sent before
+func (s service) Request(ctx context.Context, dto RequestLinkDTO) error {
+	s.logger.Debug("get account by email")
+	account, err := s.accounts.GetAccountByEmail(ctx, dto.Email)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			s.logger.Debug("magic link requested for unknown email")
+			return nil
+		}
+		return err
+	}
+	if err = account.CheckSignIn(); err != nil {
+		s.logger.Debugf("magic link is not sent to account %s. error: %v", account.UUID, err)
+		return nil
+	}
+
+	latest, err := s.storage.FindLatest(ctx, account.UUID)
+	if err == nil && time.Since(time.Unix(0, latest.CreatedAt)) < s.resendInterval {
+		s.logger.Debugf("magic link was sent to account %s recently", account.UUID)
+		return nil
+	}
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return fmt.Errorf("failed to find magic link. error: %w", err)
+	}
+	if err = s.storage.DeleteByAccount(ctx, account.UUID); err != nil {
+		return fmt.Errorf("failed to delete magic links. error: %w", err)
+	}
+
+	s.logger.Debug("generate magic link token")
+	raw, err := token.New(32)
+	if err != nil {
+		return err
+	}
+	link := NewLink(token.Hash(raw), account.UUID, s.ttl)
+	if err = s.storage.Create(ctx, link); err != nil {
+		return fmt.Errorf("failed to create magic link. error: %w", err)
+	}
+
+	u, _ := url.Parse(s.linkURL)
+	q := u.Query()
+	q.Set("token", raw)
+	u.RawQuery = q.Encode()
+
+	err = s.sender.Send(ctx, mail.Message{
+		To:      account.Email,
+		Subject: "Your sign in link",
+		Body: fmt.Sprintf("Use the link below to sign in. It expires in %s and can be used once.\n\n%s\n\n"+
+			"If you did not request it, you can ignore this message.\n", s.ttl, u.String()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send magic link. error: %w", err)
+	}
+
+	return nil
+}
+
+//? link is removed on first use, then account is checked like password login does
+func (s service) Redeem(ctx context.Context, dto RedeemLinkDTO) (account accounts.Account, err error) {
+	link, err := s.storage.Take(ctx, token.Hash(dto.Token))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return account, apperror.ErrLinkInvalid
+		}
+		return account, fmt.Errorf("failed to find magic link. error: %w", err)
+	}
+	if time.Now().After(link.ExpiresAt) {
+		return account, apperror.ErrLinkInvalid
+	}
+
+	account, err = s.accounts.GetAccount(ctx, link.AccountUUID)
+	if err != nil {
+		return account, err
+	}
+	if err = account.CheckSignIn(); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
@@ -0,0 +1,12 @@
+package magiclink
+
+import (
+	"context"
+)
+
+type Storage interface {
+	Create(ctx context.Context, link Link) error
+	Take(ctx context.Context, id string) (Link, error)
+	FindLatest(ctx context.Context, accountUUID string) (Link, error)
+	DeleteByAccount(ctx context.Context, accountUUID string) error
+}
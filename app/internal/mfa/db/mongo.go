@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/mfa"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ mfa.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) mfa.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+//? expired tickets are removed by mongo TTL monitor
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create login ticket indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, ticket mfa.Ticket) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, ticket)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (t mfa.Ticket, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return t, apperror.ErrNotFound
+		}
+		return t, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&t); err != nil {
+		return t, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *db) Delete(ctx context.Context, id string) error {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package mfa
+
+import "time"
+
+// second factors which can be enabled on account
+const (
+	FactorWebAuthn = "webauthn"
+	FactorEmail    = "email"
+)
+
+// Ticket is issued after first factor and redeemed by one of second factors
+type Ticket struct {
+	ID          string    `json:"-" bson:"_id"`
+	AccountUUID string    `json:"-" bson:"account_uuid"`
+	Factors     []string  `json:"factors" bson:"factors"`
+	CreatedAt   int64     `json:"-" bson:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// ChallengeDTO is returned by login when second factor is required
+type ChallengeDTO struct {
+	Ticket    string    `json:"ticket"`
+	Factors   []string  `json:"factors"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewTicket(id, accountUUID string, factors []string, ttl time.Duration) Ticket {
+	tNow := time.Now()
+	return Ticket{
+		ID:          id,
+		AccountUUID: accountUUID,
+		Factors:     factors,
+		CreatedAt:   tNow.UnixNano(),
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
+
+func (t *Ticket) Allows(factor string) bool {
+	for _, f := range t.Factors {
+		if f == factor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+
+type service struct {
+	storage Storage
+	logger  logging.Logger
+	ttl     time.Duration
+}
+
+func NewService(ticketStorage Storage, ttl time.Duration, logger logging.Logger) (Service, error) {
+	return &service{
+		storage: ticketStorage,
+		logger:  logger,
+		ttl:     ttl,
+	}, nil
+}
+
+type Service interface {
+	Issue(ctx context.Context, accountUUID string, factors []string) (ChallengeDTO, error)
+	Peek(ctx context.Context, ticket string) (Ticket, error)
+	Redeem(ctx context.Context, ticket, factor string) (string, error)
+}
+
+//? issue ticket after successful first factor
+func (s service) Issue(ctx context.Context, accountUUID string, factors []string) (dto ChallengeDTO, err error) {
+	s.logger.Debug("generate login ticket")
+	raw, err := token.New(32)
+	if err != nil {
+		return dto, err
+	}
+
+	ticket := NewTicket(token.Hash(raw), accountUUID, factors, s.ttl)
+	if err = s.storage.Create(ctx, ticket); err != nil {
+		return dto, fmt.Errorf("failed to create login ticket. error: %w", err)
+	}
+
+	return ChallengeDTO{
+		Ticket:    raw,
+		Factors:   ticket.Factors,
+		ExpiresAt: ticket.ExpiresAt,
+	}, nil
+}
+
+//? get ticket without consuming it
+func (s service) Peek(ctx context.Context, raw string) (t Ticket, err error) {
+	t, err = s.storage.FindOne(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return t, apperror.ErrTicketInvalid
+		}
+		return t, fmt.Errorf("failed to find login ticket. error: %w", err)
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return t, apperror.ErrTicketInvalid
+	}
+	return t, nil
+}
+
+//? consume ticket with completed second factor
+func (s service) Redeem(ctx context.Context, raw, factor string) (string, error) {
+	t, err := s.Peek(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if !t.Allows(factor) {
+		return "", apperror.ErrTicketInvalid
+	}
+
+	s.logger.Debug("delete redeemed login ticket")
+	err = s.storage.Delete(ctx, t.ID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return "", apperror.ErrTicketInvalid
+		}
+		return "", fmt.Errorf("failed to delete login ticket. error: %w", err)
+	}
+
+	return t.AccountUUID, nil
+}
@@ -0,0 +1,11 @@
+package mfa
+
+import (
+	"context"
+)
+
+type Storage interface {
+	Create(ctx context.Context, ticket Ticket) error
+	FindOne(ctx context.Context, id string) (Ticket, error)
+	Delete(ctx context.Context, id string) error
+}
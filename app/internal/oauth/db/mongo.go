@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/oauth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ oauth.Storage = &db{}
+
+type db struct {
+	clients  *mongo.Collection
+	codes    *mongo.Collection
+	devices  *mongo.Collection
+	tokens   *mongo.Collection
+	consents *mongo.Collection
+	logger   logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, clients, codes, devices, tokens, consents string, logger logging.Logger) oauth.Storage {
+	s := &db{
+		clients:  storage.Collection(clients),
+		codes:    storage.Collection(codes),
+		devices:  storage.Collection(devices),
+		tokens:   storage.Collection(tokens),
+		consents: storage.Collection(consents),
+		logger:   logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ttl := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)}
+
+	if _, err := s.codes.Indexes().CreateOne(ctx, ttl); err != nil {
+		s.logger.Errorf("failed to create authorization code indexes. error: %v", err)
+	}
+	_, err := s.devices.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		ttl,
+		{Keys: bson.M{"user_code": 1}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create device code indexes. error: %v", err)
+	}
+	_, err = s.tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		ttl,
+		{Keys: bson.D{{Key: "account_uuid", Value: 1}, {Key: "client_id", Value: 1}}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create token indexes. error: %v", err)
+	}
+	if _, err = s.consents.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"account_uuid": 1}}); err != nil {
+		s.logger.Errorf("failed to create consent indexes. error: %v", err)
+	}
+}
+
+func (s *db) CreateClient(ctx context.Context, client oauth.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.clients.InsertOne(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindClient(ctx context.Context, id string) (c oauth.Client, err error) {
+	err = s.findOne(ctx, s.clients, bson.M{"_id": id}, &c)
+	return c, err
+}
+
+func (s *db) FindClients(ctx context.Context) (c []oauth.Client, err error) {
+	c = make([]oauth.Client, 0)
+	err = s.find(ctx, s.clients, bson.M{}, &c)
+	return c, err
+}
+
+func (s *db) DeleteClient(ctx context.Context, id string) error {
+	return s.deleteOne(ctx, s.clients, bson.M{"_id": id})
+}
+
+func (s *db) CreateCode(ctx context.Context, code oauth.AuthorizationCode) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.codes.InsertOne(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) TakeCode(ctx context.Context, id string) (c oauth.AuthorizationCode, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.codes.FindOneAndDelete(ctx, bson.M{"_id": id})
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c, apperror.ErrNotFound
+		}
+		return c, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&c); err != nil {
+		return c, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return c, nil
+}
+
+func (s *db) CreateDeviceCode(ctx context.Context, code oauth.DeviceCode) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.devices.InsertOne(ctx, code)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindDeviceCode(ctx context.Context, userCode string) (c oauth.DeviceCode, err error) {
+	err = s.findOne(ctx, s.devices, bson.M{"user_code": userCode}, &c)
+	return c, err
+}
+
+//? records poll time and returns device code as it was before, so previous poll time is known
+func (s *db) PollDeviceCode(ctx context.Context, id string, polledAt time.Time) (c oauth.DeviceCode, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.devices.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_polled_at": polledAt}})
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c, apperror.ErrNotFound
+		}
+		return c, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&c); err != nil {
+		return c, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return c, nil
+}
+
+func (s *db) SetDeviceCodeInterval(ctx context.Context, id string, interval time.Duration) error {
+	return s.updateOne(ctx, s.devices, bson.M{"_id": id}, bson.M{"$set": bson.M{"interval": interval}})
+}
+
+//? only pending device code can be decided
+func (s *db) DecideDeviceCode(ctx context.Context, id, status, accountUUID string, authTime time.Time) error {
+	return s.updateOne(ctx, s.devices, bson.M{"_id": id, "status": oauth.DevicePending}, bson.M{"$set": bson.M{
+		"status":       status,
+		"account_uuid": accountUUID,
+		"auth_time":    authTime,
+	}})
+}
+
+func (s *db) TakeDeviceCode(ctx context.Context, id string) (c oauth.DeviceCode, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.devices.FindOneAndDelete(ctx, bson.M{"_id": id})
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c, apperror.ErrNotFound
+		}
+		return c, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&c); err != nil {
+		return c, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return c, nil
+}
+
+func (s *db) CreateToken(ctx context.Context, token oauth.Token) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.tokens.InsertOne(ctx, token)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindToken(ctx context.Context, id string) (t oauth.Token, err error) {
+	err = s.findOne(ctx, s.tokens, bson.M{"_id": id}, &t)
+	return t, err
+}
+
+func (s *db) DeleteToken(ctx context.Context, id string) error {
+	return s.deleteOne(ctx, s.tokens, bson.M{"_id": id})
+}
+
+//? empty account uuid removes tokens of every account
+func (s *db) DeleteTokens(ctx context.Context, accountUUID, clientID string) error {
+	filter := bson.M{"client_id": clientID}
+	if accountUUID != "" {
+		filter["account_uuid"] = accountUUID
+	}
+	return s.deleteMany(ctx, s.tokens, filter)
+}
+
+func (s *db) DeleteAccountTokens(ctx context.Context, accountUUID string) error {
+	return s.deleteMany(ctx, s.tokens, bson.M{"account_uuid": accountUUID})
+}
+
+func (s *db) SaveConsent(ctx context.Context, consent oauth.Consent) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.consents.ReplaceOne(ctx, bson.M{"_id": consent.ID}, consent, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindConsent(ctx context.Context, accountUUID, clientID string) (c oauth.Consent, err error) {
+	err = s.findOne(ctx, s.consents, bson.M{"account_uuid": accountUUID, "client_id": clientID}, &c)
+	return c, err
+}
+
+func (s *db) FindConsents(ctx context.Context, accountUUID string) (c []oauth.Consent, err error) {
+	c = make([]oauth.Consent, 0)
+	err = s.find(ctx, s.consents, bson.M{"account_uuid": accountUUID}, &c)
+	return c, err
+}
+
+func (s *db) DeleteConsent(ctx context.Context, accountUUID, clientID string) error {
+	return s.deleteOne(ctx, s.consents, bson.M{"account_uuid": accountUUID, "client_id": clientID})
+}
+
+func (s *db) DeleteConsents(ctx context.Context, accountUUID string) error {
+	return s.deleteMany(ctx, s.consents, bson.M{"account_uuid": accountUUID})
+}
+
+func (s *db) findOne(ctx context.Context, collection *mongo.Collection, filter bson.M, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := collection.FindOne(ctx, filter)
+	err := result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return apperror.ErrNotFound
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) find(ctx context.Context, collection *mongo.Collection, filter bson.M, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = cursor.All(ctx, v); err != nil {
+		return fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) updateOne(ctx context.Context, collection *mongo.Collection, filter, update bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Matched %v documents and updated %v documents.\n", result.MatchedCount, result.ModifiedCount)
+
+	return nil
+}
+
+func (s *db) deleteOne(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+func (s *db) deleteMany(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error is RFC 6749 error response. it is written by token endpoint instead of AppError
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func (e *Error) status() int {
+	if e.Code == "invalid_client" {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+func (e *Error) Marshal() []byte {
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return bytes
+}
+
+func invalidRequest(description string) *Error {
+	return &Error{Code: "invalid_request", Description: description}
+}
+
+func invalidClient(description string) *Error {
+	return &Error{Code: "invalid_client", Description: description}
+}
+
+func invalidGrant(description string) *Error {
+	return &Error{Code: "invalid_grant", Description: description}
+}
+
+func invalidScope(description string) *Error {
+	return &Error{Code: "invalid_scope", Description: description}
+}
+
+func unauthorizedClient(description string) *Error {
+	return &Error{Code: "unauthorized_client", Description: description}
+}
+
+func unsupportedGrantType(description string) *Error {
+	return &Error{Code: "unsupported_grant_type", Description: description}
+}
+
+func authorizationPending(description string) *Error {
+	return &Error{Code: "authorization_pending", Description: description}
+}
+
+func slowDown(description string) *Error {
+	return &Error{Code: "slow_down", Description: description}
+}
+
+func accessDenied(description string) *Error {
+	return &Error{Code: "access_denied", Description: description}
+}
+
+func expiredToken(description string) *Error {
+	return &Error{Code: "expired_token", Description: description}
+}
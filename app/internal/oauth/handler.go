@@ -0,0 +1,471 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/internal/revocation"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	clientsURL    = "/api/oauth/clients"
+	clientURL     = "/api/oauth/clients/:client_id"
+	consentsURL   = "/api/account/:uuid/consents"
+	consentURL    = "/api/account/:uuid/consents/:client_id"
+	authorizeURL  = "/oauth/authorize"
+	tokenURL      = "/oauth/token"
+	introspectURL = "/oauth/introspect"
+	revokeURL     = "/oauth/revoke"
+	deviceAuthURL = "/oauth/device_authorization"
+	deviceURL     = "/oauth/device"
+)
+
+type Handler struct {
+	Logger       logging.Logger
+	OAuthService Service
+	Revocations  revocation.Service
+	Auth         *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, clientsURL, apperror.Middleware(h.Auth.Admin(h.CreateClient)))
+	router.HandlerFunc(http.MethodGet, clientsURL, apperror.Middleware(h.Auth.Admin(h.GetClients)))
+	router.HandlerFunc(http.MethodDelete, clientURL, apperror.Middleware(h.Auth.Admin(h.DeleteClient)))
+	router.HandlerFunc(http.MethodGet, authorizeURL, apperror.Middleware(h.Auth.FirstParty(h.Authorize)))
+	router.HandlerFunc(http.MethodPost, authorizeURL, apperror.Middleware(h.Auth.FirstParty(h.Approve)))
+	router.HandlerFunc(http.MethodPost, tokenURL, apperror.Middleware(h.Token))
+	router.HandlerFunc(http.MethodPost, deviceAuthURL, apperror.Middleware(h.AuthorizeDevice))
+	router.HandlerFunc(http.MethodGet, deviceURL, apperror.Middleware(h.Auth.FirstParty(h.GetDeviceConsent)))
+	router.HandlerFunc(http.MethodPost, deviceURL, apperror.Middleware(h.Auth.FirstParty(h.ApproveDevice)))
+	router.HandlerFunc(http.MethodPost, introspectURL, apperror.Middleware(h.Introspect))
+	router.HandlerFunc(http.MethodPost, revokeURL, apperror.Middleware(h.Revoke))
+	router.HandlerFunc(http.MethodGet, consentsURL, apperror.Middleware(h.Auth.Owner(h.GetConsents)))
+	router.HandlerFunc(http.MethodDelete, consentURL, apperror.Middleware(h.Auth.Owner(h.RevokeConsent)))
+}
+
+func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("CREATE OAUTH CLIENT")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode create client dto")
+	var dto CreateClientDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	creds, err := h.OAuthService.CreateClient(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal client credentials")
+	credsBytes, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(credsBytes)
+
+	return nil
+}
+
+func (h *Handler) GetClients(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET OAUTH CLIENTS")
+	w.Header().Set("Content-Type", "application/json")
+
+	clients, err := h.OAuthService.GetClients(r.Context())
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal clients")
+	clientsBytes, err := json.Marshal(clients)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(clientsBytes)
+
+	return nil
+}
+
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DELETE OAUTH CLIENT")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	clientID := params.ByName("client_id")
+
+	err := h.OAuthService.DeleteClient(r.Context(), clientID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH AUTHORIZE")
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	dto := AuthorizeDTO{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Prompt:              q.Get("prompt"),
+		Nonce:               q.Get("nonce"),
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	consent, err := h.OAuthService.Authorize(r.Context(), principal, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal consent")
+	consentBytes, err := json.Marshal(consent)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(consentBytes)
+
+	return nil
+}
+
+func (h *Handler) Approve(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH APPROVE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode authorize dto")
+	var dto AuthorizeDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	consent, err := h.OAuthService.Approve(r.Context(), principal, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal consent")
+	consentBytes, err := json.Marshal(consent)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(consentBytes)
+
+	return nil
+}
+
+//? token endpoint answers with RFC 6749 errors instead of AppError
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH TOKEN")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	resp, err := h.token(r)
+	if err != nil {
+		return writeError(w, err)
+	}
+
+	h.Logger.Debug("marshal token response")
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+
+	return nil
+}
+
+func (h *Handler) token(r *http.Request) (resp TokenResponseDTO, err error) {
+	if err = r.ParseForm(); err != nil {
+		return resp, invalidRequest("failed to parse form")
+	}
+	form := r.PostForm
+	dto := TokenRequestDTO{
+		GrantType:    form.Get("grant_type"),
+		Code:         form.Get("code"),
+		RedirectURI:  form.Get("redirect_uri"),
+		CodeVerifier: form.Get("code_verifier"),
+		RefreshToken: form.Get("refresh_token"),
+		DeviceCode:   form.Get("device_code"),
+		Scope:        form.Get("scope"),
+	}
+	dto.ClientID, dto.ClientSecret, err = clientCredentials(r)
+	if err != nil {
+		return resp, err
+	}
+	if dto.GrantType == "" || dto.ClientID == "" {
+		return resp, invalidRequest("grant_type and client_id are required")
+	}
+
+	return h.OAuthService.Token(r.Context(), dto)
+}
+
+//? RFC 8628 3.1. answers with RFC 6749 errors like token endpoint
+func (h *Handler) AuthorizeDevice(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH DEVICE AUTHORIZATION")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, err := h.authorizeDevice(r)
+	if err != nil {
+		return writeError(w, err)
+	}
+
+	h.Logger.Debug("marshal device authorization response")
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+
+	return nil
+}
+
+func (h *Handler) authorizeDevice(r *http.Request) (resp DeviceAuthorizationDTO, err error) {
+	if err = r.ParseForm(); err != nil {
+		return resp, invalidRequest("failed to parse form")
+	}
+	dto := DeviceRequestDTO{Scope: r.PostForm.Get("scope")}
+	dto.ClientID, dto.ClientSecret, err = clientCredentials(r)
+	if err != nil {
+		return resp, err
+	}
+	if dto.ClientID == "" {
+		return resp, invalidRequest("client_id is required")
+	}
+
+	return h.OAuthService.AuthorizeDevice(r.Context(), dto)
+}
+
+func (h *Handler) GetDeviceConsent(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH GET DEVICE CONSENT")
+	w.Header().Set("Content-Type", "application/json")
+
+	consent, err := h.OAuthService.GetDeviceConsent(r.Context(), r.URL.Query().Get("user_code"))
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal consent")
+	consentBytes, err := json.Marshal(consent)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(consentBytes)
+
+	return nil
+}
+
+func (h *Handler) ApproveDevice(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH APPROVE DEVICE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode device approval dto")
+	var dto DeviceApprovalDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	if err := h.OAuthService.ApproveDevice(r.Context(), principal, dto); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+//? RFC 7662. unknown, expired and revoked tokens are reported inactive
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH INTROSPECT")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, err := h.introspect(r)
+	if err != nil {
+		return writeError(w, err)
+	}
+
+	h.Logger.Debug("marshal introspection response")
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+
+	return nil
+}
+
+func (h *Handler) introspect(r *http.Request) (resp IntrospectionDTO, err error) {
+	raw, _, err := h.serviceRequest(r)
+	if err != nil {
+		return resp, err
+	}
+
+	p, err := h.Auth.Resolve(r.Context(), raw)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUnauthorized) {
+			return IntrospectionDTO{Active: false}, nil
+		}
+		return resp, err
+	}
+	return NewIntrospection(p), nil
+}
+
+//? RFC 7009. invalid tokens are answered with 200 as well
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OAUTH REVOKE")
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := h.revoke(r); err != nil {
+		return writeError(w, err)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (h *Handler) revoke(r *http.Request) error {
+	raw, client, err := h.serviceRequest(r)
+	if err != nil {
+		return err
+	}
+
+	p, err := h.Auth.Resolve(r.Context(), raw)
+	if err != nil && !errors.Is(err, apperror.ErrUnauthorized) {
+		return err
+	}
+	if err == nil {
+		h.Logger.Debug("record token revocation")
+		if err = h.Revocations.Revoke(r.Context(), raw, client.ID, p.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return h.OAuthService.RevokeToken(r.Context(), raw)
+}
+
+// serviceRequest authenticates service account and returns token from form
+func (h *Handler) serviceRequest(r *http.Request) (raw string, client Client, err error) {
+	if err = r.ParseForm(); err != nil {
+		return "", client, invalidRequest("failed to parse form")
+	}
+	id, secret, err := clientCredentials(r)
+	if err != nil {
+		return "", client, err
+	}
+	client, err = h.OAuthService.AuthenticateService(r.Context(), id, secret)
+	if err != nil {
+		return "", client, err
+	}
+
+	raw = r.PostForm.Get("token")
+	if raw == "" {
+		return "", client, invalidRequest("token is required")
+	}
+	return raw, client, nil
+}
+
+func (h *Handler) GetConsents(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET OAUTH CONSENTS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	consents, err := h.OAuthService.GetConsents(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal consents")
+	consentsBytes, err := json.Marshal(consents)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(consentsBytes)
+
+	return nil
+}
+
+func (h *Handler) RevokeConsent(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REVOKE OAUTH CONSENT")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	clientID := params.ByName("client_id")
+
+	err := h.OAuthService.RevokeConsent(r.Context(), accountUUID, clientID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+//? client_secret_basic credentials are form encoded, RFC 6749 2.3.1
+func clientCredentials(r *http.Request) (id, secret string, err error) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), nil
+	}
+	if id, err = url.QueryUnescape(id); err != nil {
+		return "", "", invalidClient("malformed client credentials")
+	}
+	if secret, err = url.QueryUnescape(secret); err != nil {
+		return "", "", invalidClient("malformed client credentials")
+	}
+	return id, secret, nil
+}
+
+// writeError writes RFC 6749 error. other errors are left to apperror.Middleware
+func writeError(w http.ResponseWriter, err error) error {
+	var oauthErr *Error
+	if errors.As(err, &oauthErr) {
+		if oauthErr.status() == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		w.WriteHeader(oauthErr.status())
+		w.Write(oauthErr.Marshal())
+		return nil
+	}
+	return err
+}
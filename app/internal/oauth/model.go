@@ -0,0 +1,282 @@
+package oauth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+)
+
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+	grantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+// device code statuses
+const (
+	DevicePending  = "pending"
+	DeviceApproved = "approved"
+	DeviceDenied   = "denied"
+)
+
+// SupportedScopes are scopes clients may request with descriptions shown on consent screen
+var SupportedScopes = map[string]string{
+	auth.ScopeAccountRead:  "Read your account profile",
+	auth.ScopeAccountWrite: "Update your account profile",
+	auth.ScopeOpenID:       "Sign you in with your eob account",
+	auth.ScopeProfile:      "See your username, avatar, language and birthdate",
+	auth.ScopeEmail:        "See your email address",
+}
+
+// ServiceScopes are scopes service accounts may be granted for internal routes
+var ServiceScopes = map[string]string{
+	auth.ScopeInternalAccountsRead:  "Read any account",
+	auth.ScopeInternalAccountsWrite: "Update any account profile",
+	auth.ScopeInternalTokens:        "Introspect and revoke tokens",
+}
+
+// Client is registered application. ServiceAccount clients act on their own behalf with client_credentials grant,
+// DeviceFlow clients like consoles may sign in with device code grant and have no redirect uris
+type Client struct {
+	ID             string   `json:"client_id" bson:"_id"`
+	SecretHash     string   `json:"-" bson:"secret_hash,omitempty"`
+	Name           string   `json:"name" bson:"name"`
+	RedirectURIs   []string `json:"redirect_uris" bson:"redirect_uris"`
+	Scopes         []string `json:"scopes" bson:"scopes"`
+	Public         bool     `json:"public" bson:"public"`
+	ServiceAccount bool     `json:"service_account" bson:"service_account,omitempty"`
+	DeviceFlow     bool     `json:"device_flow" bson:"device_flow,omitempty"`
+	CreatedAt      int64    `json:"created_at" bson:"created_at"`
+}
+
+// AuthorizationCode is single use code exchanged on token endpoint
+type AuthorizationCode struct {
+	ID                  string    `bson:"_id"`
+	ClientID            string    `bson:"client_id"`
+	AccountUUID         string    `bson:"account_uuid"`
+	RedirectURI         string    `bson:"redirect_uri"`
+	Scopes              []string  `bson:"scopes"`
+	CodeChallenge       string    `bson:"code_challenge"`
+	CodeChallengeMethod string    `bson:"code_challenge_method"`
+	Nonce               string    `bson:"nonce,omitempty"`
+	AuthTime            time.Time `bson:"auth_time"`
+	ExpiresAt           time.Time `bson:"expires_at"`
+}
+
+// DeviceCode is RFC 8628 device authorization. device and user codes are stored hashed
+type DeviceCode struct {
+	ID           string        `bson:"_id"`
+	UserCode     string        `bson:"user_code"`
+	ClientID     string        `bson:"client_id"`
+	Scopes       []string      `bson:"scopes"`
+	Status       string        `bson:"status"`
+	AccountUUID  string        `bson:"account_uuid,omitempty"`
+	AuthTime     time.Time     `bson:"auth_time"`
+	Interval     time.Duration `bson:"interval"`
+	LastPolledAt time.Time     `bson:"last_polled_at"`
+	ExpiresAt    time.Time     `bson:"expires_at"`
+}
+
+// Token is access or refresh token. only hash of token is stored
+type Token struct {
+	ID          string    `bson:"_id"`
+	Kind        string    `bson:"kind"`
+	ClientID    string    `bson:"client_id"`
+	AccountUUID string    `bson:"account_uuid"`
+	Scopes      []string  `bson:"scopes"`
+	AuthTime    time.Time `bson:"auth_time"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Consent is scopes account granted to client
+type Consent struct {
+	ID          string   `json:"-" bson:"_id"`
+	AccountUUID string   `json:"-" bson:"account_uuid"`
+	ClientID    string   `json:"client_id" bson:"client_id"`
+	ClientName  string   `json:"client_name" bson:"client_name"`
+	Scopes      []string `json:"scopes" bson:"scopes"`
+	CreatedAt   int64    `json:"created_at" bson:"created_at"`
+	UpdatedAt   int64    `json:"updated_at" bson:"updated_at"`
+}
+
+type CreateClientDTO struct {
+	Name           string   `json:"name"`
+	RedirectURIs   []string `json:"redirect_uris"`
+	Scopes         []string `json:"scopes"`
+	Public         bool     `json:"public"`
+	ServiceAccount bool     `json:"service_account"`
+	DeviceFlow     bool     `json:"device_flow"`
+}
+
+// ClientCredentialsDTO is returned once on client registration
+type ClientCredentialsDTO struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthorizeDTO is authorization request. on approval it is posted back with Approve
+type AuthorizeDTO struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Prompt              string `json:"prompt,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+	Approve             bool   `json:"approve,omitempty"`
+}
+
+type ScopeDTO struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ConsentDTO describes consent screen. RedirectTo is set when no consent is needed
+type ConsentDTO struct {
+	ClientID   string     `json:"client_id"`
+	ClientName string     `json:"client_name"`
+	Scopes     []ScopeDTO `json:"scopes"`
+	RedirectTo string     `json:"redirect_to,omitempty"`
+}
+
+type TokenRequestDTO struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	DeviceCode   string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+type TokenResponseDTO struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+type DeviceRequestDTO struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+// DeviceAuthorizationDTO is RFC 8628 3.2 response. user enters UserCode on VerificationURI
+type DeviceAuthorizationDTO struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceApprovalDTO is user decision on device sign in
+type DeviceApprovalDTO struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// IntrospectionDTO is RFC 7662 introspection response
+type IntrospectionDTO struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	Actor     *Actor `json:"act,omitempty"`
+}
+
+// Actor is RFC 8693 act claim of impersonation token
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+func NewIntrospection(p auth.Principal) IntrospectionDTO {
+	i := IntrospectionDTO{
+		Active:    true,
+		Scope:     strings.Join(p.Scopes, " "),
+		ClientID:  p.ClientID,
+		Subject:   p.AccountUUID,
+		TokenType: "Bearer",
+	}
+	if !p.ExpiresAt.IsZero() {
+		i.ExpiresAt = p.ExpiresAt.Unix()
+	}
+	if !p.AuthTime.IsZero() {
+		i.AuthTime = p.AuthTime.Unix()
+	}
+	if p.IsImpersonated() {
+		i.Actor = &Actor{Subject: p.ActorUUID}
+	}
+	return i
+}
+
+func NewClient(id, secretHash string, dto CreateClientDTO) Client {
+	return Client{
+		ID:             id,
+		SecretHash:     secretHash,
+		Name:           dto.Name,
+		RedirectURIs:   dto.RedirectURIs,
+		Scopes:         dto.Scopes,
+		Public:         dto.Public,
+		ServiceAccount: dto.ServiceAccount,
+		DeviceFlow:     dto.DeviceFlow,
+		CreatedAt:      time.Now().UnixNano(),
+	}
+}
+
+func NewToken(id, kind, clientID, accountUUID string, scopes []string, authTime time.Time, ttl time.Duration) Token {
+	tNow := time.Now()
+	return Token{
+		ID:          id,
+		Kind:        kind,
+		ClientID:    clientID,
+		AccountUUID: accountUUID,
+		Scopes:      scopes,
+		AuthTime:    authTime,
+		CreatedAt:   tNow,
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
+
+func NewConsent(accountUUID string, client Client, scopes []string) Consent {
+	tNow := time.Now().UnixNano()
+	return Consent{
+		ID:          consentID(accountUUID, client.ID),
+		AccountUUID: accountUUID,
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		Scopes:      scopes,
+		CreatedAt:   tNow,
+		UpdatedAt:   tNow,
+	}
+}
+
+func consentID(accountUUID, clientID string) string {
+	return accountUUID + ":" + clientID
+}
+
+func (c *Client) AllowsRedirect(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,816 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ auth.Authenticator = &service{}
+
+type service struct {
+	storage         Storage
+	accounts        accounts.Service
+	idTokens        IDTokenIssuer
+	codeTTL         time.Duration
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	deviceCodeTTL   time.Duration
+	deviceInterval  time.Duration
+	verificationURL string
+	logger          logging.Logger
+}
+
+// IDTokenIssuer signs OpenID Connect ID token when openid scope is granted
+type IDTokenIssuer interface {
+	IssueIDToken(ctx context.Context, clientID, accountUUID string, scopes []string, nonce string, authTime time.Time) (string, error)
+}
+
+func NewService(oauthStorage Storage, accountService accounts.Service, idTokens IDTokenIssuer,
+	codeTTL, accessTokenTTL, refreshTokenTTL, deviceCodeTTL, deviceInterval time.Duration, verificationURL string,
+	logger logging.Logger) (Service, error) {
+	return &service{
+		storage:         oauthStorage,
+		accounts:        accountService,
+		idTokens:        idTokens,
+		codeTTL:         codeTTL,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		deviceCodeTTL:   deviceCodeTTL,
+		deviceInterval:  deviceInterval,
+		verificationURL: verificationURL,
+		logger:          logger,
+	}, nil
+}
+
+type Service interface {
+	CreateClient(ctx context.Context, dto CreateClientDTO) (ClientCredentialsDTO, error)
+	GetClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id string) error
+
+	Authorize(ctx context.Context, principal auth.Principal, dto AuthorizeDTO) (ConsentDTO, error)
+	Approve(ctx context.Context, principal auth.Principal, dto AuthorizeDTO) (ConsentDTO, error)
+	Token(ctx context.Context, dto TokenRequestDTO) (TokenResponseDTO, error)
+
+	AuthorizeDevice(ctx context.Context, dto DeviceRequestDTO) (DeviceAuthorizationDTO, error)
+	GetDeviceConsent(ctx context.Context, userCode string) (ConsentDTO, error)
+	ApproveDevice(ctx context.Context, principal auth.Principal, dto DeviceApprovalDTO) error
+
+	GetConsents(ctx context.Context, accountUUID string) ([]Consent, error)
+	RevokeConsent(ctx context.Context, accountUUID, clientID string) error
+	RevokeAll(ctx context.Context, accountUUID string) error
+
+	AuthenticateService(ctx context.Context, clientID, secret string) (Client, error)
+	RevokeToken(ctx context.Context, token string) error
+
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+}
+
+//? register client or service account. secret of confidential client is returned only once
+func (s service) CreateClient(ctx context.Context, dto CreateClientDTO) (creds ClientCredentialsDTO, err error) {
+	if err = validateClient(dto); err != nil {
+		return creds, err
+	}
+
+	s.logger.Debug("generate client credentials")
+	creds.ClientID, err = token.New(16)
+	if err != nil {
+		return creds, err
+	}
+	var secretHash string
+	if !dto.Public {
+		creds.ClientSecret, err = token.New(32)
+		if err != nil {
+			return creds, err
+		}
+		secretHash = token.Hash(creds.ClientSecret)
+	}
+
+	if err = s.storage.CreateClient(ctx, NewClient(creds.ClientID, secretHash, dto)); err != nil {
+		return creds, fmt.Errorf("failed to create client. error: %w", err)
+	}
+	return creds, nil
+}
+
+func (s service) GetClients(ctx context.Context) ([]Client, error) {
+	clients, err := s.storage.FindClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find clients. error: %w", err)
+	}
+	return clients, nil
+}
+
+func (s service) DeleteClient(ctx context.Context, id string) error {
+	err := s.storage.DeleteClient(ctx, id)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete client. error: %w", err)
+	}
+
+	s.logger.Debug("revoke client tokens")
+	if err = s.storage.DeleteTokens(ctx, "", id); err != nil {
+		return fmt.Errorf("failed to delete client tokens. error: %w", err)
+	}
+	return nil
+}
+
+//? describe consent screen. when consent already covers requested scopes code is issued at once
+func (s service) Authorize(ctx context.Context, principal auth.Principal, dto AuthorizeDTO) (c ConsentDTO, err error) {
+	client, scopes, err := s.validateAuthorize(ctx, dto)
+	if err != nil {
+		return c, err
+	}
+
+	c = ConsentDTO{ClientID: client.ID, ClientName: client.Name}
+	for _, scope := range scopes {
+		c.Scopes = append(c.Scopes, ScopeDTO{Name: scope, Description: SupportedScopes[scope]})
+	}
+
+	if dto.Prompt == "consent" {
+		return c, nil
+	}
+	consent, err := s.storage.FindConsent(ctx, principal.AccountUUID, client.ID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return c, nil
+		}
+		return c, fmt.Errorf("failed to find consent. error: %w", err)
+	}
+	if !contains(consent.Scopes, scopes) {
+		return c, nil
+	}
+
+	c.RedirectTo, err = s.issueCode(ctx, principal, client, scopes, dto)
+	return c, err
+}
+
+//? record user decision and redirect back to client
+func (s service) Approve(ctx context.Context, principal auth.Principal, dto AuthorizeDTO) (c ConsentDTO, err error) {
+	client, scopes, err := s.validateAuthorize(ctx, dto)
+	if err != nil {
+		return c, err
+	}
+	c = ConsentDTO{ClientID: client.ID, ClientName: client.Name}
+
+	if !dto.Approve {
+		c.RedirectTo = redirectURL(dto.RedirectURI, url.Values{"error": {"access_denied"}, "state": {dto.State}})
+		return c, nil
+	}
+
+	if err = s.saveConsent(ctx, principal.AccountUUID, client, scopes); err != nil {
+		return c, err
+	}
+
+	c.RedirectTo, err = s.issueCode(ctx, principal, client, scopes, dto)
+	return c, err
+}
+
+func (s service) Token(ctx context.Context, dto TokenRequestDTO) (resp TokenResponseDTO, err error) {
+	client, err := s.authenticateClient(ctx, dto.ClientID, dto.ClientSecret)
+	if err != nil {
+		return resp, err
+	}
+
+	switch dto.GrantType {
+	case grantAuthorizationCode, grantRefreshToken:
+		if client.ServiceAccount {
+			return resp, unauthorizedClient("service account may use only client_credentials grant")
+		}
+		if dto.GrantType == grantAuthorizationCode {
+			return s.exchangeCode(ctx, client, dto)
+		}
+		return s.refresh(ctx, client, dto)
+	case grantDeviceCode:
+		if !client.DeviceFlow {
+			return resp, unauthorizedClient("client is not allowed to use device code grant")
+		}
+		return s.deviceCode(ctx, client, dto)
+	case grantClientCredentials:
+		if !client.ServiceAccount {
+			return resp, unauthorizedClient("client is not a service account")
+		}
+		return s.clientCredentials(ctx, client, dto)
+	default:
+		return resp, unsupportedGrantType(fmt.Sprintf("grant type %q is not supported", dto.GrantType))
+	}
+}
+
+//? RFC 8628 3.1. console shows user code and polls token endpoint with device code
+func (s service) AuthorizeDevice(ctx context.Context, dto DeviceRequestDTO) (resp DeviceAuthorizationDTO, err error) {
+	client, err := s.authenticateClient(ctx, dto.ClientID, dto.ClientSecret)
+	if err != nil {
+		return resp, err
+	}
+	if !client.DeviceFlow {
+		return resp, unauthorizedClient("client is not allowed to use device code grant")
+	}
+
+	scopes := strings.Fields(dto.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !contains(client.Scopes, scopes) {
+		return resp, invalidScope("requested scope is not allowed for client")
+	}
+
+	deviceCode, err := token.New(32)
+	if err != nil {
+		return resp, err
+	}
+	code := DeviceCode{
+		ID:        token.Hash(deviceCode),
+		ClientID:  client.ID,
+		Scopes:    scopes,
+		Status:    DevicePending,
+		Interval:  s.deviceInterval,
+		ExpiresAt: time.Now().Add(s.deviceCodeTTL),
+	}
+
+	//? user code is short, so retry on rare collision with pending one
+	var userCode string
+	for attempt := 0; attempt < 3; attempt++ {
+		userCode, err = newUserCode()
+		if err != nil {
+			return resp, err
+		}
+		code.UserCode = token.Hash(normalizeUserCode(userCode))
+
+		s.logger.Debug("create device code")
+		err = s.storage.CreateDeviceCode(ctx, code)
+		if !errors.Is(err, apperror.ErrAlreadyExists) {
+			break
+		}
+	}
+	if err != nil {
+		return resp, fmt.Errorf("failed to create device code. error: %w", err)
+	}
+
+	return DeviceAuthorizationDTO{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         s.verificationURL,
+		VerificationURIComplete: redirectURL(s.verificationURL, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               int64(s.deviceCodeTTL.Seconds()),
+		Interval:                int64(s.deviceInterval.Seconds()),
+	}, nil
+}
+
+//? describe consent screen for user code entered on web
+func (s service) GetDeviceConsent(ctx context.Context, userCode string) (c ConsentDTO, err error) {
+	code, client, err := s.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return c, err
+	}
+
+	c = ConsentDTO{ClientID: client.ID, ClientName: client.Name}
+	for _, scope := range code.Scopes {
+		c.Scopes = append(c.Scopes, ScopeDTO{Name: scope, Description: SupportedScopes[scope]})
+	}
+	return c, nil
+}
+
+func (s service) ApproveDevice(ctx context.Context, principal auth.Principal, dto DeviceApprovalDTO) error {
+	code, client, err := s.pendingDeviceCode(ctx, dto.UserCode)
+	if err != nil {
+		return err
+	}
+
+	status := DeviceDenied
+	if dto.Approve {
+		status = DeviceApproved
+		if err = s.saveConsent(ctx, principal.AccountUUID, client, code.Scopes); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debugf("device code %s", status)
+	err = s.storage.DecideDeviceCode(ctx, code.ID, status, principal.AccountUUID, principal.AuthTime)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.BadRequestError("user code is invalid or expired")
+		}
+		return fmt.Errorf("failed to update device code. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) GetConsents(ctx context.Context, accountUUID string) ([]Consent, error) {
+	consents, err := s.storage.FindConsents(ctx, accountUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find consents. error: %w", err)
+	}
+	return consents, nil
+}
+
+//? revoking consent revokes every token client holds for account
+func (s service) RevokeConsent(ctx context.Context, accountUUID, clientID string) error {
+	err := s.storage.DeleteConsent(ctx, accountUUID, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete consent. error: %w", err)
+	}
+
+	s.logger.Debug("revoke client tokens of account")
+	if err = s.storage.DeleteTokens(ctx, accountUUID, clientID); err != nil {
+		return fmt.Errorf("failed to delete tokens. error: %w", err)
+	}
+	return nil
+}
+
+//? every client loses access to account. clients must ask for consent again
+func (s service) RevokeAll(ctx context.Context, accountUUID string) error {
+	if err := s.storage.DeleteConsents(ctx, accountUUID); err != nil {
+		return fmt.Errorf("failed to delete consents. error: %w", err)
+	}
+	if err := s.storage.DeleteAccountTokens(ctx, accountUUID); err != nil {
+		return fmt.Errorf("failed to delete tokens. error: %w", err)
+	}
+	return nil
+}
+
+//? only service accounts granted internal:tokens may introspect and revoke tokens
+func (s service) AuthenticateService(ctx context.Context, clientID, secret string) (client Client, err error) {
+	client, err = s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return client, err
+	}
+	if client.Public || !client.ServiceAccount || !contains(client.Scopes, []string{auth.ScopeInternalTokens}) {
+		return client, invalidClient("client is not allowed to manage tokens")
+	}
+	return client, nil
+}
+
+//? revoking refresh token also revokes access tokens client holds for account, RFC 7009 2.1
+func (s service) RevokeToken(ctx context.Context, raw string) error {
+	t, err := s.storage.FindToken(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find token. error: %w", err)
+	}
+
+	if t.Kind == tokenRefresh {
+		err = s.storage.DeleteTokens(ctx, t.AccountUUID, t.ClientID)
+	} else {
+		err = s.storage.DeleteToken(ctx, t.ID)
+	}
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return fmt.Errorf("failed to delete token. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) Authenticate(ctx context.Context, raw string) (p auth.Principal, err error) {
+	t, err := s.storage.FindToken(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, fmt.Errorf("failed to find token. error: %w", err)
+	}
+	if t.Kind != tokenAccess || time.Now().After(t.ExpiresAt) {
+		return p, apperror.ErrUnauthorized
+	}
+	if t.AccountUUID == "" {
+		return auth.Principal{
+			AuthTime:  t.CreatedAt,
+			ExpiresAt: t.ExpiresAt,
+			ClientID:  t.ClientID,
+			Scopes:    append([]string{}, t.Scopes...),
+			IsService: true,
+		}, nil
+	}
+
+	account, err := s.accounts.GetAccount(ctx, t.AccountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, err
+	}
+	if err = account.CheckStatus(); err != nil {
+		return p, apperror.ErrUnauthorized
+	}
+
+	//? delegated tokens never carry admin rights of account
+	return auth.Principal{
+		AccountUUID: account.UUID,
+		AuthTime:    t.AuthTime,
+		ExpiresAt:   t.ExpiresAt,
+		ClientID:    t.ClientID,
+		Scopes:      append([]string{}, t.Scopes...),
+	}, nil
+}
+
+func (s service) validateAuthorize(ctx context.Context, dto AuthorizeDTO) (client Client, scopes []string, err error) {
+	client, err = s.storage.FindClient(ctx, dto.ClientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return client, nil, apperror.BadRequestError("unknown client")
+		}
+		return client, nil, fmt.Errorf("failed to find client. error: %w", err)
+	}
+	if !client.AllowsRedirect(dto.RedirectURI) {
+		return client, nil, apperror.BadRequestError("redirect uri is not registered for client")
+	}
+	if dto.ResponseType != "code" {
+		return client, nil, apperror.BadRequestError("only code response type is supported")
+	}
+	if dto.CodeChallenge == "" || dto.CodeChallengeMethod != "S256" {
+		return client, nil, apperror.BadRequestError("PKCE code challenge with S256 method is required")
+	}
+
+	scopes = strings.Fields(dto.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !contains(client.Scopes, scopes) {
+		return client, nil, apperror.BadRequestError("requested scope is not allowed for client")
+	}
+	return client, scopes, nil
+}
+
+func (s service) issueCode(ctx context.Context, principal auth.Principal, client Client, scopes []string, dto AuthorizeDTO) (string, error) {
+	s.logger.Debug("issue authorization code")
+	raw, err := token.New(32)
+	if err != nil {
+		return "", err
+	}
+	code := AuthorizationCode{
+		ID:                  token.Hash(raw),
+		ClientID:            client.ID,
+		AccountUUID:         principal.AccountUUID,
+		RedirectURI:         dto.RedirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       dto.CodeChallenge,
+		CodeChallengeMethod: dto.CodeChallengeMethod,
+		Nonce:               dto.Nonce,
+		AuthTime:            principal.AuthTime,
+		ExpiresAt:           time.Now().Add(s.codeTTL),
+	}
+	if err = s.storage.CreateCode(ctx, code); err != nil {
+		return "", fmt.Errorf("failed to create authorization code. error: %w", err)
+	}
+	return redirectURL(dto.RedirectURI, url.Values{"code": {raw}, "state": {dto.State}}), nil
+}
+
+func (s service) authenticateClient(ctx context.Context, clientID, secret string) (client Client, err error) {
+	client, err = s.storage.FindClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return client, invalidClient("unknown client")
+		}
+		return client, fmt.Errorf("failed to find client. error: %w", err)
+	}
+	if client.Public {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash(secret)), []byte(client.SecretHash)) != 1 {
+		return client, invalidClient("client authentication failed")
+	}
+	return client, nil
+}
+
+func (s service) exchangeCode(ctx context.Context, client Client, dto TokenRequestDTO) (resp TokenResponseDTO, err error) {
+	code, err := s.storage.TakeCode(ctx, token.Hash(dto.Code))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return resp, invalidGrant("authorization code is invalid")
+		}
+		return resp, fmt.Errorf("failed to find authorization code. error: %w", err)
+	}
+	if time.Now().After(code.ExpiresAt) || code.ClientID != client.ID || code.RedirectURI != dto.RedirectURI {
+		return resp, invalidGrant("authorization code is invalid")
+	}
+
+	//? RFC 7636 S256: BASE64URL(SHA256(code_verifier)) == code_challenge
+	if len(dto.CodeVerifier) < 43 || len(dto.CodeVerifier) > 128 {
+		return resp, invalidGrant("code verifier is invalid")
+	}
+	sum := sha256.Sum256([]byte(dto.CodeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		return resp, invalidGrant("code verifier does not match challenge")
+	}
+
+	if err = s.checkAccount(ctx, code.AccountUUID); err != nil {
+		return resp, err
+	}
+	return s.issueTokens(ctx, client, code.AccountUUID, code.Scopes, code.Nonce, code.AuthTime)
+}
+
+//? refresh tokens are rotated, old one can't be used again
+func (s service) refresh(ctx context.Context, client Client, dto TokenRequestDTO) (resp TokenResponseDTO, err error) {
+	t, err := s.storage.FindToken(ctx, token.Hash(dto.RefreshToken))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return resp, invalidGrant("refresh token is invalid")
+		}
+		return resp, fmt.Errorf("failed to find refresh token. error: %w", err)
+	}
+	if t.Kind != tokenRefresh || t.ClientID != client.ID || time.Now().After(t.ExpiresAt) {
+		return resp, invalidGrant("refresh token is invalid")
+	}
+
+	scopes := t.Scopes
+	if requested := strings.Fields(dto.Scope); len(requested) > 0 {
+		if !contains(t.Scopes, requested) {
+			return resp, invalidScope("requested scope exceeds granted scope")
+		}
+		scopes = requested
+	}
+
+	if err = s.storage.DeleteToken(ctx, t.ID); err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return resp, invalidGrant("refresh token is invalid")
+		}
+		return resp, fmt.Errorf("failed to delete refresh token. error: %w", err)
+	}
+
+	if err = s.checkAccount(ctx, t.AccountUUID); err != nil {
+		return resp, err
+	}
+	return s.issueTokens(ctx, client, t.AccountUUID, scopes, "", t.AuthTime)
+}
+
+//? RFC 8628 3.5. polling faster than interval slows client down by 5 seconds
+func (s service) deviceCode(ctx context.Context, client Client, dto TokenRequestDTO) (resp TokenResponseDTO, err error) {
+	now := time.Now()
+	code, err := s.storage.PollDeviceCode(ctx, token.Hash(dto.DeviceCode), now)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return resp, invalidGrant("device code is invalid")
+		}
+		return resp, fmt.Errorf("failed to find device code. error: %w", err)
+	}
+	if code.ClientID != client.ID {
+		return resp, invalidGrant("device code is invalid")
+	}
+	if now.After(code.ExpiresAt) {
+		return resp, expiredToken("device code expired")
+	}
+	if now.Sub(code.LastPolledAt) < code.Interval {
+		if err = s.storage.SetDeviceCodeInterval(ctx, code.ID, code.Interval+5*time.Second); err != nil {
+			return resp, fmt.Errorf("failed to update device code. error: %w", err)
+		}
+		return resp, slowDown("polling too fast")
+	}
+
+	switch code.Status {
+	case DevicePending:
+		return resp, authorizationPending("user has not approved device yet")
+	case DeviceDenied:
+		s.storage.TakeDeviceCode(ctx, code.ID)
+		return resp, accessDenied("user denied device")
+	}
+
+	//? approved code is redeemed once
+	code, err = s.storage.TakeDeviceCode(ctx, code.ID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return resp, invalidGrant("device code is invalid")
+		}
+		return resp, fmt.Errorf("failed to delete device code. error: %w", err)
+	}
+
+	if err = s.checkAccount(ctx, code.AccountUUID); err != nil {
+		return resp, err
+	}
+	return s.issueTokens(ctx, client, code.AccountUUID, code.Scopes, "", code.AuthTime)
+}
+
+//? service account gets access token only, RFC 6749 4.4.3
+func (s service) clientCredentials(ctx context.Context, client Client, dto TokenRequestDTO) (resp TokenResponseDTO, err error) {
+	scopes := client.Scopes
+	if requested := strings.Fields(dto.Scope); len(requested) > 0 {
+		if !contains(client.Scopes, requested) {
+			return resp, invalidScope("requested scope is not allowed for client")
+		}
+		scopes = requested
+	}
+
+	s.logger.Debug("issue service access token")
+	access, err := token.New(32)
+	if err != nil {
+		return resp, err
+	}
+	err = s.storage.CreateToken(ctx, NewToken(token.Hash(access), tokenAccess, client.ID, "", scopes, time.Now(), s.accessTokenTTL))
+	if err != nil {
+		return resp, fmt.Errorf("failed to create access token. error: %w", err)
+	}
+
+	return TokenResponseDTO{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.accessTokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func (s service) pendingDeviceCode(ctx context.Context, userCode string) (code DeviceCode, client Client, err error) {
+	code, err = s.storage.FindDeviceCode(ctx, token.Hash(normalizeUserCode(userCode)))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return code, client, apperror.BadRequestError("user code is invalid or expired")
+		}
+		return code, client, fmt.Errorf("failed to find device code. error: %w", err)
+	}
+	if code.Status != DevicePending || time.Now().After(code.ExpiresAt) {
+		return code, client, apperror.BadRequestError("user code is invalid or expired")
+	}
+
+	client, err = s.storage.FindClient(ctx, code.ClientID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return code, client, apperror.BadRequestError("unknown client")
+		}
+		return code, client, fmt.Errorf("failed to find client. error: %w", err)
+	}
+	return code, client, nil
+}
+
+//? consent is extended with newly granted scopes
+func (s service) saveConsent(ctx context.Context, accountUUID string, client Client, scopes []string) error {
+	s.logger.Debug("save consent")
+	consent := NewConsent(accountUUID, client, scopes)
+	existing, err := s.storage.FindConsent(ctx, accountUUID, client.ID)
+	if err == nil {
+		consent.CreatedAt = existing.CreatedAt
+		consent.Scopes = union(existing.Scopes, scopes)
+	} else if !errors.Is(err, apperror.ErrNotFound) {
+		return fmt.Errorf("failed to find consent. error: %w", err)
+	}
+	if err = s.storage.SaveConsent(ctx, consent); err != nil {
+		return fmt.Errorf("failed to save consent. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) checkAccount(ctx context.Context, accountUUID string) error {
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return invalidGrant("account not found")
+		}
+		return err
+	}
+	if err = account.CheckSignIn(); err != nil {
+		return invalidGrant(err.Error())
+	}
+	return nil
+}
+
+func (s service) issueTokens(ctx context.Context, client Client, accountUUID string, scopes []string, nonce string, authTime time.Time) (resp TokenResponseDTO, err error) {
+	s.logger.Debug("issue access and refresh tokens")
+	access, err := token.New(32)
+	if err != nil {
+		return resp, err
+	}
+	refresh, err := token.New(32)
+	if err != nil {
+		return resp, err
+	}
+
+	err = s.storage.CreateToken(ctx, NewToken(token.Hash(access), tokenAccess, client.ID, accountUUID, scopes, authTime, s.accessTokenTTL))
+	if err != nil {
+		return resp, fmt.Errorf("failed to create access token. error: %w", err)
+	}
+	err = s.storage.CreateToken(ctx, NewToken(token.Hash(refresh), tokenRefresh, client.ID, accountUUID, scopes, authTime, s.refreshTokenTTL))
+	if err != nil {
+		return resp, fmt.Errorf("failed to create refresh token. error: %w", err)
+	}
+
+	resp = TokenResponseDTO{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(scopes, " "),
+	}
+	if contains(scopes, []string{auth.ScopeOpenID}) {
+		s.logger.Debug("issue id token")
+		resp.IDToken, err = s.idTokens.IssueIDToken(ctx, client.ID, accountUUID, scopes, nonce, authTime)
+		if err != nil {
+			return resp, fmt.Errorf("failed to issue id token. error: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+func validateClient(dto CreateClientDTO) error {
+	if dto.Name == "" {
+		return apperror.BadRequestError("name is required")
+	}
+
+	allowed := SupportedScopes
+	if dto.ServiceAccount {
+		if dto.Public || len(dto.RedirectURIs) > 0 {
+			return apperror.BadRequestError("service account must be confidential and has no redirect uris")
+		}
+		allowed = ServiceScopes
+		if dto.DeviceFlow {
+			return apperror.BadRequestError("service account can't use device flow")
+		}
+	} else if len(dto.RedirectURIs) == 0 && !dto.DeviceFlow {
+		return apperror.BadRequestError("redirect uris are required")
+	}
+
+	for _, uri := range dto.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return apperror.BadRequestError(fmt.Sprintf("invalid redirect uri %q", uri))
+		}
+	}
+	for _, scope := range dto.Scopes {
+		if _, ok := allowed[scope]; !ok {
+			return apperror.BadRequestError(fmt.Sprintf("unsupported scope %q", scope))
+		}
+	}
+	return nil
+}
+
+func redirectURL(base string, params url.Values) string {
+	u, _ := url.Parse(base)
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// user codes use consonants only, RFC 8628 6.1
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// newUserCode returns user code formatted as XXXX-XXXX
+func newUserCode() (string, error) {
+	code := make([]byte, 0, 9)
+	for len(code) < 9 {
+		b, err := token.Bytes(16)
+		if err != nil {
+			return "", err
+		}
+		for _, v := range b {
+			//? bytes above last multiple of alphabet length would bias code
+			if int(v) >= 256-256%len(userCodeAlphabet) || len(code) == 9 {
+				continue
+			}
+			if len(code) == 4 {
+				code = append(code, '-')
+			}
+			code = append(code, userCodeAlphabet[int(v)%len(userCodeAlphabet)])
+		}
+	}
+	return string(code), nil
+}
+
+func normalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// contains reports whether every scope of subset is in set
+func contains(set, subset []string) bool {
+	for _, want := range subset {
+		found := false
+		for _, have := range set {
+			if have == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, v := range b {
+		if !contains(out, []string{v}) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,317 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testClientID    = "game-launcher"
+	testRedirectURI = "http://localhost:3000/callback"
+	testAccountUUID = "611a7209ef4f1f377c96a4eb"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-long-enough"
+)
+
+// memoryStorage keeps codes, tokens and consents in maps. other methods are not used by tests
+type memoryStorage struct {
+	Storage
+	clients  map[string]Client
+	codes    map[string]AuthorizationCode
+	tokens   map[string]Token
+	consents map[string]Consent
+}
+
+func (m *memoryStorage) FindClient(ctx context.Context, id string) (Client, error) {
+	c, ok := m.clients[id]
+	if !ok {
+		return c, apperror.ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *memoryStorage) CreateCode(ctx context.Context, code AuthorizationCode) error {
+	m.codes[code.ID] = code
+	return nil
+}
+
+func (m *memoryStorage) TakeCode(ctx context.Context, id string) (AuthorizationCode, error) {
+	c, ok := m.codes[id]
+	if !ok {
+		return c, apperror.ErrNotFound
+	}
+	delete(m.codes, id)
+	return c, nil
+}
+
+func (m *memoryStorage) CreateToken(ctx context.Context, t Token) error {
+	m.tokens[t.ID] = t
+	return nil
+}
+
+func (m *memoryStorage) FindToken(ctx context.Context, id string) (Token, error) {
+	t, ok := m.tokens[id]
+	if !ok {
+		return t, apperror.ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *memoryStorage) DeleteToken(ctx context.Context, id string) error {
+	if _, ok := m.tokens[id]; !ok {
+		return apperror.ErrNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+func (m *memoryStorage) FindConsent(ctx context.Context, accountUUID, clientID string) (Consent, error) {
+	c, ok := m.consents[consentID(accountUUID, clientID)]
+	if !ok {
+		return c, apperror.ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *memoryStorage) SaveConsent(ctx context.Context, consent Consent) error {
+	m.consents[consent.ID] = consent
+	return nil
+}
+
+// activeAccounts returns active account for any uuid
+type activeAccounts struct {
+	accounts.Service
+}
+
+func (activeAccounts) GetAccount(ctx context.Context, uuid string) (accounts.Account, error) {
+	return accounts.Account{UUID: uuid, IsActive: true}, nil
+}
+
+func newTestService(t *testing.T) (service, *memoryStorage) {
+	t.Helper()
+	storage := &memoryStorage{
+		clients: map[string]Client{
+			testClientID: {
+				ID:           testClientID,
+				Name:         "Game launcher",
+				RedirectURIs: []string{testRedirectURI},
+				Scopes:       []string{auth.ScopeAccountRead, auth.ScopeAccountWrite},
+				Public:       true,
+			},
+			"other": {ID: "other", RedirectURIs: []string{testRedirectURI}, Scopes: []string{auth.ScopeAccountRead}, Public: true},
+		},
+		codes:    make(map[string]AuthorizationCode),
+		tokens:   make(map[string]Token),
+		consents: make(map[string]Consent),
+	}
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	s, err := NewService(storage, activeAccounts{}, nil, time.Minute, time.Hour, 24*time.Hour, time.Minute,
+		5*time.Second, "http://localhost:10005/device", logging.Logger{Entry: logrus.NewEntry(l)})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return *s.(*service), storage
+}
+
+func challengeOf(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+//? approve consent and return authorization code from redirect
+func authorize(t *testing.T, s service, dto AuthorizeDTO) string {
+	t.Helper()
+	principal := auth.Principal{AccountUUID: testAccountUUID, SessionID: "session", AuthTime: time.Now()}
+	c, err := s.Approve(context.Background(), principal, dto)
+	if err != nil {
+		t.Fatalf("Approve() error = %v", err)
+	}
+	u, err := url.Parse(c.RedirectTo)
+	if err != nil {
+		t.Fatalf("failed to parse redirect: %v", err)
+	}
+	return u.Query().Get("code")
+}
+
+func authorizeDTO() AuthorizeDTO {
+	return AuthorizeDTO{
+		ResponseType:        "code",
+		ClientID:            testClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               auth.ScopeAccountRead + " " + auth.ScopeAccountWrite,
+		State:               "state",
+		CodeChallenge:       challengeOf(testVerifier),
+		CodeChallengeMethod: "S256",
+		Approve:             true,
+	}
+}
+
+func wantGrantError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oErr *Error
+	if !errors.As(err, &oErr) || oErr.Code != code {
+		t.Fatalf("error = %v, want %s", err, code)
+	}
+}
+
+func TestAuthorizeRequiresPKCE(t *testing.T) {
+	s, _ := newTestService(t)
+	tests := []struct {
+		name    string
+		modify  func(dto *AuthorizeDTO)
+		wantErr bool
+	}{
+		{name: "s256 challenge", modify: func(dto *AuthorizeDTO) {}},
+		{name: "missing challenge", modify: func(dto *AuthorizeDTO) { dto.CodeChallenge = "" }, wantErr: true},
+		{name: "plain method", modify: func(dto *AuthorizeDTO) { dto.CodeChallengeMethod = "plain" }, wantErr: true},
+		{name: "missing method", modify: func(dto *AuthorizeDTO) { dto.CodeChallengeMethod = "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dto := authorizeDTO()
+			tt.modify(&dto)
+			principal := auth.Principal{AccountUUID: testAccountUUID, SessionID: "session"}
+			_, err := s.Approve(context.Background(), principal, dto)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Approve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(dto *TokenRequestDTO)
+		wantCode string
+	}{
+		{name: "matching verifier", modify: func(dto *TokenRequestDTO) {}},
+		{name: "other verifier", modify: func(dto *TokenRequestDTO) { dto.CodeVerifier = strings.Repeat("a", 43) }, wantCode: "invalid_grant"},
+		{name: "short verifier", modify: func(dto *TokenRequestDTO) { dto.CodeVerifier = testVerifier[:42] }, wantCode: "invalid_grant"},
+		{name: "long verifier", modify: func(dto *TokenRequestDTO) { dto.CodeVerifier = strings.Repeat("a", 129) }, wantCode: "invalid_grant"},
+		{name: "missing verifier", modify: func(dto *TokenRequestDTO) { dto.CodeVerifier = "" }, wantCode: "invalid_grant"},
+		{name: "other redirect uri", modify: func(dto *TokenRequestDTO) { dto.RedirectURI = "http://localhost:3000/other" }, wantCode: "invalid_grant"},
+		{name: "other client", modify: func(dto *TokenRequestDTO) { dto.ClientID = "other" }, wantCode: "invalid_grant"},
+		{name: "unknown code", modify: func(dto *TokenRequestDTO) { dto.Code = "unknown" }, wantCode: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			dto := TokenRequestDTO{
+				GrantType:    grantAuthorizationCode,
+				Code:         authorize(t, s, authorizeDTO()),
+				RedirectURI:  testRedirectURI,
+				CodeVerifier: testVerifier,
+				ClientID:     testClientID,
+			}
+			tt.modify(&dto)
+			resp, err := s.Token(context.Background(), dto)
+			if tt.wantCode != "" {
+				wantGrantError(t, err, tt.wantCode)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token() error = %v", err)
+			}
+			if resp.AccessToken == "" || resp.RefreshToken == "" {
+				t.Errorf("Token() = %+v, want access and refresh tokens", resp)
+			}
+
+			//? code is single use
+			_, err = s.Token(context.Background(), dto)
+			wantGrantError(t, err, "invalid_grant")
+		})
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	s, storage := newTestService(t)
+	first, err := s.Token(context.Background(), TokenRequestDTO{
+		GrantType:    grantAuthorizationCode,
+		Code:         authorize(t, s, authorizeDTO()),
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+		ClientID:     testClientID,
+	})
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	refresh := func(refreshToken, clientID, scope string) (TokenResponseDTO, error) {
+		return s.Token(context.Background(), TokenRequestDTO{
+			GrantType:    grantRefreshToken,
+			RefreshToken: refreshToken,
+			ClientID:     clientID,
+			Scope:        scope,
+		})
+	}
+
+	second, err := refresh(first.RefreshToken, testClientID, "")
+	if err != nil {
+		t.Fatalf("refresh error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+	if second.Scope != first.Scope {
+		t.Errorf("refresh scope = %q, want %q", second.Scope, first.Scope)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		clientID string
+		scope    string
+		wantCode string
+	}{
+		{name: "rotated token is revoked", token: first.RefreshToken, clientID: testClientID, wantCode: "invalid_grant"},
+		{name: "access token is not refresh token", token: second.AccessToken, clientID: testClientID, wantCode: "invalid_grant"},
+		{name: "other client", token: second.RefreshToken, clientID: "other", wantCode: "invalid_grant"},
+		{name: "wider scope", token: second.RefreshToken, clientID: testClientID, scope: auth.ScopeOpenID, wantCode: "invalid_scope"},
+		{name: "narrower scope", token: second.RefreshToken, clientID: testClientID, scope: auth.ScopeAccountRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := refresh(tt.token, tt.clientID, tt.scope)
+			if tt.wantCode != "" {
+				wantGrantError(t, err, tt.wantCode)
+				return
+			}
+			if err != nil {
+				t.Fatalf("refresh error = %v", err)
+			}
+			if resp.Scope != tt.scope {
+				t.Errorf("refresh scope = %q, want %q", resp.Scope, tt.scope)
+			}
+		})
+	}
+
+	t.Run("expired token", func(t *testing.T) {
+		fresh, err := s.issueTokens(context.Background(), storage.clients[testClientID], testAccountUUID,
+			[]string{auth.ScopeAccountRead}, "", time.Now())
+		if err != nil {
+			t.Fatalf("issueTokens() error = %v", err)
+		}
+		for id, tk := range storage.tokens {
+			if tk.Kind == tokenRefresh {
+				tk.ExpiresAt = time.Now().Add(-time.Second)
+				storage.tokens[id] = tk
+			}
+		}
+		_, err = refresh(fresh.RefreshToken, testClientID, "")
+		wantGrantError(t, err, "invalid_grant")
+	})
+}
@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	CreateClient(ctx context.Context, client Client) error
+	FindClient(ctx context.Context, id string) (Client, error)
+	FindClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id string) error
+
+	CreateCode(ctx context.Context, code AuthorizationCode) error
+	TakeCode(ctx context.Context, id string) (AuthorizationCode, error)
+
+	CreateDeviceCode(ctx context.Context, code DeviceCode) error
+	FindDeviceCode(ctx context.Context, userCode string) (DeviceCode, error)
+	PollDeviceCode(ctx context.Context, id string, polledAt time.Time) (DeviceCode, error)
+	SetDeviceCodeInterval(ctx context.Context, id string, interval time.Duration) error
+	DecideDeviceCode(ctx context.Context, id, status, accountUUID string, authTime time.Time) error
+	TakeDeviceCode(ctx context.Context, id string) (DeviceCode, error)
+
+	CreateToken(ctx context.Context, token Token) error
+	FindToken(ctx context.Context, id string) (Token, error)
+	DeleteToken(ctx context.Context, id string) error
+	DeleteTokens(ctx context.Context, accountUUID, clientID string) error
+	DeleteAccountTokens(ctx context.Context, accountUUID string) error
+
+	SaveConsent(ctx context.Context, consent Consent) error
+	FindConsent(ctx context.Context, accountUUID, clientID string) (Consent, error)
+	FindConsents(ctx context.Context, accountUUID string) ([]Consent, error)
+	DeleteConsent(ctx context.Context, accountUUID, clientID string) error
+	DeleteConsents(ctx context.Context, accountUUID string) error
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	discoveryURL = "/.well-known/openid-configuration"
+	jwksURL      = "/.well-known/jwks.json"
+	userInfoURL  = "/userinfo"
+)
+
+type Handler struct {
+	Logger      logging.Logger
+	OIDCService Service
+	Auth        *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, discoveryURL, apperror.Middleware(h.Discovery))
+	router.HandlerFunc(http.MethodGet, jwksURL, apperror.Middleware(h.JWKS))
+	router.HandlerFunc(http.MethodGet, userInfoURL, apperror.Middleware(h.Auth.Authenticated(h.UserInfo, auth.ScopeOpenID)))
+	router.HandlerFunc(http.MethodPost, userInfoURL, apperror.Middleware(h.Auth.Authenticated(h.UserInfo, auth.ScopeOpenID)))
+}
+
+func (h *Handler) Discovery(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OIDC DISCOVERY")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("marshal discovery document")
+	discoveryBytes, err := json.Marshal(h.OIDCService.Discovery())
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(discoveryBytes)
+
+	return nil
+}
+
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OIDC JWKS")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("marshal key set")
+	jwksBytes, err := json.Marshal(h.OIDCService.JWKS())
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jwksBytes)
+
+	return nil
+}
+
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("OIDC USERINFO")
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, _ := auth.FromContext(r.Context())
+	info, err := h.OIDCService.UserInfo(r.Context(), principal)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal user info")
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(infoBytes)
+
+	return nil
+}
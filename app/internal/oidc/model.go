@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Discovery is OpenID Provider Metadata served on /.well-known/openid-configuration
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// JWK is public signing key in RFC 7517 format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// UserInfo is standard claims about account released by granted scopes
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Birthdate         string `json:"birthdate,omitempty"`
+}
+
+// IDTokenClaims are claims of signed ID token
+type IDTokenClaims struct {
+	jwt.StandardClaims
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`
+	AZP               string `json:"azp,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Birthdate         string `json:"birthdate,omitempty"`
+}
+
+// NewUserInfo builds claims from account. Birthday is stored as unix seconds
+func NewUserInfo(account accounts.Account, scopes []string) UserInfo {
+	info := UserInfo{Subject: account.UUID}
+	for _, scope := range scopes {
+		switch scope {
+		case auth.ScopeEmail:
+			info.Email = account.Email
+		case auth.ScopeProfile:
+			info.PreferredUsername = account.Username
+			info.Locale = account.Language
+			info.Picture = account.AvatarURL
+			if account.Birthday != 0 {
+				info.Birthdate = time.Unix(account.Birthday, 0).UTC().Format("2006-01-02")
+			}
+		}
+	}
+	return info
+}
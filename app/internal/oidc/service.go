@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/internal/oauth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var _ Service = &service{}
+var _ oauth.IDTokenIssuer = &service{}
+
+type service struct {
+	accounts   accounts.Service
+	issuer     string
+	key        *rsa.PrivateKey
+	keyID      string
+	idTokenTTL time.Duration
+	logger     logging.Logger
+}
+
+//? keyFile is PEM encoded RSA private key. without it key is generated on start and ID tokens don't survive restart
+func NewService(accountService accounts.Service, issuer, keyFile string, idTokenTTL time.Duration, logger logging.Logger) (Service, error) {
+	var key *rsa.PrivateKey
+	if keyFile == "" {
+		logger.Warn("oidc signing key is not configured. generating ephemeral key")
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key. error: %w", err)
+		}
+	} else {
+		pemBytes, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key. error: %w", err)
+		}
+		key, err = jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key. error: %w", err)
+		}
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key. error: %w", err)
+	}
+	sum := sha256.Sum256(der)
+
+	return &service{
+		accounts:   accountService,
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		key:        key,
+		keyID:      base64.RawURLEncoding.EncodeToString(sum[:8]),
+		idTokenTTL: idTokenTTL,
+		logger:     logger,
+	}, nil
+}
+
+type Service interface {
+	Discovery() Discovery
+	JWKS() JWKSet
+	UserInfo(ctx context.Context, principal auth.Principal) (UserInfo, error)
+	IssueIDToken(ctx context.Context, clientID, accountUUID string, scopes []string, nonce string, authTime time.Time) (string, error)
+}
+
+func (s service) Discovery() Discovery {
+	scopes := make([]string, 0, len(oauth.SupportedScopes))
+	for scope := range oauth.SupportedScopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	return Discovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oauth/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth/token",
+		UserInfoEndpoint:                  s.issuer + userInfoURL,
+		JWKSURI:                           s.issuer + jwksURL,
+		IntrospectionEndpoint:             s.issuer + "/oauth/introspect",
+		RevocationEndpoint:                s.issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       s.issuer + "/oauth/device_authorization",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials",
+			"urn:ietf:params:oauth:grant-type:device_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "preferred_username", "locale", "picture", "birthdate"},
+	}
+}
+
+func (s service) JWKS() JWKSet {
+	pub := s.key.PublicKey
+	return JWKSet{Keys: []JWK{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     s.keyID,
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+//? session principal has full access and gets every claim
+func (s service) UserInfo(ctx context.Context, principal auth.Principal) (info UserInfo, err error) {
+	account, err := s.accounts.GetAccount(ctx, principal.AccountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return info, apperror.ErrUnauthorized
+		}
+		return info, err
+	}
+
+	scopes := principal.Scopes
+	if scopes == nil {
+		scopes = []string{auth.ScopeOpenID, auth.ScopeProfile, auth.ScopeEmail}
+	}
+	return NewUserInfo(account, scopes), nil
+}
+
+func (s service) IssueIDToken(ctx context.Context, clientID, accountUUID string, scopes []string, nonce string, authTime time.Time) (string, error) {
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return "", err
+	}
+	info := NewUserInfo(account, scopes)
+
+	tNow := time.Now()
+	claims := IDTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.issuer,
+			Subject:   info.Subject,
+			Audience:  clientID,
+			IssuedAt:  tNow.Unix(),
+			ExpiresAt: tNow.Add(s.idTokenTTL).Unix(),
+		},
+		Nonce:             nonce,
+		AZP:               clientID,
+		Email:             info.Email,
+		PreferredUsername: info.PreferredUsername,
+		Locale:            info.Locale,
+		Picture:           info.Picture,
+		Birthdate:         info.Birthdate,
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = s.keyID
+	return t.SignedString(s.key)
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/otp"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ otp.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	attempts   *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection, attempts string, logger logging.Logger) otp.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		attempts:   storage.Collection(attempts),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+//? expired codes and attempt windows are removed by mongo TTL monitor
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, c := range []*mongo.Collection{s.collection, s.attempts} {
+		_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.M{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			s.logger.Errorf("failed to create otp indexes. error: %v", err)
+		}
+	}
+}
+
+//? new code replaces previous one of the same account and purpose
+func (s *db) Save(ctx context.Context, code otp.Code) error {
+	filter := bson.M{"_id": code.ID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.ReplaceOne(ctx, filter, code, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (c otp.Code, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c, apperror.ErrNotFound
+		}
+		return c, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&c); err != nil {
+		return c, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return c, nil
+}
+
+func (s *db) Delete(ctx context.Context, id string) error {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+//? window starts with first attempt. used up window does not match filter, so upsert hits duplicate _id
+func (s *db) CountAttempt(ctx context.Context, id string, maxAttempts int, window time.Duration) error {
+	filter := bson.M{"_id": id, "count": bson.M{"$lt": maxAttempts}}
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"expires_at": time.Now().Add(window)},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.attempts.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrNotFound
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	return nil
+}
+
+func (s *db) ResetAttempts(ctx context.Context, id string) error {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.attempts.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package otp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	loginSendURL    = "/api/login/otp/send"
+	loginVerifyURL  = "/api/login/otp/verify"
+	stepUpURL       = "/api/account/:uuid/otp"
+	secondFactorURL = "/api/account/:uuid/mfa/email"
+)
+
+type Handler struct {
+	Logger     logging.Logger
+	OTPService Service
+	Login      *accounts.Login
+	Auth       *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, loginSendURL, apperror.Middleware(h.SendLoginCode))
+	router.HandlerFunc(http.MethodPost, loginVerifyURL, apperror.Middleware(h.VerifyLoginCode))
+	router.HandlerFunc(http.MethodPost, stepUpURL, apperror.Middleware(h.Auth.Owner(h.SendStepUpCode)))
+	router.HandlerFunc(http.MethodPut, secondFactorURL, apperror.Middleware(h.Auth.Owner(h.Auth.NotImpersonated(h.EnableSecondFactor))))
+	router.HandlerFunc(http.MethodDelete, secondFactorURL, apperror.Middleware(h.Auth.Fresh(h.DisableSecondFactor)))
+}
+
+func (h *Handler) SendLoginCode(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("SEND LOGIN CODE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode send login code dto")
+	var dto SendLoginCodeDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	err := h.OTPService.SendLoginCode(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *Handler) VerifyLoginCode(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("VERIFY LOGIN CODE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode verify login code dto")
+	var dto VerifyLoginCodeDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	account, err := h.OTPService.VerifyLoginCode(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+
+	return h.Login.Complete(w, r, account)
+}
+
+func (h *Handler) SendStepUpCode(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("SEND STEP UP CODE")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	err := h.OTPService.SendStepUpCode(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *Handler) EnableSecondFactor(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("ENABLE EMAIL SECOND FACTOR")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	err := h.OTPService.EnableSecondFactor(r.Context(), accountUUID, r.Header.Get(auth.VerificationCodeHeader))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) DisableSecondFactor(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DISABLE EMAIL SECOND FACTOR")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	err := h.OTPService.DisableSecondFactor(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
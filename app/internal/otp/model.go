@@ -0,0 +1,55 @@
+package otp
+
+import (
+	"time"
+)
+
+const (
+	purposeLogin  = "login"
+	purposeStepUp = "step_up"
+)
+
+// Code is one time code sent by email. only one active code per account and purpose is kept
+type Code struct {
+	ID          string    `bson:"_id"`
+	AccountUUID string    `bson:"account_uuid"`
+	Purpose     string    `bson:"purpose"`
+	Salt        string    `bson:"salt"`
+	Hash        string    `bson:"hash"`
+	CreatedAt   int64     `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Attempts counts verification attempts of account and purpose. it outlives codes, so resend does not
+// give new attempts. counter is removed when window expires or code is verified
+type Attempts struct {
+	ID        string    `bson:"_id"`
+	Count     int       `bson:"count"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type SendLoginCodeDTO struct {
+	Ticket string `json:"ticket"`
+}
+
+type VerifyLoginCodeDTO struct {
+	Ticket string `json:"ticket"`
+	Code   string `json:"code"`
+}
+
+func NewCode(accountUUID, purpose, salt, hash string, ttl time.Duration) Code {
+	tNow := time.Now()
+	return Code{
+		ID:          codeID(accountUUID, purpose),
+		AccountUUID: accountUUID,
+		Purpose:     purpose,
+		Salt:        salt,
+		Hash:        hash,
+		CreatedAt:   tNow.UnixNano(),
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
+
+func codeID(accountUUID, purpose string) string {
+	return purpose + ":" + accountUUID
+}
@@ -0,0 +1,208 @@
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/internal/mfa"
+	"github.com/charopevez/eob-accountant-worker/internal/sessions"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/mail"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ sessions.CodeVerifier = &service{}
+var _ auth.StepUpVerifier = &service{}
+
+type service struct {
+	storage        Storage
+	accounts       accounts.Service
+	mfa            mfa.Service
+	sender         mail.Sender
+	ttl            time.Duration
+	resendInterval time.Duration
+	maxAttempts    int
+	attemptWindow  time.Duration
+	logger         logging.Logger
+}
+
+func NewService(codeStorage Storage, accountService accounts.Service, mfaService mfa.Service, sender mail.Sender,
+	ttl, resendInterval time.Duration, maxAttempts int, attemptWindow time.Duration, logger logging.Logger) (Service, error) {
+	return &service{
+		storage:        codeStorage,
+		accounts:       accountService,
+		mfa:            mfaService,
+		sender:         sender,
+		ttl:            ttl,
+		resendInterval: resendInterval,
+		maxAttempts:    maxAttempts,
+		attemptWindow:  attemptWindow,
+		logger:         logger,
+	}, nil
+}
+
+type Service interface {
+	SendLoginCode(ctx context.Context, dto SendLoginCodeDTO) error
+	VerifyLoginCode(ctx context.Context, dto VerifyLoginCodeDTO) (accounts.Account, error)
+	SendStepUpCode(ctx context.Context, accountUUID string) error
+	VerifyStepUp(ctx context.Context, accountUUID, code string) error
+	EnableSecondFactor(ctx context.Context, accountUUID, code string) error
+	DisableSecondFactor(ctx context.Context, accountUUID string) error
+}
+
+//? send code for second step of login
+func (s service) SendLoginCode(ctx context.Context, dto SendLoginCodeDTO) error {
+	s.logger.Debug("check login ticket")
+	ticket, err := s.mfa.Peek(ctx, dto.Ticket)
+	if err != nil {
+		return err
+	}
+	if !ticket.Allows(mfa.FactorEmail) {
+		return apperror.ErrTicketInvalid
+	}
+
+	account, err := s.accounts.GetAccount(ctx, ticket.AccountUUID)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, account, purposeLogin)
+}
+
+func (s service) VerifyLoginCode(ctx context.Context, dto VerifyLoginCodeDTO) (account accounts.Account, err error) {
+	s.logger.Debug("check login ticket")
+	ticket, err := s.mfa.Peek(ctx, dto.Ticket)
+	if err != nil {
+		return account, err
+	}
+	if err = s.verify(ctx, ticket.AccountUUID, purposeLogin, dto.Code); err != nil {
+		return account, err
+	}
+
+	s.logger.Debug("redeem login ticket")
+	accountUUID, err := s.mfa.Redeem(ctx, dto.Ticket, mfa.FactorEmail)
+	if err != nil {
+		return account, err
+	}
+
+	account, err = s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return account, err
+	}
+	if err = account.CheckSignIn(); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (s service) SendStepUpCode(ctx context.Context, accountUUID string) error {
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, account, purposeStepUp)
+}
+
+//? verify code sent before sensitive operation
+func (s service) VerifyStepUp(ctx context.Context, accountUUID, code string) error {
+	if code == "" {
+		return apperror.ErrStepUpRequired
+	}
+	return s.verify(ctx, accountUUID, purposeStepUp, code)
+}
+
+//? enabling email factor proves the mailbox is reachable
+func (s service) EnableSecondFactor(ctx context.Context, accountUUID, code string) error {
+	if err := s.VerifyStepUp(ctx, accountUUID, code); err != nil {
+		return err
+	}
+	return s.accounts.EnableSecondFactor(ctx, accountUUID, mfa.FactorEmail)
+}
+
+func (s service) DisableSecondFactor(ctx context.Context, accountUUID string) error {
+	return s.accounts.DisableSecondFactor(ctx, accountUUID, mfa.FactorEmail)
+}
+
+func (s service) send(ctx context.Context, account accounts.Account, purpose string) error {
+	existing, err := s.storage.FindOne(ctx, codeID(account.UUID, purpose))
+	if err == nil && time.Since(time.Unix(0, existing.CreatedAt)) < s.resendInterval {
+		return apperror.BadRequestError("code was sent recently. please wait before requesting a new one")
+	}
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return fmt.Errorf("failed to find code. error: %w", err)
+	}
+
+	s.logger.Debug("generate one time code")
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return fmt.Errorf("failed to generate code. error: %w", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	salt, err := token.New(16)
+	if err != nil {
+		return err
+	}
+
+	if err = s.storage.Save(ctx, NewCode(account.UUID, purpose, salt, token.Hash(salt+code), s.ttl)); err != nil {
+		return fmt.Errorf("failed to save code. error: %w", err)
+	}
+
+	err = s.sender.Send(ctx, mail.Message{
+		To:      account.Email,
+		Subject: "Your verification code",
+		Body: fmt.Sprintf("Your verification code is %s. It expires in %s.\n\n"+
+			"If you did not request it, please change your password.\n", code, s.ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send code. error: %w", err)
+	}
+
+	return nil
+}
+
+//? every attempt is counted per account before comparing, so resent codes share attempts of the window.
+//? code and attempts are removed after success
+func (s service) verify(ctx context.Context, accountUUID, purpose, code string) error {
+	id := codeID(accountUUID, purpose)
+	err := s.storage.CountAttempt(ctx, id, s.maxAttempts, s.attemptWindow)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrCodeAttempts
+		}
+		return fmt.Errorf("failed to count attempt. error: %w", err)
+	}
+
+	c, err := s.storage.FindOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrCodeInvalid
+		}
+		return fmt.Errorf("failed to find code. error: %w", err)
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return apperror.ErrCodeInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash(c.Salt+code)), []byte(c.Hash)) != 1 {
+		return apperror.ErrCodeInvalid
+	}
+
+	if err = s.storage.Delete(ctx, id); err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrCodeInvalid
+		}
+		return fmt.Errorf("failed to delete code. error: %w", err)
+	}
+	if err = s.storage.ResetAttempts(ctx, id); err != nil {
+		s.logger.Errorf("failed to reset otp attempts. error: %v", err)
+	}
+	return nil
+}
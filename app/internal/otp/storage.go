@@ -0,0 +1,14 @@
+package otp
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	Save(ctx context.Context, code Code) error
+	FindOne(ctx context.Context, id string) (Code, error)
+	Delete(ctx context.Context, id string) error
+	CountAttempt(ctx context.Context, id string, maxAttempts int, window time.Duration) error
+	ResetAttempts(ctx context.Context, id string) error
+}
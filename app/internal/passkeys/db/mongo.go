@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/passkeys"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ passkeys.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	ceremonies *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection, ceremonies string, logger logging.Logger) passkeys.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		ceremonies: storage.Collection(ceremonies),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"account_uuid": 1},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create passkey indexes. error: %v", err)
+	}
+	_, err = s.ceremonies.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create ceremony indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, passkey passkeys.Passkey) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, passkey)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindOne(ctx context.Context, id string) (p passkeys.Passkey, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return p, apperror.ErrNotFound
+		}
+		return p, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&p); err != nil {
+		return p, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return p, nil
+}
+
+func (s *db) FindByAccount(ctx context.Context, accountUUID string) (p []passkeys.Passkey, err error) {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return p, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	p = make([]passkeys.Passkey, 0)
+	if err = cursor.All(ctx, &p); err != nil {
+		return p, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+
+	return p, nil
+}
+
+func (s *db) UpdateSignCount(ctx context.Context, id string, signCount uint32, usedAt int64) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{"sign_count": signCount, "last_used_at": usedAt},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *db) Delete(ctx context.Context, accountUUID, id string) error {
+	filter := bson.M{"_id": id, "account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+func (s *db) CreateCeremony(ctx context.Context, ceremony passkeys.Ceremony) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.ceremonies.InsertOne(ctx, ceremony)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) TakeCeremony(ctx context.Context, id string) (c passkeys.Ceremony, err error) {
+	filter := bson.M{"_id": id}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.ceremonies.FindOneAndDelete(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c, apperror.ErrNotFound
+		}
+		return c, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&c); err != nil {
+		return c, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return c, nil
+}
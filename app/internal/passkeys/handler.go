@@ -0,0 +1,222 @@
+package passkeys
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	passkeysURL       = "/api/account/:uuid/passkeys"
+	passkeyURL        = "/api/account/:uuid/passkeys/:id"
+	registerBeginURL  = "/api/account/:uuid/passkeys/register/begin"
+	registerFinishURL = "/api/account/:uuid/passkeys/register/finish"
+	secondFactorURL   = "/api/account/:uuid/mfa/webauthn"
+	loginBeginURL     = "/api/login/passkey/begin"
+	loginFinishURL    = "/api/login/passkey/finish"
+)
+
+type Handler struct {
+	Logger         logging.Logger
+	PasskeyService Service
+	Login          *accounts.Login
+	Auth           *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, loginBeginURL, apperror.Middleware(h.BeginLogin))
+	router.HandlerFunc(http.MethodPost, loginFinishURL, apperror.Middleware(h.FinishLogin))
+	router.HandlerFunc(http.MethodPost, registerBeginURL, apperror.Middleware(h.Auth.Self(h.BeginRegistration)))
+	router.HandlerFunc(http.MethodPost, registerFinishURL, apperror.Middleware(h.Auth.Self(h.FinishRegistration)))
+	router.HandlerFunc(http.MethodGet, passkeysURL, apperror.Middleware(h.Auth.Owner(h.GetPasskeys, auth.ScopeAccountRead)))
+	router.HandlerFunc(http.MethodDelete, passkeyURL, apperror.Middleware(h.Auth.Fresh(h.DeletePasskey)))
+	router.HandlerFunc(http.MethodPut, secondFactorURL, apperror.Middleware(h.Auth.Fresh(h.EnableSecondFactor)))
+	router.HandlerFunc(http.MethodDelete, secondFactorURL, apperror.Middleware(h.Auth.Fresh(h.DisableSecondFactor)))
+}
+
+func (h *Handler) BeginRegistration(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("BEGIN PASSKEY REGISTRATION")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	h.Logger.Debug("decode begin registration dto")
+	var dto BeginRegistrationDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	ceremony, err := h.PasskeyService.BeginRegistration(r.Context(), accountUUID, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal creation options")
+	ceremonyBytes, err := json.Marshal(ceremony)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(ceremonyBytes)
+
+	return nil
+}
+
+func (h *Handler) FinishRegistration(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("FINISH PASSKEY REGISTRATION")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	h.Logger.Debug("decode finish registration dto")
+	var dto FinishRegistrationDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	passkey, err := h.PasskeyService.FinishRegistration(r.Context(), accountUUID, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal passkey")
+	passkeyBytes, err := json.Marshal(passkey)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(passkeyBytes)
+
+	return nil
+}
+
+func (h *Handler) BeginLogin(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("BEGIN PASSKEY LOGIN")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode begin login dto")
+	var dto BeginLoginDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	ceremony, err := h.PasskeyService.BeginLogin(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal request options")
+	ceremonyBytes, err := json.Marshal(ceremony)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(ceremonyBytes)
+
+	return nil
+}
+
+func (h *Handler) FinishLogin(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("FINISH PASSKEY LOGIN")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode finish login dto")
+	var dto FinishLoginDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	account, err := h.PasskeyService.FinishLogin(r.Context(), dto)
+	if err != nil {
+		return err
+	}
+
+	return h.Login.Complete(w, r, account)
+}
+
+func (h *Handler) GetPasskeys(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET PASSKEYS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	passkeys, err := h.PasskeyService.GetPasskeys(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal passkeys")
+	passkeysBytes, err := json.Marshal(passkeys)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(passkeysBytes)
+
+	return nil
+}
+
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DELETE PASSKEY")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	passkeyID := params.ByName("id")
+
+	err := h.PasskeyService.Delete(r.Context(), accountUUID, passkeyID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) EnableSecondFactor(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("ENABLE PASSKEY SECOND FACTOR")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	err := h.PasskeyService.EnableSecondFactor(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) DisableSecondFactor(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DISABLE PASSKEY SECOND FACTOR")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	err := h.PasskeyService.DisableSecondFactor(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package passkeys
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/pkg/webauthn"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+type Passkey struct {
+	ID          string   `json:"id" bson:"_id"`
+	AccountUUID string   `json:"-" bson:"account_uuid"`
+	Name        string   `json:"name" bson:"name,omitempty"`
+	PublicKey   []byte   `json:"-" bson:"public_key"`
+	Algorithm   int64    `json:"algorithm" bson:"alg"`
+	SignCount   uint32   `json:"-" bson:"sign_count"`
+	Transports  []string `json:"transports" bson:"transports,omitempty"`
+	AAGUID      string   `json:"aaguid" bson:"aaguid,omitempty"`
+	CreatedAt   int64    `json:"created_at" bson:"created_at"`
+	LastUsedAt  int64    `json:"last_used_at" bson:"last_used_at,omitempty"`
+}
+
+func (p *Passkey) Credential() webauthn.Credential {
+	id, _ := webauthn.Decode(p.ID)
+	return webauthn.Credential{
+		ID:         id,
+		PublicKey:  p.PublicKey,
+		Algorithm:  p.Algorithm,
+		SignCount:  p.SignCount,
+		Transports: p.Transports,
+	}
+}
+
+func (p *Passkey) Descriptor() webauthn.CredentialDescriptor {
+	return webauthn.CredentialDescriptor{
+		Type:       "public-key",
+		ID:         p.ID,
+		Transports: p.Transports,
+	}
+}
+
+// Ceremony keeps issued challenge between begin and finish requests
+type Ceremony struct {
+	ID          string    `bson:"_id"`
+	Kind        string    `bson:"kind"`
+	AccountUUID string    `bson:"account_uuid,omitempty"`
+	Name        string    `bson:"name,omitempty"`
+	Challenge   []byte    `bson:"challenge"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type BeginRegistrationDTO struct {
+	Name string `json:"name"`
+}
+
+type FinishRegistrationDTO struct {
+	Ceremony   string                       `json:"ceremony"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+// BeginLoginDTO carries login ticket when passkey is used as second factor
+type BeginLoginDTO struct {
+	Ticket string `json:"ticket,omitempty"`
+}
+
+type FinishLoginDTO struct {
+	Ceremony   string                     `json:"ceremony"`
+	Ticket     string                     `json:"ticket,omitempty"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// CeremonyDTO is passed to navigator.credentials as publicKey option
+type CeremonyDTO struct {
+	Ceremony  string      `json:"ceremony"`
+	PublicKey interface{} `json:"publicKey"`
+}
+
+func NewPasskey(accountUUID, name string, cred webauthn.Credential) Passkey {
+	return Passkey{
+		ID:          webauthn.Encode(cred.ID),
+		AccountUUID: accountUUID,
+		Name:        name,
+		PublicKey:   cred.PublicKey,
+		Algorithm:   cred.Algorithm,
+		SignCount:   cred.SignCount,
+		Transports:  cred.Transports,
+		AAGUID:      webauthn.Encode(cred.AAGUID),
+		CreatedAt:   time.Now().UnixNano(),
+	}
+}
+
+func NewCeremony(id, kind, accountUUID string, challenge []byte, ttl time.Duration) Ceremony {
+	return Ceremony{
+		ID:          id,
+		Kind:        kind,
+		AccountUUID: accountUUID,
+		Challenge:   challenge,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+}
@@ -0,0 +1,303 @@
+package passkeys
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/mfa"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+	"github.com/charopevez/eob-accountant-worker/pkg/webauthn"
+)
+
+var _ Service = &service{}
+
+type service struct {
+	storage  Storage
+	accounts accounts.Service
+	mfa      mfa.Service
+	rp       *webauthn.RelyingParty
+	logger   logging.Logger
+}
+
+func NewService(passkeyStorage Storage, accountService accounts.Service, mfaService mfa.Service,
+	rp *webauthn.RelyingParty, logger logging.Logger) (Service, error) {
+	return &service{
+		storage:  passkeyStorage,
+		accounts: accountService,
+		mfa:      mfaService,
+		rp:       rp,
+		logger:   logger,
+	}, nil
+}
+
+type Service interface {
+	BeginRegistration(ctx context.Context, accountUUID string, dto BeginRegistrationDTO) (CeremonyDTO, error)
+	FinishRegistration(ctx context.Context, accountUUID string, dto FinishRegistrationDTO) (Passkey, error)
+	BeginLogin(ctx context.Context, dto BeginLoginDTO) (CeremonyDTO, error)
+	FinishLogin(ctx context.Context, dto FinishLoginDTO) (accounts.Account, error)
+	GetPasskeys(ctx context.Context, accountUUID string) ([]Passkey, error)
+	Delete(ctx context.Context, accountUUID, id string) error
+	EnableSecondFactor(ctx context.Context, accountUUID string) error
+	DisableSecondFactor(ctx context.Context, accountUUID string) error
+}
+
+//? issue creation options for logged in account
+func (s service) BeginRegistration(ctx context.Context, accountUUID string, dto BeginRegistrationDTO) (c CeremonyDTO, err error) {
+	s.logger.Debug("get account by uuid")
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return c, err
+	}
+
+	s.logger.Debug("exclude already registered passkeys")
+	passkeys, err := s.GetPasskeys(ctx, accountUUID)
+	if err != nil {
+		return c, err
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, p := range passkeys {
+		exclude = append(exclude, p.Descriptor())
+	}
+
+	displayName := account.Username
+	if displayName == "" {
+		displayName = account.Email
+	}
+	user := webauthn.User{
+		ID:          []byte(account.UUID),
+		Name:        account.Email,
+		DisplayName: displayName,
+	}
+
+	id, ceremony, err := s.newCeremony(ceremonyRegistration, account.UUID)
+	if err != nil {
+		return c, err
+	}
+	ceremony.Name = dto.Name
+	if err = s.storage.CreateCeremony(ctx, ceremony); err != nil {
+		return c, fmt.Errorf("failed to create ceremony. error: %w", err)
+	}
+
+	return CeremonyDTO{
+		Ceremony:  id,
+		PublicKey: s.rp.CreationOptions(user, ceremony.Challenge, exclude),
+	}, nil
+}
+
+func (s service) FinishRegistration(ctx context.Context, accountUUID string, dto FinishRegistrationDTO) (p Passkey, err error) {
+	ceremony, err := s.takeCeremony(ctx, dto.Ceremony, ceremonyRegistration)
+	if err != nil {
+		return p, err
+	}
+	if ceremony.AccountUUID != accountUUID {
+		return p, apperror.ErrPasskeyInvalid
+	}
+
+	s.logger.Debug("verify attestation")
+	cred, err := s.rp.VerifyRegistration(ceremony.Challenge, dto.Credential)
+	if err != nil {
+		s.logger.Warnf("passkey registration rejected. error: %v", err)
+		return p, apperror.ErrPasskeyInvalid
+	}
+
+	p = NewPasskey(accountUUID, ceremony.Name, cred)
+	if err = s.storage.Create(ctx, p); err != nil {
+		if errors.Is(err, apperror.ErrAlreadyExists) {
+			return p, apperror.BadRequestError("passkey is already registered")
+		}
+		return p, fmt.Errorf("failed to create passkey. error: %w", err)
+	}
+
+	return p, nil
+}
+
+//? issue request options. with ticket passkey is used as second factor
+func (s service) BeginLogin(ctx context.Context, dto BeginLoginDTO) (c CeremonyDTO, err error) {
+	var accountUUID string
+	var allow []webauthn.CredentialDescriptor
+	userVerification := "required"
+
+	if dto.Ticket != "" {
+		s.logger.Debug("check login ticket")
+		ticket, err := s.mfa.Peek(ctx, dto.Ticket)
+		if err != nil {
+			return c, err
+		}
+		if !ticket.Allows(mfa.FactorWebAuthn) {
+			return c, apperror.ErrTicketInvalid
+		}
+		accountUUID = ticket.AccountUUID
+
+		passkeys, err := s.GetPasskeys(ctx, accountUUID)
+		if err != nil {
+			return c, err
+		}
+		for _, p := range passkeys {
+			allow = append(allow, p.Descriptor())
+		}
+		userVerification = "preferred"
+	}
+
+	id, ceremony, err := s.newCeremony(ceremonyLogin, accountUUID)
+	if err != nil {
+		return c, err
+	}
+	if err = s.storage.CreateCeremony(ctx, ceremony); err != nil {
+		return c, fmt.Errorf("failed to create ceremony. error: %w", err)
+	}
+
+	return CeremonyDTO{
+		Ceremony:  id,
+		PublicKey: s.rp.RequestOptions(ceremony.Challenge, allow, userVerification),
+	}, nil
+}
+
+func (s service) FinishLogin(ctx context.Context, dto FinishLoginDTO) (account accounts.Account, err error) {
+	ceremony, err := s.takeCeremony(ctx, dto.Ceremony, ceremonyLogin)
+	if err != nil {
+		return account, err
+	}
+
+	s.logger.Debug("find passkey by credential id")
+	p, err := s.storage.FindOne(ctx, dto.Credential.ID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return account, apperror.ErrPasskeyInvalid
+		}
+		return account, fmt.Errorf("failed to find passkey. error: %w", err)
+	}
+	if ceremony.AccountUUID != "" && ceremony.AccountUUID != p.AccountUUID {
+		return account, apperror.ErrPasskeyInvalid
+	}
+	if dto.Credential.Response.UserHandle != "" {
+		userHandle, err := webauthn.Decode(dto.Credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, []byte(p.AccountUUID)) {
+			return account, apperror.ErrPasskeyInvalid
+		}
+	}
+
+	s.logger.Debug("verify assertion")
+	cred, err := s.rp.VerifyAssertion(ceremony.Challenge, p.Credential(), dto.Credential)
+	if err != nil {
+		s.logger.Warnf("passkey assertion rejected for account %s. error: %v", p.AccountUUID, err)
+		return account, apperror.ErrPasskeyInvalid
+	}
+	//? passwordless login must prove user verification, second factor needs presence only
+	if ceremony.AccountUUID == "" && !cred.UserVerified {
+		return account, apperror.ErrPasskeyInvalid
+	}
+
+	err = s.storage.UpdateSignCount(ctx, p.ID, cred.SignCount, time.Now().UnixNano())
+	if err != nil {
+		return account, fmt.Errorf("failed to update passkey. error: %w", err)
+	}
+
+	if ceremony.AccountUUID != "" {
+		s.logger.Debug("redeem login ticket")
+		accountUUID, err := s.mfa.Redeem(ctx, dto.Ticket, mfa.FactorWebAuthn)
+		if err != nil {
+			return account, err
+		}
+		if accountUUID != p.AccountUUID {
+			return account, apperror.ErrTicketInvalid
+		}
+	}
+
+	account, err = s.accounts.GetAccount(ctx, p.AccountUUID)
+	if err != nil {
+		return account, err
+	}
+	if err = account.CheckSignIn(); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (s service) GetPasskeys(ctx context.Context, accountUUID string) ([]Passkey, error) {
+	passkeys, err := s.storage.FindByAccount(ctx, accountUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find passkeys. error: %w", err)
+	}
+	return passkeys, nil
+}
+
+func (s service) Delete(ctx context.Context, accountUUID, id string) error {
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return err
+	}
+	passkeys, err := s.GetPasskeys(ctx, accountUUID)
+	if err != nil {
+		return err
+	}
+	if len(passkeys) == 1 && hasFactor(account, mfa.FactorWebAuthn) {
+		return apperror.BadRequestError("disable passkey second factor before removing last passkey")
+	}
+
+	err = s.storage.Delete(ctx, accountUUID, id)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete passkey. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) EnableSecondFactor(ctx context.Context, accountUUID string) error {
+	passkeys, err := s.GetPasskeys(ctx, accountUUID)
+	if err != nil {
+		return err
+	}
+	if len(passkeys) == 0 {
+		return apperror.BadRequestError("register passkey before enabling it as second factor")
+	}
+	return s.accounts.EnableSecondFactor(ctx, accountUUID, mfa.FactorWebAuthn)
+}
+
+func (s service) DisableSecondFactor(ctx context.Context, accountUUID string) error {
+	return s.accounts.DisableSecondFactor(ctx, accountUUID, mfa.FactorWebAuthn)
+}
+
+func (s service) newCeremony(kind, accountUUID string) (string, Ceremony, error) {
+	id, err := token.New(32)
+	if err != nil {
+		return "", Ceremony{}, err
+	}
+	challenge, err := token.Bytes(32)
+	if err != nil {
+		return "", Ceremony{}, err
+	}
+	return id, NewCeremony(token.Hash(id), kind, accountUUID, challenge, s.rp.Timeout), nil
+}
+
+//? ceremonies are single use, so it is removed on first finish attempt
+func (s service) takeCeremony(ctx context.Context, id, kind string) (c Ceremony, err error) {
+	c, err = s.storage.TakeCeremony(ctx, token.Hash(id))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return c, apperror.ErrPasskeyInvalid
+		}
+		return c, fmt.Errorf("failed to find ceremony. error: %w", err)
+	}
+	if c.Kind != kind || time.Now().After(c.ExpiresAt) {
+		return c, apperror.ErrPasskeyInvalid
+	}
+	return c, nil
+}
+
+func hasFactor(account accounts.Account, factor string) bool {
+	for _, f := range account.MFA {
+		if f == factor {
+			return true
+		}
+	}
+	return false
+}
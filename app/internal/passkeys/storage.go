@@ -0,0 +1,15 @@
+package passkeys
+
+import (
+	"context"
+)
+
+type Storage interface {
+	Create(ctx context.Context, passkey Passkey) error
+	FindOne(ctx context.Context, id string) (Passkey, error)
+	FindByAccount(ctx context.Context, accountUUID string) ([]Passkey, error)
+	UpdateSignCount(ctx context.Context, id string, signCount uint32, usedAt int64) error
+	Delete(ctx context.Context, accountUUID, id string) error
+	CreateCeremony(ctx context.Context, ceremony Ceremony) error
+	TakeCeremony(ctx context.Context, id string) (Ceremony, error)
+}
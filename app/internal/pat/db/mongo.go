@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/pat"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ pat.Storage = &db{}
+
+type db struct {
+	collection *mongo.Collection
+	logger     logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, collection string, logger logging.Logger) pat.Storage {
+	s := &db{
+		collection: storage.Collection(collection),
+		logger:     logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"account_uuid": 1}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create personal access token indexes. error: %v", err)
+	}
+}
+
+func (s *db) Create(ctx context.Context, t pat.PersonalAccessToken) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, t)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindByHash(ctx context.Context, hash string) (t pat.PersonalAccessToken, err error) {
+	filter := bson.M{"hash": hash}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.collection.FindOne(ctx, filter)
+	err = result.Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return t, apperror.ErrNotFound
+		}
+		return t, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err = result.Decode(&t); err != nil {
+		return t, fmt.Errorf("failed to decode document. error: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *db) FindByAccount(ctx context.Context, accountUUID string) (tokens []pat.PersonalAccessToken, err error) {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	tokens = make([]pat.PersonalAccessToken, 0)
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *db) UpdateLastUsed(ctx context.Context, id string, usedAt time.Time, ip string) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{"last_used_at": usedAt, "last_used_ip": ip},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *db) Delete(ctx context.Context, accountUUID, id string) error {
+	filter := bson.M{"_id": id, "account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return apperror.ErrNotFound
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
+
+func (s *db) DeleteByAccount(ctx context.Context, accountUUID string) error {
+	filter := bson.M{"account_uuid": accountUUID}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+
+	s.logger.Tracef("Deleted %v documents.\n", result.DeletedCount)
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package pat
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	tokensURL = "/api/account/:uuid/tokens"
+	tokenURL  = "/api/account/:uuid/tokens/:id"
+)
+
+type Handler struct {
+	Logger     logging.Logger
+	PATService Service
+	Auth       *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, tokensURL, apperror.Middleware(h.Auth.Fresh(h.CreateToken)))
+	router.HandlerFunc(http.MethodGet, tokensURL, apperror.Middleware(h.Auth.Owner(h.GetTokens)))
+	router.HandlerFunc(http.MethodDelete, tokenURL, apperror.Middleware(h.Auth.Owner(h.RevokeToken)))
+}
+
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("CREATE PERSONAL ACCESS TOKEN")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	h.Logger.Debug("decode create token dto")
+	var dto CreateTokenDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	created, err := h.PATService.Create(r.Context(), accountUUID, dto)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal personal access token")
+	createdBytes, err := json.Marshal(created)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(createdBytes)
+
+	return nil
+}
+
+func (h *Handler) GetTokens(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET PERSONAL ACCESS TOKENS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	tokens, err := h.PATService.GetTokens(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal personal access tokens")
+	tokensBytes, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(tokensBytes)
+
+	return nil
+}
+
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REVOKE PERSONAL ACCESS TOKEN")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	id := params.ByName("id")
+
+	err := h.PATService.Revoke(r.Context(), accountUUID, id)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
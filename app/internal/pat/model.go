@@ -0,0 +1,54 @@
+package pat
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+)
+
+// Prefix marks personal access tokens so other tokens are skipped without lookup
+const Prefix = "eobpat_"
+
+// AllowedScopes are scopes personal access token may carry. admin scope needs admin account
+var AllowedScopes = map[string]bool{
+	auth.ScopeAccountRead:  true,
+	auth.ScopeAccountWrite: true,
+	auth.ScopeAdmin:        true,
+}
+
+// PersonalAccessToken is long lived token created by account owner. only hash of secret is stored
+type PersonalAccessToken struct {
+	ID          string     `json:"id" bson:"_id"`
+	Hash        string     `json:"-" bson:"hash"`
+	AccountUUID string     `json:"-" bson:"account_uuid"`
+	Name        string     `json:"name" bson:"name"`
+	Scopes      []string   `json:"scopes" bson:"scopes"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at" bson:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty" bson:"last_used_ip,omitempty"`
+}
+
+type CreateTokenDTO struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreatedTokenDTO carries token secret. it is shown only once
+type CreatedTokenDTO struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+func NewPersonalAccessToken(id, hash, accountUUID string, dto CreateTokenDTO) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:          id,
+		Hash:        hash,
+		AccountUUID: accountUUID,
+		Name:        dto.Name,
+		Scopes:      dto.Scopes,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   dto.ExpiresAt,
+	}
+}
@@ -0,0 +1,162 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ auth.Authenticator = &service{}
+
+type service struct {
+	storage    Storage
+	accounts   accounts.Service
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	logger     logging.Logger
+}
+
+func NewService(patStorage Storage, accountService accounts.Service, defaultTTL, maxTTL time.Duration,
+	logger logging.Logger) (Service, error) {
+	return &service{
+		storage:    patStorage,
+		accounts:   accountService,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+		logger:     logger,
+	}, nil
+}
+
+type Service interface {
+	Create(ctx context.Context, accountUUID string, dto CreateTokenDTO) (CreatedTokenDTO, error)
+	GetTokens(ctx context.Context, accountUUID string) ([]PersonalAccessToken, error)
+	Revoke(ctx context.Context, accountUUID, id string) error
+	RevokeAll(ctx context.Context, accountUUID string) error
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+}
+
+func (s service) Create(ctx context.Context, accountUUID string, dto CreateTokenDTO) (created CreatedTokenDTO, err error) {
+	if strings.TrimSpace(dto.Name) == "" || len(dto.Scopes) == 0 {
+		return created, apperror.BadRequestError("name and scopes are required")
+	}
+
+	account, err := s.accounts.GetAccount(ctx, accountUUID)
+	if err != nil {
+		return created, err
+	}
+	for _, scope := range dto.Scopes {
+		if !AllowedScopes[scope] {
+			return created, apperror.BadRequestError(fmt.Sprintf("unsupported scope %q", scope))
+		}
+		if scope == auth.ScopeAdmin && !account.IsAdmin {
+			return created, apperror.ErrForbidden
+		}
+	}
+
+	tNow := time.Now()
+	if dto.ExpiresAt.IsZero() {
+		dto.ExpiresAt = tNow.Add(s.defaultTTL)
+	}
+	if dto.ExpiresAt.Before(tNow) || dto.ExpiresAt.After(tNow.Add(s.maxTTL)) {
+		return created, apperror.BadRequestError(fmt.Sprintf("expiry must be within %s", s.maxTTL))
+	}
+
+	s.logger.Debug("generate personal access token")
+	id, err := token.New(8)
+	if err != nil {
+		return created, err
+	}
+	secret, err := token.New(32)
+	if err != nil {
+		return created, err
+	}
+	raw := Prefix + secret
+
+	t := NewPersonalAccessToken(id, token.Hash(raw), accountUUID, dto)
+	if err = s.storage.Create(ctx, t); err != nil {
+		return created, fmt.Errorf("failed to create personal access token. error: %w", err)
+	}
+	return CreatedTokenDTO{PersonalAccessToken: t, Token: raw}, nil
+}
+
+func (s service) GetTokens(ctx context.Context, accountUUID string) ([]PersonalAccessToken, error) {
+	tokens, err := s.storage.FindByAccount(ctx, accountUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find personal access tokens. error: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s service) Revoke(ctx context.Context, accountUUID, id string) error {
+	err := s.storage.Delete(ctx, accountUUID, id)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete personal access token. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) RevokeAll(ctx context.Context, accountUUID string) error {
+	if err := s.storage.DeleteByAccount(ctx, accountUUID); err != nil {
+		return fmt.Errorf("failed to delete personal access tokens. error: %w", err)
+	}
+	return nil
+}
+
+//? every use is recorded with time and client address
+func (s service) Authenticate(ctx context.Context, raw string) (p auth.Principal, err error) {
+	if !strings.HasPrefix(raw, Prefix) {
+		return p, apperror.ErrUnauthorized
+	}
+
+	t, err := s.storage.FindByHash(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, fmt.Errorf("failed to find personal access token. error: %w", err)
+	}
+	tNow := time.Now()
+	if tNow.After(t.ExpiresAt) {
+		return p, apperror.ErrUnauthorized
+	}
+
+	account, err := s.accounts.GetAccount(ctx, t.AccountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, err
+	}
+	if err = account.CheckStatus(); err != nil {
+		return p, apperror.ErrUnauthorized
+	}
+
+	if err = s.storage.UpdateLastUsed(ctx, t.ID, tNow, auth.ClientIP(ctx)); err != nil {
+		s.logger.Errorf("failed to record personal access token use. error: %v", err)
+	}
+
+	p = auth.Principal{
+		AccountUUID: account.UUID,
+		AuthTime:    t.CreatedAt,
+		ExpiresAt:   t.ExpiresAt,
+		Scopes:      append([]string{}, t.Scopes...),
+	}
+	for _, scope := range t.Scopes {
+		if scope == auth.ScopeAdmin {
+			p.IsAdmin = account.IsAdmin
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,15 @@
+package pat
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	Create(ctx context.Context, token PersonalAccessToken) error
+	FindByHash(ctx context.Context, hash string) (PersonalAccessToken, error)
+	FindByAccount(ctx context.Context, accountUUID string) ([]PersonalAccessToken, error)
+	UpdateLastUsed(ctx context.Context, id string, usedAt time.Time, ip string) error
+	Delete(ctx context.Context, accountUUID, id string) error
+	DeleteByAccount(ctx context.Context, accountUUID string) error
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/referrals"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ referrals.Storage = &db{}
+
+type db struct {
+	codes     *mongo.Collection
+	referrals *mongo.Collection
+	logger    logging.Logger
+}
+
+func NewStorage(storage *mongo.Database, codes, referrals string, logger logging.Logger) referrals.Storage {
+	s := &db{
+		codes:     storage.Collection(codes),
+		referrals: storage.Collection(referrals),
+		logger:    logger,
+	}
+	s.ensureIndexes()
+	return s
+}
+
+func (s *db) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.codes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"code": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create referral code indexes. error: %v", err)
+	}
+	_, err = s.referrals.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"account_uuid": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"referrer_uuid": 1}},
+		{Keys: bson.M{"created_at": 1}},
+	})
+	if err != nil {
+		s.logger.Errorf("failed to create referral indexes. error: %v", err)
+	}
+}
+
+//? duplicate account or code is reported as already exists
+func (s *db) CreateCode(ctx context.Context, code referrals.Code) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.codes.InsertOne(ctx, code)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) FindCode(ctx context.Context, accountUUID string) (c referrals.Code, err error) {
+	err = s.findOne(ctx, bson.M{"_id": accountUUID}, &c)
+	return c, err
+}
+
+func (s *db) FindByCode(ctx context.Context, code string) (c referrals.Code, err error) {
+	err = s.findOne(ctx, bson.M{"code": code}, &c)
+	return c, err
+}
+
+func (s *db) Create(ctx context.Context, referral referrals.Referral) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := s.referrals.InsertOne(ctx, referral)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return nil
+}
+
+func (s *db) Count(ctx context.Context, referrerUUID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	n, err := s.referrals.CountDocuments(ctx, bson.M{"referrer_uuid": referrerUUID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	return n, nil
+}
+
+//? ties are ordered by account uuid, so that report is stable
+func (s *db) Top(ctx context.Context, from, to time.Time, limit int64) (list []referrals.TopReferrer, err error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$referrer_uuid", "referred": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "referred", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cursor, err := s.referrals.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	list = make([]referrals.TopReferrer, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode documents. error: %w", err)
+	}
+	return list, nil
+}
+
+func (s *db) findOne(ctx context.Context, filter bson.M, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result := s.codes.FindOne(ctx, filter)
+	if err := result.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return apperror.ErrNotFound
+		}
+		return fmt.Errorf("failed to execute query. error: %w", err)
+	}
+	if err := result.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode document. error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package referrals
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	statsURL = "/api/account/:uuid/referrals"
+	topURL   = "/api/referrals/top"
+)
+
+type Handler struct {
+	Logger          logging.Logger
+	ReferralService Service
+	Auth            *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, statsURL, apperror.Middleware(h.Auth.Owner(h.GetStats, auth.ScopeAccountRead)))
+	router.HandlerFunc(http.MethodGet, topURL, apperror.Middleware(h.Auth.Admin(h.GetTopReferrers)))
+}
+
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET REFERRAL STATS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	stats, err := h.ReferralService.GetStats(r.Context(), accountUUID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal referral stats")
+	statsBytes, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(statsBytes)
+
+	return nil
+}
+
+func (h *Handler) GetTopReferrers(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET TOP REFERRERS")
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	var from, to time.Time
+	var limit int64
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return apperror.BadRequestError("from must be RFC3339 time")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return apperror.BadRequestError("to must be RFC3339 time")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return apperror.BadRequestError("limit must be integer")
+		}
+	}
+
+	report, err := h.ReferralService.TopReferrers(r.Context(), from, to, limit)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal referral report")
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(reportBytes)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package referrals
+
+import "time"
+
+// Code is referral code of account. it is created on first request, so every account has one
+// without migrating existing accounts
+type Code struct {
+	AccountUUID string    `json:"account_uuid" bson:"_id"`
+	Code        string    `json:"code" bson:"code"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Referral is account registered with referral code of ReferrerUUID. account is referred once
+type Referral struct {
+	ReferrerUUID string    `json:"referrer_uuid" bson:"referrer_uuid"`
+	AccountUUID  string    `json:"account_uuid" bson:"account_uuid"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+type Stats struct {
+	Code     string `json:"code"`
+	Referred int64  `json:"referred"`
+}
+
+type TopReferrer struct {
+	AccountUUID string `json:"account_uuid" bson:"_id"`
+	Referred    int64  `json:"referred" bson:"referred"`
+}
+
+// Report is referrers with most referrals created in [From, To)
+type Report struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Referrers []TopReferrer `json:"referrers"`
+}
+
+func NewCode(accountUUID, code string) Code {
+	return Code{
+		AccountUUID: accountUUID,
+		Code:        code,
+		CreatedAt:   time.Now(),
+	}
+}
+
+func NewReferral(referrerUUID, accountUUID string) Referral {
+	return Referral{
+		ReferrerUUID: referrerUUID,
+		AccountUUID:  accountUUID,
+		CreatedAt:    time.Now(),
+	}
+}
@@ -0,0 +1,141 @@
+package referrals
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ accounts.Referrals = &service{}
+
+// codes are 8 characters of base32 alphabet
+const (
+	codeBytes    = 5
+	codeAttempts = 3
+	defaultLimit = 10
+	defaultRange = 30 * 24 * time.Hour
+)
+
+var codeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type service struct {
+	storage    Storage
+	maxResults int64
+	logger     logging.Logger
+}
+
+func NewService(referralStorage Storage, maxResults int64, logger logging.Logger) (Service, error) {
+	return &service{
+		storage:    referralStorage,
+		maxResults: maxResults,
+		logger:     logger,
+	}, nil
+}
+
+type Service interface {
+	Referrer(ctx context.Context, code string) (string, error)
+	Track(ctx context.Context, referrerUUID, accountUUID string) error
+	GetStats(ctx context.Context, accountUUID string) (Stats, error)
+	TopReferrers(ctx context.Context, from, to time.Time, limit int64) (Report, error)
+}
+
+func (s service) Referrer(ctx context.Context, code string) (string, error) {
+	c, err := s.storage.FindByCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return "", apperror.ErrReferralInvalid
+		}
+		return "", fmt.Errorf("failed to find referral code. error: %w", err)
+	}
+	return c.AccountUUID, nil
+}
+
+//? account can not refer itself
+func (s service) Track(ctx context.Context, referrerUUID, accountUUID string) error {
+	if referrerUUID == accountUUID {
+		return apperror.ErrReferralInvalid
+	}
+	err := s.storage.Create(ctx, NewReferral(referrerUUID, accountUUID))
+	if err != nil {
+		return fmt.Errorf("failed to create referral. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) GetStats(ctx context.Context, accountUUID string) (stats Stats, err error) {
+	code, err := s.code(ctx, accountUUID)
+	if err != nil {
+		return stats, err
+	}
+	stats.Code = code.Code
+
+	stats.Referred, err = s.storage.Count(ctx, accountUUID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count referrals. error: %w", err)
+	}
+	return stats, nil
+}
+
+//? report covers last 30 days unless range is given
+func (s service) TopReferrers(ctx context.Context, from, to time.Time, limit int64) (report Report, err error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultRange)
+	}
+	if !from.Before(to) {
+		return report, apperror.BadRequestError("from must be before to")
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > s.maxResults {
+		limit = s.maxResults
+	}
+
+	report = Report{From: from, To: to}
+	report.Referrers, err = s.storage.Top(ctx, from, to, limit)
+	if err != nil {
+		return report, fmt.Errorf("failed to find top referrers. error: %w", err)
+	}
+	return report, nil
+}
+
+//? code is created on first request. concurrent request of same account may create it first,
+// and new code may collide with existing one, so creation is retried
+func (s service) code(ctx context.Context, accountUUID string) (code Code, err error) {
+	for i := 0; i < codeAttempts; i++ {
+		code, err = s.storage.FindCode(ctx, accountUUID)
+		if err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, apperror.ErrNotFound) {
+			return code, fmt.Errorf("failed to find referral code. error: %w", err)
+		}
+
+		s.logger.Debug("generate referral code")
+		var b []byte
+		if b, err = token.Bytes(codeBytes); err != nil {
+			return code, err
+		}
+		code = NewCode(accountUUID, codeEncoding.EncodeToString(b))
+		err = s.storage.CreateCode(ctx, code)
+		if err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, apperror.ErrAlreadyExists) {
+			return code, fmt.Errorf("failed to create referral code. error: %w", err)
+		}
+	}
+	return code, fmt.Errorf("failed to create referral code in %d attempts", codeAttempts)
+}
@@ -0,0 +1,15 @@
+package referrals
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	CreateCode(ctx context.Context, code Code) error
+	FindCode(ctx context.Context, accountUUID string) (Code, error)
+	FindByCode(ctx context.Context, code string) (Code, error)
+	Create(ctx context.Context, referral Referral) error
+	Count(ctx context.Context, referrerUUID string) (int64, error)
+	Top(ctx context.Context, from, to time.Time, limit int64) ([]TopReferrer, error)
+}
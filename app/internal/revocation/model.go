@@ -0,0 +1,20 @@
+package revocation
+
+import "time"
+
+// Revocation marks token hash as revoked until token would expire anyway
+type Revocation struct {
+	ID        string    `bson:"_id"`
+	RevokedBy string    `bson:"revoked_by"`
+	RevokedAt time.Time `bson:"revoked_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func NewRevocation(id, revokedBy string, expiresAt time.Time) Revocation {
+	return Revocation{
+		ID:        id,
+		RevokedBy: revokedBy,
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+}
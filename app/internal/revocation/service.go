@@ -0,0 +1,51 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ auth.RevocationChecker = &service{}
+
+type service struct {
+	storage Storage
+	logger  logging.Logger
+}
+
+func NewService(revocationStorage Storage, logger logging.Logger) (Service, error) {
+	return &service{
+		storage: revocationStorage,
+		logger:  logger,
+	}, nil
+}
+
+type Service interface {
+	Revoke(ctx context.Context, token, revokedBy string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, token string) (bool, error)
+}
+
+//? record is kept until token expiry. tokens without expiry are kept for a day
+func (s service) Revoke(ctx context.Context, raw, revokedBy string, expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(24 * time.Hour)
+	}
+	s.logger.Debugf("revoke token on behalf of %s", revokedBy)
+	if err := s.storage.Save(ctx, NewRevocation(token.Hash(raw), revokedBy, expiresAt)); err != nil {
+		return fmt.Errorf("failed to save revocation. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) IsRevoked(ctx context.Context, raw string) (bool, error) {
+	revoked, err := s.storage.Exists(ctx, token.Hash(raw))
+	if err != nil {
+		return false, fmt.Errorf("failed to check revocation. error: %w", err)
+	}
+	return revoked, nil
+}
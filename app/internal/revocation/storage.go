@@ -0,0 +1,8 @@
+package revocation
+
+import "context"
+
+type Storage interface {
+	Save(ctx context.Context, revocation Revocation) error
+	Exists(ctx context.Context, id string) (bool, error)
+}
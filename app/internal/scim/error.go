@@ -0,0 +1,80 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Error is RFC 7644 error response. SCIM routes write it instead of AppError
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Status + " " + e.ScimType + ": " + e.Detail
+}
+
+func (e *Error) status() int {
+	status, err := strconv.Atoi(e.Status)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+func (e *Error) Marshal() []byte {
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return bytes
+}
+
+func newError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func invalidFilter(detail string) *Error {
+	return newError(http.StatusBadRequest, "invalidFilter", detail)
+}
+
+func invalidSyntax(detail string) *Error {
+	return newError(http.StatusBadRequest, "invalidSyntax", detail)
+}
+
+func invalidValue(detail string) *Error {
+	return newError(http.StatusBadRequest, "invalidValue", detail)
+}
+
+func invalidPath(detail string) *Error {
+	return newError(http.StatusBadRequest, "invalidPath", detail)
+}
+
+func mutability(detail string) *Error {
+	return newError(http.StatusBadRequest, "mutability", detail)
+}
+
+func uniqueness(detail string) *Error {
+	return newError(http.StatusConflict, "uniqueness", detail)
+}
+
+func unauthorized(detail string) *Error {
+	return newError(http.StatusUnauthorized, "", detail)
+}
+
+func notFound(detail string) *Error {
+	return newError(http.StatusNotFound, "", detail)
+}
+
+func preconditionFailed(detail string) *Error {
+	return newError(http.StatusPreconditionFailed, "", detail)
+}
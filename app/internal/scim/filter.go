@@ -0,0 +1,250 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+// attributes is SCIM attribute path to account field. paths are compared lower case
+var attributes = map[string]string{
+	"id":             "_id",
+	"externalid":     "external_id",
+	"username":       "email",
+	"emails":         "email",
+	"emails.value":   "email",
+	"displayname":    "username",
+	"name.formatted": "username",
+	"locale":         "lang",
+	"active":         "is_active",
+	"meta.created":   "created_at",
+}
+
+var operators = map[string]bool{
+	accounts.FilterEq: true,
+	accounts.FilterNe: true,
+	accounts.FilterCo: true,
+	accounts.FilterSw: true,
+	accounts.FilterEw: true,
+	accounts.FilterGt: true,
+	accounts.FilterGe: true,
+	accounts.FilterLt: true,
+	accounts.FilterLe: true,
+}
+
+// ParseFilter parses RFC 7644 3.4.2.2 filter into account filter. empty filter matches all accounts
+func ParseFilter(filter string) (accounts.Filter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return accounts.Filter{}, nil
+	}
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return accounts.Filter{}, err
+	}
+
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return f, err
+	}
+	if p.pos != len(p.tokens) {
+		return f, invalidFilter(fmt.Sprintf("unexpected %q", p.tokens[p.pos].text))
+	}
+	return f, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(filter string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '[' || c == ']':
+			return nil, invalidFilter("complex attribute filters are not supported")
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &value); err != nil {
+				return nil, invalidFilter("invalid string " + filter[i:end+1])
+			}
+			tokens = append(tokens, token{text: value, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t()[]\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: filter[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(keyword string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *parser) next() (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, invalidFilter("unexpected end of filter")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) expect(keyword string) error {
+	if !p.peek(keyword) {
+		return invalidFilter(fmt.Sprintf("expected %q", keyword))
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) or() (accounts.Filter, error) {
+	return p.logical(accounts.FilterOr, p.and)
+}
+
+func (p *parser) and() (accounts.Filter, error) {
+	return p.logical(accounts.FilterAnd, p.factor)
+}
+
+func (p *parser) logical(op string, operand func() (accounts.Filter, error)) (accounts.Filter, error) {
+	f, err := operand()
+	if err != nil {
+		return f, err
+	}
+	filters := []accounts.Filter{f}
+	for p.peek(op) {
+		p.pos++
+		f, err = operand()
+		if err != nil {
+			return f, err
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return accounts.Filter{Op: op, Filters: filters}, nil
+}
+
+func (p *parser) factor() (accounts.Filter, error) {
+	if p.peek(accounts.FilterNot) {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return accounts.Filter{}, err
+		}
+		f, err := p.group()
+		if err != nil {
+			return f, err
+		}
+		return accounts.Filter{Op: accounts.FilterNot, Filters: []accounts.Filter{f}}, nil
+	}
+	if p.peek("(") {
+		p.pos++
+		return p.group()
+	}
+	return p.comparison()
+}
+
+func (p *parser) group() (accounts.Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return f, err
+	}
+	return f, p.expect(")")
+}
+
+func (p *parser) comparison() (f accounts.Filter, err error) {
+	attr, err := p.next()
+	if err != nil {
+		return f, err
+	}
+	field, ok := attributes[strings.ToLower(attr.text)]
+	if attr.quoted || !ok {
+		return f, invalidFilter(fmt.Sprintf("unsupported attribute %q", attr.text))
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return f, err
+	}
+	f = accounts.Filter{Op: strings.ToLower(op.text), Field: field}
+	if f.Op == accounts.FilterPr && !op.quoted {
+		return f, nil
+	}
+	if op.quoted || !operators[f.Op] {
+		return f, invalidFilter(fmt.Sprintf("unsupported operator %q", op.text))
+	}
+
+	value, err := p.next()
+	if err != nil {
+		return f, err
+	}
+	f.Value, err = filterValue(f, value)
+	return f, err
+}
+
+//? value type must match attribute type
+func filterValue(f accounts.Filter, value token) (interface{}, error) {
+	switch f.Field {
+	case "_id":
+		//? ids are compared as object ids, so substring and ordering operators can't apply
+		if !value.quoted || (f.Op != accounts.FilterEq && f.Op != accounts.FilterNe) {
+			return nil, invalidFilter("id supports eq and ne with quoted value")
+		}
+		return value.text, nil
+	case "is_active":
+		if value.quoted || (f.Op != accounts.FilterEq && f.Op != accounts.FilterNe) {
+			return nil, invalidFilter("active supports eq and ne with boolean value")
+		}
+		switch strings.ToLower(value.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, invalidFilter("active supports eq and ne with boolean value")
+	case "created_at":
+		if !value.quoted {
+			return nil, invalidFilter("meta.created value must be quoted date")
+		}
+		t, err := time.Parse(time.RFC3339, value.text)
+		if err != nil {
+			return nil, invalidFilter("meta.created value must be RFC 3339 date")
+		}
+		return t.UnixNano(), nil
+	}
+
+	if !value.quoted {
+		return nil, invalidFilter(fmt.Sprintf("value %q must be quoted string", value.text))
+	}
+	return value.text, nil
+}
@@ -0,0 +1,111 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+func eq(field string, value interface{}) accounts.Filter {
+	return accounts.Filter{Op: accounts.FilterEq, Field: field, Value: value}
+}
+
+func TestParseFilter(t *testing.T) {
+	created := time.Date(2021, 8, 16, 10, 0, 0, 0, time.UTC).UnixNano()
+	tests := []struct {
+		name   string
+		filter string
+		want   accounts.Filter
+	}{
+		{name: "empty", filter: "  ", want: accounts.Filter{}},
+		{name: "attribute and operator are case insensitive", filter: `userName EQ "player@eob.local"`,
+			want: eq("email", "player@eob.local")},
+		{name: "id", filter: `id ne "611a7209ef4f1f377c96a4eb"`,
+			want: accounts.Filter{Op: accounts.FilterNe, Field: "_id", Value: "611a7209ef4f1f377c96a4eb"}},
+		{name: "substring", filter: `displayName co "play"`,
+			want: accounts.Filter{Op: accounts.FilterCo, Field: "username", Value: "play"}},
+		{name: "boolean", filter: `active eq False`, want: eq("is_active", false)},
+		{name: "date", filter: `meta.created gt "2021-08-16T10:00:00Z"`,
+			want: accounts.Filter{Op: accounts.FilterGt, Field: "created_at", Value: created}},
+		{name: "present", filter: `externalId pr`, want: accounts.Filter{Op: accounts.FilterPr, Field: "external_id"}},
+		{name: "escaped quote", filter: `displayName eq "say \"hi\" (now)"`, want: eq("username", `say "hi" (now)`)},
+		{name: "quoted keyword is value", filter: `displayName eq "and"`, want: eq("username", "and")},
+		{name: "and binds tighter than or", filter: `locale eq "en" or locale eq "de" and active eq true`,
+			want: accounts.Filter{Op: accounts.FilterOr, Filters: []accounts.Filter{
+				eq("lang", "en"),
+				{Op: accounts.FilterAnd, Filters: []accounts.Filter{eq("lang", "de"), eq("is_active", true)}},
+			}}},
+		{name: "parentheses", filter: `(locale eq "en" or locale eq "de") and active eq true`,
+			want: accounts.Filter{Op: accounts.FilterAnd, Filters: []accounts.Filter{
+				{Op: accounts.FilterOr, Filters: []accounts.Filter{eq("lang", "en"), eq("lang", "de")}},
+				eq("is_active", true),
+			}}},
+		{name: "chained and", filter: `locale eq "en" and locale eq "de" AND locale eq "fr"`,
+			want: accounts.Filter{Op: accounts.FilterAnd, Filters: []accounts.Filter{
+				eq("lang", "en"), eq("lang", "de"), eq("lang", "fr"),
+			}}},
+		{name: "not", filter: `not (active eq true or externalId pr) and locale eq "en"`,
+			want: accounts.Filter{Op: accounts.FilterAnd, Filters: []accounts.Filter{
+				{Op: accounts.FilterNot, Filters: []accounts.Filter{
+					{Op: accounts.FilterOr, Filters: []accounts.Filter{
+						eq("is_active", true),
+						{Op: accounts.FilterPr, Field: "external_id"},
+					}},
+				}},
+				eq("lang", "en"),
+			}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{name: "unknown attribute", filter: `password eq "secret"`},
+		{name: "quoted attribute", filter: `"userName" eq "player@eob.local"`},
+		{name: "unknown operator", filter: `userName like "player"`},
+		{name: "quoted operator", filter: `userName "eq" "player"`},
+		{name: "id contains", filter: `id co "611a"`},
+		{name: "id starts with", filter: `id sw "611a"`},
+		{name: "id ends with", filter: `id ew "a4eb"`},
+		{name: "id greater than", filter: `id gt "611a7209ef4f1f377c96a4eb"`},
+		{name: "id less or equal", filter: `id le "611a7209ef4f1f377c96a4eb"`},
+		{name: "unquoted id", filter: `id eq 611a7209ef4f1f377c96a4eb`},
+		{name: "unquoted string", filter: `userName eq player`},
+		{name: "active substring", filter: `active co true`},
+		{name: "quoted boolean", filter: `active eq "true"`},
+		{name: "unquoted date", filter: `meta.created gt 2021`},
+		{name: "malformed date", filter: `meta.created gt "yesterday"`},
+		{name: "missing value", filter: `userName eq`},
+		{name: "unterminated string", filter: `userName eq "player`},
+		{name: "unclosed group", filter: `(userName eq "player"`},
+		{name: "not without group", filter: `not userName eq "player"`},
+		{name: "trailing token", filter: `userName eq "player" )`},
+		{name: "dangling or", filter: `userName eq "player" or`},
+		{name: "complex attribute", filter: `emails[type eq "work"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilter(tt.filter)
+			var scimErr *Error
+			if !errors.As(err, &scimErr) || scimErr.ScimType != "invalidFilter" {
+				t.Errorf("ParseFilter() error = %v, want invalidFilter", err)
+			}
+		})
+	}
+}
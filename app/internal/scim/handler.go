@@ -0,0 +1,170 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	usersURL = "/scim/v2/Users"
+	userURL  = "/scim/v2/Users/:id"
+)
+
+type Handler struct {
+	Logger      logging.Logger
+	SCIMService Service
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, usersURL, apperror.Middleware(h.provisioning(h.ListUsers)))
+	router.HandlerFunc(http.MethodPost, usersURL, apperror.Middleware(h.provisioning(h.CreateUser)))
+	router.HandlerFunc(http.MethodGet, userURL, apperror.Middleware(h.provisioning(h.GetUser)))
+	router.HandlerFunc(http.MethodPatch, userURL, apperror.Middleware(h.provisioning(h.PatchUser)))
+	router.HandlerFunc(http.MethodDelete, userURL, apperror.Middleware(h.provisioning(h.DeleteUser)))
+}
+
+//? SCIM clients authenticate with provisioning token instead of account token
+func (h *Handler) provisioning(next func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", ContentType)
+		name, err := h.SCIMService.AuthenticateClient(auth.BearerToken(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			return writeError(w, err)
+		}
+		h.Logger.Infof("scim client %s", name)
+		return writeError(w, next(w, r))
+	}
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("LIST SCIM USERS")
+
+	query := r.URL.Query()
+	startIndex, err := intParam(query.Get("startIndex"), 1)
+	if err != nil {
+		return invalidValue("startIndex must be integer")
+	}
+	count, err := intParam(query.Get("count"), -1)
+	if err != nil {
+		return invalidValue("count must be integer")
+	}
+
+	resp, err := h.SCIMService.List(r.Context(), query.Get("filter"), startIndex, count)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("CREATE SCIM USER")
+
+	h.Logger.Debug("decode scim user")
+	var user User
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		return invalidSyntax("invalid JSON scheme. check RFC 7643")
+	}
+
+	user, err := h.SCIMService.Create(r.Context(), user)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", user.Meta.Location)
+	w.Header().Set("ETag", user.Meta.Version)
+	return writeJSON(w, http.StatusCreated, user)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET SCIM USER")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	user, err := h.SCIMService.Get(r.Context(), params.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", user.Meta.Version)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matches(ifNoneMatch, user.Meta.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("PATCH SCIM USER")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+
+	h.Logger.Debug("decode patch request")
+	var req PatchRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return invalidSyntax("invalid JSON scheme. check RFC 7644")
+	}
+
+	user, err := h.SCIMService.Patch(r.Context(), params.ByName("id"), r.Header.Get("If-Match"), req)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", user.Meta.Version)
+	return writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("DELETE SCIM USER")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	err := h.SCIMService.Delete(r.Context(), params.ByName("id"), r.Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func intParam(value string, def int64) (int64, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshall scim response. error: %w", err)
+	}
+
+	w.WriteHeader(status)
+	w.Write(bytes)
+	return nil
+}
+
+//? SCIM clients expect RFC 7644 errors, other errors are left to apperror middleware
+func writeError(w http.ResponseWriter, err error) error {
+	if errors.Is(err, apperror.ErrNotFound) {
+		err = notFound("user not found")
+	}
+	var scimErr *Error
+	if errors.As(err, &scimErr) {
+		w.WriteHeader(scimErr.status())
+		w.Write(scimErr.Marshal())
+		return nil
+	}
+	return err
+}
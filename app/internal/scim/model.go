@@ -0,0 +1,121 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+// schema URNs of RFC 7643 and RFC 7644
+const (
+	UserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+const ContentType = "application/scim+json"
+
+// User is SCIM core user. userName is account email
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Locale      string   `json:"locale,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type Name struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int64    `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// NewUser maps account to SCIM user. meta.version is weak ETag of representation
+func NewUser(acc accounts.Account, location string) User {
+	active := acc.IsActive && !acc.IsDeleted
+	u := User{
+		Schemas:     []string{UserSchema},
+		ID:          acc.UUID,
+		ExternalID:  acc.ExternalID,
+		UserName:    acc.Email,
+		DisplayName: acc.Username,
+		Emails:      []Email{{Value: acc.Email, Type: "work", Primary: true}},
+		Locale:      acc.Language,
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Location:     location,
+		},
+	}
+	if acc.Username != "" {
+		u.Name = &Name{Formatted: acc.Username}
+	}
+	if acc.CreatedAt != 0 {
+		u.Meta.Created = time.Unix(0, acc.CreatedAt).UTC().Format(time.RFC3339)
+	}
+
+	representation, _ := json.Marshal(u)
+	sum := sha256.Sum256(representation)
+	u.Meta.Version = `W/"` + hex.EncodeToString(sum[:8]) + `"`
+	return u
+}
+
+// Email returns primary email of user, userName otherwise
+func (u User) Email() string {
+	for _, e := range u.Emails {
+		if e.Primary && e.Value != "" {
+			return e.Value
+		}
+	}
+	return u.UserName
+}
+
+func NewListResponse(users []User, total, startIndex int64) ListResponse {
+	return ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	}
+}
@@ -0,0 +1,337 @@
+package scim
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+var _ Service = &service{}
+
+// Token is provisioning token of SCIM client
+type Token struct {
+	Name  string
+	Token string
+}
+
+type client struct {
+	name   string
+	digest [sha256.Size]byte
+}
+
+type service struct {
+	accountService accounts.Service
+	clients        []client
+	baseURL        string
+	maxResults     int64
+	logger         logging.Logger
+}
+
+func NewService(accountService accounts.Service, tokens []Token, baseURL string, maxResults int,
+	logger logging.Logger) (Service, error) {
+	clients := make([]client, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Name == "" || len(t.Token) < 32 {
+			return nil, fmt.Errorf("scim token requires name and at least 32 characters")
+		}
+		clients = append(clients, client{name: t.Name, digest: sha256.Sum256([]byte(t.Token))})
+	}
+	if maxResults <= 0 {
+		return nil, fmt.Errorf("scim max results must be positive")
+	}
+	return &service{
+		accountService: accountService,
+		clients:        clients,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		maxResults:     int64(maxResults),
+		logger:         logger,
+	}, nil
+}
+
+type Service interface {
+	AuthenticateClient(token string) (string, error)
+	Create(ctx context.Context, user User) (User, error)
+	Get(ctx context.Context, id string) (User, error)
+	List(ctx context.Context, filter string, startIndex, count int64) (ListResponse, error)
+	Patch(ctx context.Context, id, ifMatch string, req PatchRequest) (User, error)
+	Delete(ctx context.Context, id, ifMatch string) error
+}
+
+//? returns name of client owning provisioning token
+func (s service) AuthenticateClient(token string) (string, error) {
+	digest := sha256.Sum256([]byte(token))
+	for _, c := range s.clients {
+		if subtle.ConstantTimeCompare(digest[:], c.digest[:]) == 1 {
+			return c.name, nil
+		}
+	}
+	return "", unauthorized("provisioning token is invalid")
+}
+
+func (s service) Create(ctx context.Context, user User) (u User, err error) {
+	email := user.Email()
+	if !strings.Contains(email, "@") {
+		return u, invalidValue("userName or primary email must be email address")
+	}
+
+	dto := accounts.ProvisionAccountDTO{
+		Email:      email,
+		Password:   user.Password,
+		Username:   user.DisplayName,
+		Language:   user.Locale,
+		ExternalID: user.ExternalID,
+		Active:     user.Active == nil || *user.Active,
+	}
+	if dto.Username == "" && user.Name != nil {
+		dto.Username = user.Name.Formatted
+	}
+
+	s.logger.Debug("provision account")
+	id, err := s.accountService.Provision(ctx, dto)
+	if err != nil {
+		if errors.Is(err, apperror.ErrAlreadyExists) {
+			return u, uniqueness("user with that userName already exists")
+		}
+		if errors.Is(err, apperror.ErrUsernameTaken) {
+			return u, uniqueness("user with that displayName already exists")
+		}
+		return u, err
+	}
+
+	return s.Get(ctx, id)
+}
+
+//? deleted accounts are hidden from provisioning clients
+func (s service) Get(ctx context.Context, id string) (u User, err error) {
+	accs, _, err := s.accountService.FindAccounts(ctx, accounts.Filter{
+		Op: accounts.FilterAnd,
+		Filters: []accounts.Filter{
+			{Op: accounts.FilterEq, Field: "_id", Value: id},
+			notDeleted,
+		},
+	}, 0, 1)
+	if err != nil {
+		return u, err
+	}
+	if len(accs) == 0 {
+		return u, notFound(fmt.Sprintf("user %s not found", id))
+	}
+	return s.user(accs[0]), nil
+}
+
+var notDeleted = accounts.Filter{Op: accounts.FilterEq, Field: "is_deleted", Value: false}
+
+//? startIndex is 1-based, count is capped by max results. negative count means max results
+func (s service) List(ctx context.Context, filter string, startIndex, count int64) (resp ListResponse, err error) {
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return resp, err
+	}
+	if f.Op == "" {
+		f = notDeleted
+	} else {
+		f = accounts.Filter{Op: accounts.FilterAnd, Filters: []accounts.Filter{f, notDeleted}}
+	}
+
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 || count > s.maxResults {
+		count = s.maxResults
+	}
+
+	s.logger.Debugf("find accounts from %d count %d", startIndex, count)
+	accs, total, err := s.accountService.FindAccounts(ctx, f, startIndex-1, count)
+	if err != nil {
+		return resp, err
+	}
+
+	users := make([]User, 0, len(accs))
+	for _, acc := range accs {
+		users = append(users, s.user(acc))
+	}
+	return NewListResponse(users, total, startIndex), nil
+}
+
+//? RFC 7644 3.5.2. userName and emails are owned by account holder and can't be changed
+func (s service) Patch(ctx context.Context, id, ifMatch string, req PatchRequest) (u User, err error) {
+	if !contains(req.Schemas, PatchOpSchema) || len(req.Operations) == 0 {
+		return u, invalidSyntax("PatchOp schema and at least one operation are required")
+	}
+
+	u, err = s.Get(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	if !matches(ifMatch, u.Meta.Version) {
+		return u, preconditionFailed("user was modified")
+	}
+
+	p := patch{dto: accounts.UpdateAccountDTO{UUID: id}}
+	for _, op := range req.Operations {
+		if err = p.apply(op); err != nil {
+			return u, err
+		}
+	}
+
+	if p.changed {
+		s.logger.Debug("update account")
+		if err = s.accountService.UpdateAccount(ctx, p.dto); err != nil {
+			if errors.Is(err, apperror.ErrUsernameTaken) {
+				return u, uniqueness("user with that displayName already exists")
+			}
+			return u, err
+		}
+	}
+	if p.active != nil {
+		s.logger.Debugf("set account active %v", *p.active)
+		if err = s.accountService.SetActive(ctx, id, *p.active); err != nil {
+			return u, err
+		}
+	}
+
+	return s.Get(ctx, id)
+}
+
+func (s service) Delete(ctx context.Context, id, ifMatch string) error {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !matches(ifMatch, u.Meta.Version) {
+		return preconditionFailed("user was modified")
+	}
+
+	s.logger.Debug("delete account")
+	return s.accountService.Delete(ctx, id)
+}
+
+func (s service) user(acc accounts.Account) User {
+	return NewUser(acc, s.baseURL+usersURL+"/"+acc.UUID)
+}
+
+type patch struct {
+	dto     accounts.UpdateAccountDTO
+	active  *bool
+	changed bool
+}
+
+func (p *patch) apply(op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return mutability(fmt.Sprintf("%s can not be removed", op.Path))
+	default:
+		return invalidSyntax(fmt.Sprintf("unsupported operation %q", op.Op))
+	}
+
+	if op.Path != "" {
+		return p.set(op.Path, op.Value)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &values); err != nil {
+		return invalidValue("value of operation without path must be object")
+	}
+	for path, value := range values {
+		if err := p.set(path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *patch) set(path string, raw json.RawMessage) (err error) {
+	switch strings.ToLower(path) {
+	case "active":
+		active, err := decodeBool(raw)
+		if err != nil {
+			return err
+		}
+		p.active = &active
+		return nil
+	case "name":
+		var name Name
+		if err = json.Unmarshal(raw, &name); err != nil {
+			return invalidValue("name must be object")
+		}
+		p.dto.Username, err = nonEmpty("name.formatted", name.Formatted)
+	case "displayname", "name.formatted":
+		p.dto.Username, err = decodeString(path, raw)
+	case "externalid":
+		p.dto.ExternalID, err = decodeString(path, raw)
+	case "locale":
+		p.dto.Language, err = decodeString(path, raw)
+	case "id", "username", "emails", "emails.value", "password", "meta":
+		return mutability(fmt.Sprintf("%s can not be changed by provisioning", path))
+	default:
+		return invalidPath(fmt.Sprintf("unsupported path %q", path))
+	}
+	p.changed = true
+	return err
+}
+
+func decodeString(path string, raw json.RawMessage) (string, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", invalidValue(fmt.Sprintf("%s must be string", path))
+	}
+	return nonEmpty(path, value)
+}
+
+func nonEmpty(path, value string) (string, error) {
+	if value == "" {
+		return "", invalidValue(fmt.Sprintf("%s can not be empty", path))
+	}
+	return value, nil
+}
+
+// decodeBool accepts JSON boolean and "True"/"False" strings some clients send
+func decodeBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, invalidValue("active must be boolean")
+}
+
+// matches reports whether If-Match header allows current version. empty header allows any
+func matches(ifMatch, version string) bool {
+	if ifMatch == "" {
+		return true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(version, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
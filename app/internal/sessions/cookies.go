@@ -0,0 +1,70 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+var _ accounts.BrowserSessions = &Cookies{}
+var _ auth.CookieSessions = &Cookies{}
+
+// Cookies keeps browser session token in HttpOnly cookie. CSRF token is sent in readable cookie,
+// unsafe requests must echo it in CSRFHeader
+type Cookies struct {
+	Logger     logging.Logger
+	Sessions   Service
+	Name       string
+	CSRFName   string
+	CSRFHeader string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+}
+
+func (c *Cookies) StartBrowser(w http.ResponseWriter, r *http.Request, accountUUID string) error {
+	c.Logger.Debug("start browser session")
+	session, err := c.Sessions.StartBrowser(r.Context(), accountUUID, accounts.NewDevice(r))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, c.cookie(c.Name, session.Token, session.ExpiresAt, true))
+	http.SetCookie(w, c.cookie(c.CSRFName, session.CSRF, session.ExpiresAt, false))
+	return nil
+}
+
+func (c *Cookies) Token(r *http.Request) string {
+	cookie, err := r.Cookie(c.Name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (c *Cookies) VerifyCSRF(ctx context.Context, raw string, r *http.Request) error {
+	return c.Sessions.VerifyCSRF(ctx, raw, r.Header.Get(c.CSRFHeader))
+}
+
+// Clear expires session cookies in browser
+func (c *Cookies) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(c.Name, "", time.Unix(0, 0), true))
+	http.SetCookie(w, c.cookie(c.CSRFName, "", time.Unix(0, 0), false))
+}
+
+func (c *Cookies) cookie(name, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   c.Domain,
+		Expires:  expires,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
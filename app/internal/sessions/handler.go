@@ -0,0 +1,114 @@
+package sessions
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	logoutURL   = "/api/logout"
+	reauthURL   = "/api/reauth"
+	sessionsURL = "/api/account/:uuid/sessions"
+	sessionURL  = "/api/account/:uuid/sessions/:id"
+)
+
+// Handler.Cookies is nil unless cookie sessions are enabled
+type Handler struct {
+	Logger         logging.Logger
+	SessionService Service
+	Cookies        *Cookies
+	Auth           *auth.Middleware
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodPost, logoutURL, apperror.Middleware(h.Auth.Authenticated(h.Logout)))
+	router.HandlerFunc(http.MethodPost, reauthURL, apperror.Middleware(h.Auth.Authenticated(h.Reauthenticate)))
+	router.HandlerFunc(http.MethodGet, sessionsURL, apperror.Middleware(h.Auth.Owner(h.GetSessions)))
+	router.HandlerFunc(http.MethodDelete, sessionURL, apperror.Middleware(h.Auth.Owner(h.Auth.NotImpersonated(h.RevokeSession))))
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("LOGOUT")
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, _ := auth.FromContext(r.Context())
+	err := h.SessionService.Revoke(r.Context(), principal.SessionID)
+	if err != nil {
+		return err
+	}
+	if h.Cookies != nil {
+		h.Cookies.Clear(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) Reauthenticate(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REAUTHENTICATE")
+	w.Header().Set("Content-Type", "application/json")
+
+	h.Logger.Debug("decode reauth dto")
+	var dto ReauthDTO
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return apperror.BadRequestError("invalid JSON scheme. check swagger API")
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	err := h.SessionService.Reauthenticate(r.Context(), principal, dto, accounts.NewDevice(r))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("GET SESSIONS")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+
+	principal, _ := auth.FromContext(r.Context())
+	list, err := h.SessionService.List(r.Context(), accountUUID, principal.SessionID)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal sessions")
+	sessionsBytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(sessionsBytes)
+
+	return nil
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("REVOKE SESSION")
+	w.Header().Set("Content-Type", "application/json")
+
+	params := r.Context().Value(httprouter.ParamsKey).(httprouter.Params)
+	accountUUID := params.ByName("uuid")
+	publicID := params.ByName("id")
+
+	err := h.SessionService.RevokeSession(r.Context(), accountUUID, publicID)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
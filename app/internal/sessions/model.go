@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+)
+
+// Session is login of account. Browser sessions live in cookie, expire after idle timeout
+// and keep hash of CSRF token. ID is token hash, so session is shown to its owner by PublicID.
+// Current marks session of request in session list
+type Session struct {
+	ID          string    `json:"-" bson:"_id"`
+	PublicID    string    `json:"id" bson:"public_id"`
+	AccountUUID string    `json:"-" bson:"account_uuid"`
+	Browser     bool      `json:"browser" bson:"browser,omitempty"`
+	CSRF        string    `json:"-" bson:"csrf,omitempty"`
+	DeviceName  string    `json:"device_name" bson:"device_name"`
+	UserAgent   string    `json:"user_agent" bson:"user_agent,omitempty"`
+	IP          string    `json:"ip" bson:"ip,omitempty"`
+	Location    string    `json:"location,omitempty" bson:"location,omitempty"`
+	AuthTime    time.Time `json:"auth_time" bson:"auth_time"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+	Current     bool      `json:"current" bson:"-"`
+}
+
+// BrowserSession is started cookie session. tokens are sent to browser only once
+type BrowserSession struct {
+	Token     string
+	CSRF      string
+	ExpiresAt time.Time
+}
+
+// ReauthDTO confirms identity with password or step up code
+type ReauthDTO struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// ReauthAttempts counts wrong passwords sent to reauthenticate session. counter is removed when window
+// expires or password is confirmed
+type ReauthAttempts struct {
+	ID        string    `bson:"_id"`
+	Count     int       `bson:"count"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func NewSession(id, publicID, accountUUID string, device accounts.Device, ttl time.Duration) Session {
+	tNow := time.Now()
+	return Session{
+		ID:          id,
+		PublicID:    publicID,
+		AccountUUID: accountUUID,
+		DeviceName:  device.DisplayName(),
+		UserAgent:   device.UserAgent,
+		IP:          device.IP,
+		AuthTime:    tNow,
+		CreatedAt:   tNow,
+		LastSeenAt:  tNow,
+		ExpiresAt:   tNow.Add(ttl),
+	}
+}
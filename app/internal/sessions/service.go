@@ -0,0 +1,294 @@
+package sessions
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+)
+
+var _ Service = &service{}
+var _ auth.Authenticator = &service{}
+var _ accounts.SessionStarter = &service{}
+
+// CodeVerifier checks step up code of second factor
+type CodeVerifier interface {
+	VerifyStepUp(ctx context.Context, accountUUID, code string) error
+}
+
+// LoginHistory records wrong passwords sent to reauthenticate session
+type LoginHistory interface {
+	Record(ctx context.Context, attempt accounts.LoginAttempt) error
+}
+
+// Locator resolves approximate location of client address. empty string when it is unknown
+type Locator interface {
+	Locate(ip string) string
+}
+
+// last seen time is written at most once per lastSeenPrecision
+const lastSeenPrecision = time.Minute
+
+type service struct {
+	storage       Storage
+	accounts      accounts.Service
+	codes         CodeVerifier
+	history       LoginHistory
+	locator       Locator
+	ttl           time.Duration
+	idleTimeout   time.Duration
+	maxAttempts   int
+	attemptWindow time.Duration
+	logger        logging.Logger
+}
+
+//? locator is optional, sessions have no location without it. maxAttempts wrong passwords lock
+//? reauthentication of session until attemptWindow passes
+func NewService(sessionStorage Storage, accountService accounts.Service, codeVerifier CodeVerifier, history LoginHistory,
+	locator Locator, ttl, idleTimeout time.Duration, maxAttempts int, attemptWindow time.Duration,
+	logger logging.Logger) (Service, error) {
+	return &service{
+		storage:       sessionStorage,
+		accounts:      accountService,
+		codes:         codeVerifier,
+		history:       history,
+		locator:       locator,
+		ttl:           ttl,
+		idleTimeout:   idleTimeout,
+		maxAttempts:   maxAttempts,
+		attemptWindow: attemptWindow,
+		logger:        logger,
+	}, nil
+}
+
+type Service interface {
+	Start(ctx context.Context, accountUUID string, device accounts.Device) (string, error)
+	StartBrowser(ctx context.Context, accountUUID string, device accounts.Device) (BrowserSession, error)
+	VerifyCSRF(ctx context.Context, token, csrf string) error
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+	Reauthenticate(ctx context.Context, principal auth.Principal, dto ReauthDTO, device accounts.Device) error
+	Revoke(ctx context.Context, sessionID string) error
+	List(ctx context.Context, accountUUID, currentID string) ([]Session, error)
+	RevokeSession(ctx context.Context, accountUUID, publicID string) error
+	RevokeAll(ctx context.Context, accountUUID string) error
+}
+
+//? open session after login. only token hash is stored
+func (s service) Start(ctx context.Context, accountUUID string, device accounts.Device) (string, error) {
+	s.logger.Debug("generate session token")
+	raw, err := token.New(32)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := s.newSession(token.Hash(raw), accountUUID, device)
+	if err != nil {
+		return "", err
+	}
+	if err = s.storage.Create(ctx, session); err != nil {
+		return "", fmt.Errorf("failed to create session. error: %w", err)
+	}
+	return raw, nil
+}
+
+//? open cookie session of web portal with CSRF token
+func (s service) StartBrowser(ctx context.Context, accountUUID string, device accounts.Device) (b BrowserSession, err error) {
+	s.logger.Debug("generate session and csrf tokens")
+	b.Token, err = token.New(32)
+	if err != nil {
+		return b, err
+	}
+	b.CSRF, err = token.New(32)
+	if err != nil {
+		return b, err
+	}
+
+	session, err := s.newSession(token.Hash(b.Token), accountUUID, device)
+	if err != nil {
+		return b, err
+	}
+	session.Browser = true
+	session.CSRF = token.Hash(b.CSRF)
+	if err = s.storage.Create(ctx, session); err != nil {
+		return b, fmt.Errorf("failed to create session. error: %w", err)
+	}
+	b.ExpiresAt = session.ExpiresAt
+	return b, nil
+}
+
+//? synchronizer token check. csrf must match the one issued with session
+func (s service) VerifyCSRF(ctx context.Context, raw, csrf string) error {
+	session, err := s.storage.FindOne(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrUnauthorized
+		}
+		return fmt.Errorf("failed to find session. error: %w", err)
+	}
+	if !session.Browser || csrf == "" ||
+		subtle.ConstantTimeCompare([]byte(token.Hash(csrf)), []byte(session.CSRF)) != 1 {
+		return apperror.ErrCSRF
+	}
+	return nil
+}
+
+//? browser sessions end after idle timeout, every session after absolute ttl
+func (s service) Authenticate(ctx context.Context, raw string) (p auth.Principal, err error) {
+	session, err := s.storage.FindOne(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, fmt.Errorf("failed to find session. error: %w", err)
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		return p, apperror.ErrUnauthorized
+	}
+	if session.Browser && s.idleTimeout > 0 && now.Sub(session.LastSeenAt) > s.idleTimeout {
+		s.logger.Debug("session is idle for too long")
+		s.storage.Delete(ctx, session.ID)
+		return p, apperror.ErrUnauthorized
+	}
+	if now.Sub(session.LastSeenAt) > lastSeenPrecision {
+		if err = s.storage.UpdateLastSeen(ctx, session.ID, now); err != nil {
+			s.logger.Errorf("failed to update session last seen time. error: %v", err)
+		}
+	}
+
+	account, err := s.accounts.GetAccount(ctx, session.AccountUUID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return p, apperror.ErrUnauthorized
+		}
+		return p, err
+	}
+	if err = account.CheckStatus(); err != nil {
+		return p, apperror.ErrUnauthorized
+	}
+
+	return auth.Principal{
+		AccountUUID: account.UUID,
+		SessionID:   session.ID,
+		AuthTime:    session.AuthTime,
+		ExpiresAt:   session.ExpiresAt,
+		IsAdmin:     account.IsAdmin,
+	}, nil
+}
+
+//? confirm identity again to refresh session auth time. passwords are counted per session, so stolen
+//? session token can't be used to guess password. step up codes are counted by code verifier
+func (s service) Reauthenticate(ctx context.Context, principal auth.Principal, dto ReauthDTO, device accounts.Device) error {
+	switch {
+	case dto.Password != "":
+		attemptsID := principal.AccountUUID + ":" + principal.SessionID
+		err := s.storage.CountAttempt(ctx, attemptsID, s.maxAttempts, s.attemptWindow)
+		if err != nil {
+			if errors.Is(err, apperror.ErrNotFound) {
+				return apperror.ErrReauthLocked
+			}
+			return fmt.Errorf("failed to count attempt. error: %w", err)
+		}
+
+		s.logger.Debug("check password")
+		account, err := s.accounts.GetAccount(ctx, principal.AccountUUID)
+		if err != nil {
+			return err
+		}
+		if err = account.CheckPassword(dto.Password); err != nil {
+			rErr := s.history.Record(ctx, accounts.LoginAttempt{
+				AccountUUID: account.UUID,
+				Email:       account.Email,
+				Outcome:     accounts.LoginFailure,
+				Reason:      accounts.ReasonWrongPassword,
+				Device:      device,
+			})
+			if rErr != nil {
+				s.logger.Errorf("failed to record reauth attempt. error: %v", rErr)
+			}
+			return apperror.ErrNotMatched
+		}
+		if err = s.storage.ResetAttempts(ctx, attemptsID); err != nil {
+			s.logger.Errorf("failed to reset reauth attempts. error: %v", err)
+		}
+	case dto.Code != "":
+		s.logger.Debug("check step up code")
+		if err := s.codes.VerifyStepUp(ctx, principal.AccountUUID, dto.Code); err != nil {
+			return err
+		}
+	default:
+		return apperror.BadRequestError("password or code is required")
+	}
+
+	err := s.storage.UpdateAuthTime(ctx, principal.SessionID, time.Now())
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return apperror.ErrUnauthorized
+		}
+		return fmt.Errorf("failed to update session. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) Revoke(ctx context.Context, sessionID string) error {
+	err := s.storage.Delete(ctx, sessionID)
+
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete session. error: %w", err)
+	}
+	return nil
+}
+
+//? sessions of account, most recently used first
+func (s service) List(ctx context.Context, accountUUID, currentID string) ([]Session, error) {
+	list, err := s.storage.FindByAccount(ctx, accountUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions. error: %w", err)
+	}
+	for i := range list {
+		list[i].Current = list[i].ID == currentID
+	}
+	return list, nil
+}
+
+//? session token stops working at once, since every request looks session up
+func (s service) RevokeSession(ctx context.Context, accountUUID, publicID string) error {
+	err := s.storage.DeleteByPublicID(ctx, accountUUID, publicID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete session. error: %w", err)
+	}
+	return nil
+}
+
+//? sign account out everywhere
+func (s service) RevokeAll(ctx context.Context, accountUUID string) error {
+	if err := s.storage.DeleteByAccount(ctx, accountUUID); err != nil {
+		return fmt.Errorf("failed to delete sessions. error: %w", err)
+	}
+	return nil
+}
+
+func (s service) newSession(id, accountUUID string, device accounts.Device) (Session, error) {
+	publicID, err := token.New(12)
+	if err != nil {
+		return Session{}, err
+	}
+	session := NewSession(id, publicID, accountUUID, device, s.ttl)
+	if s.locator != nil && device.IP != "" {
+		session.Location = s.locator.Locate(device.IP)
+	}
+	return session, nil
+}
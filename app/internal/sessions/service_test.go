@@ -0,0 +1,120 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const testPassword = "correct horse battery staple"
+
+// memoryStorage keeps auth times and attempt counters. other methods are not used by tests
+type memoryStorage struct {
+	Storage
+	authTimes map[string]time.Time
+	attempts  map[string]int
+}
+
+func (m *memoryStorage) UpdateAuthTime(ctx context.Context, id string, authTime time.Time) error {
+	m.authTimes[id] = authTime
+	return nil
+}
+
+func (m *memoryStorage) CountAttempt(ctx context.Context, id string, maxAttempts int, window time.Duration) error {
+	if m.attempts[id] >= maxAttempts {
+		return apperror.ErrNotFound
+	}
+	m.attempts[id]++
+	return nil
+}
+
+func (m *memoryStorage) ResetAttempts(ctx context.Context, id string) error {
+	delete(m.attempts, id)
+	return nil
+}
+
+type passwordAccounts struct {
+	accounts.Service
+	account accounts.Account
+}
+
+func (p passwordAccounts) GetAccount(ctx context.Context, uuid string) (accounts.Account, error) {
+	return p.account, nil
+}
+
+type history []accounts.LoginAttempt
+
+func (h *history) Record(ctx context.Context, attempt accounts.LoginAttempt) error {
+	*h = append(*h, attempt)
+	return nil
+}
+
+func newTestService(t *testing.T) (service, *memoryStorage, *history) {
+	t.Helper()
+	account := accounts.Account{UUID: "player", Email: "player@eob.local", Password: testPassword, IsActive: true}
+	if err := account.GeneratePasswordHash(); err != nil {
+		t.Fatalf("GeneratePasswordHash() error = %v", err)
+	}
+	storage := &memoryStorage{authTimes: make(map[string]time.Time), attempts: make(map[string]int)}
+	h := &history{}
+
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	s, err := NewService(storage, passwordAccounts{account: account}, nil, h, nil, time.Hour, time.Hour,
+		3, time.Minute, logging.Logger{Entry: logrus.NewEntry(l)})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return *s.(*service), storage, h
+}
+
+func TestReauthenticateLocksSession(t *testing.T) {
+	s, storage, h := newTestService(t)
+	principal := auth.Principal{AccountUUID: "player", SessionID: "session"}
+	device := accounts.Device{IP: "203.0.113.7"}
+	reauth := func(p auth.Principal, password string) error {
+		return s.Reauthenticate(context.Background(), p, ReauthDTO{Password: password}, device)
+	}
+
+	if err := reauth(principal, "wrong"); !errors.Is(err, apperror.ErrNotMatched) {
+		t.Fatalf("Reauthenticate() error = %v, want %v", err, apperror.ErrNotMatched)
+	}
+	if err := reauth(principal, testPassword); err != nil {
+		t.Fatalf("Reauthenticate() error = %v", err)
+	}
+	if _, ok := storage.authTimes["session"]; !ok {
+		t.Errorf("auth time of session is not updated")
+	}
+
+	//? confirmed password resets counter, so lockout needs maxAttempts wrong passwords in a row
+	for i := 0; i < 3; i++ {
+		if err := reauth(principal, "wrong"); !errors.Is(err, apperror.ErrNotMatched) {
+			t.Fatalf("attempt %d error = %v, want %v", i+1, err, apperror.ErrNotMatched)
+		}
+	}
+	if err := reauth(principal, testPassword); !errors.Is(err, apperror.ErrReauthLocked) {
+		t.Errorf("Reauthenticate() of locked session error = %v, want %v", err, apperror.ErrReauthLocked)
+	}
+	other := auth.Principal{AccountUUID: "player", SessionID: "other"}
+	if err := reauth(other, testPassword); err != nil {
+		t.Errorf("Reauthenticate() of other session error = %v", err)
+	}
+
+	if len(*h) != 4 {
+		t.Fatalf("recorded %d attempts, want 4", len(*h))
+	}
+	for _, attempt := range *h {
+		if attempt.Outcome != accounts.LoginFailure || attempt.Reason != accounts.ReasonWrongPassword ||
+			attempt.Email != "player@eob.local" || attempt.Device.IP != device.IP {
+			t.Errorf("recorded attempt = %+v, want wrong password failure", attempt)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package sessions
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	Create(ctx context.Context, session Session) error
+	FindOne(ctx context.Context, id string) (Session, error)
+	UpdateAuthTime(ctx context.Context, id string, authTime time.Time) error
+	UpdateLastSeen(ctx context.Context, id string, lastSeenAt time.Time) error
+	Delete(ctx context.Context, id string) error
+	FindByAccount(ctx context.Context, accountUUID string) ([]Session, error)
+	DeleteByPublicID(ctx context.Context, accountUUID, publicID string) error
+	DeleteByAccount(ctx context.Context, accountUUID string) error
+	CountAttempt(ctx context.Context, id string, maxAttempts int, window time.Duration) error
+	ResetAttempts(ctx context.Context, id string) error
+}
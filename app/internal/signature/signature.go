@@ -0,0 +1,186 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/internal/auth"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+// headers of signed request
+const (
+	KeyIDHeader     = "X-Eob-Key-Id"
+	TimestampHeader = "X-Eob-Timestamp"
+	NonceHeader     = "X-Eob-Nonce"
+	SignatureHeader = "X-Eob-Signature"
+)
+
+const maxBodySize = 10 << 20
+
+// Key is shared secret of eob worker. Scopes gate internal routes like service account scopes
+type Key struct {
+	ID     string
+	Secret string
+	Scopes []string
+}
+
+// Sign returns hex HMAC-SHA256 of canonical request. workers calling us use it too
+func Sign(secret, method, path, timestamp, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		timestamp,
+		nonce,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware verifies signed requests and passes service principal to auth.Middleware.
+// requests without signature headers go through untouched. replay protection is per worker instance only,
+// request replayed against other instance within clock skew is accepted
+type Middleware struct {
+	Logger    logging.Logger
+	Keys      map[string]Key
+	ClockSkew time.Duration
+	nonces    *nonceCache
+}
+
+func NewMiddleware(keys []Key, clockSkew time.Duration, logger logging.Logger) *Middleware {
+	m := &Middleware{
+		Logger:    logger,
+		Keys:      make(map[string]Key, len(keys)),
+		ClockSkew: clockSkew,
+		nonces:    &nonceCache{seen: make(map[string]time.Time)},
+	}
+	for _, k := range keys {
+		m.Keys[k.ID] = k
+	}
+	if clockSkew > 0 {
+		go m.nonces.sweep(clockSkew)
+	}
+	return m
+}
+
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return apperror.Middleware(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Header.Get(SignatureHeader) == "" {
+			next.ServeHTTP(w, r)
+			return nil
+		}
+
+		key, err := m.verify(r)
+		if errors.Is(err, apperror.ErrBodyTooLarge) {
+			w.Header().Set("Content-Type", "application/json")
+			return err
+		}
+		if err != nil {
+			m.Logger.Warnf("rejected signed request %s %s. error: %v", r.Method, r.URL.Path, err)
+			w.Header().Set("Content-Type", "application/json")
+			return apperror.ErrSignatureInvalid
+		}
+
+		m.Logger.Debugf("request signed with key %s", key.ID)
+		p := auth.Principal{
+			ClientID:  key.ID,
+			AuthTime:  time.Now(),
+			Scopes:    append([]string{}, key.Scopes...),
+			IsService: true,
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		return nil
+	})
+}
+
+func (m *Middleware) verify(r *http.Request) (key Key, err error) {
+	key, ok := m.Keys[r.Header.Get(KeyIDHeader)]
+	if !ok {
+		return key, errors.New("unknown key id")
+	}
+
+	timestamp := r.Header.Get(TimestampHeader)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return key, errors.New("malformed timestamp")
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew > m.ClockSkew || skew < -m.ClockSkew {
+		return key, errors.New("timestamp is outside of allowed clock skew")
+	}
+
+	nonce := r.Header.Get(NonceHeader)
+	if len(nonce) < 16 {
+		return key, errors.New("nonce is too short")
+	}
+
+	//? one byte over limit is read to tell too large body from body of exactly max size
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return key, errors.New("failed to read body")
+	}
+	if len(body) > maxBodySize {
+		return key, apperror.ErrBodyTooLarge
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := Sign(key.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(r.Header.Get(SignatureHeader)))) {
+		return key, errors.New("signature mismatch")
+	}
+
+	//? nonce is checked after signature so forged requests can't burn nonces
+	if !m.nonces.add(key.ID+":"+nonce, 2*m.ClockSkew) {
+		return key, errors.New("nonce was already used")
+	}
+	return key, nil
+}
+
+// nonceCache remembers nonces while their timestamps are acceptable. it is per worker instance
+type nonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+//? expired nonces stay in map until sweep, they are still refused then
+func (c *nonceCache) add(nonce string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	c.seen[nonce] = time.Now().Add(ttl)
+	return true
+}
+
+//? expired nonces are removed once per interval, so add does not scan whole map
+func (c *nonceCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for tNow := range ticker.C {
+		c.mu.Lock()
+		for n, expires := range c.seen {
+			if tNow.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,162 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const testNonce = "0123456789abcdef"
+
+var testKey = Key{ID: "worker", Secret: "worker secret", Scopes: []string{"accounts:read"}}
+
+func newTestMiddleware() *Middleware {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	return NewMiddleware([]Key{testKey}, 5*time.Minute, logging.Logger{Entry: logrus.NewEntry(l)})
+}
+
+// signedRequest signs body for signPath and sends it to path, so tests can tamper with request after signing
+func signedRequest(keyID, signPath, path string, body []byte, signedAt time.Time, nonce string) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set(KeyIDHeader, keyID)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, Sign(testKey.Secret, http.MethodPost, signPath, timestamp, nonce, body))
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"email":"player@eob.local"}`)
+	path := "/api/internal/accounts?limit=10"
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		wantErr bool
+	}{
+		{name: "valid", request: func() *http.Request {
+			return signedRequest(testKey.ID, path, path, body, time.Now(), testNonce)
+		}},
+		{name: "tampered path", wantErr: true, request: func() *http.Request {
+			return signedRequest(testKey.ID, path, "/api/internal/accounts?limit=1000", body, time.Now(), testNonce)
+		}},
+		{name: "tampered body", wantErr: true, request: func() *http.Request {
+			r := signedRequest(testKey.ID, path, path, body, time.Now(), testNonce)
+			r.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"email":"admin@eob.local"}`)))
+			return r
+		}},
+		{name: "stale timestamp", wantErr: true, request: func() *http.Request {
+			return signedRequest(testKey.ID, path, path, body, time.Now().Add(-6*time.Minute), testNonce)
+		}},
+		{name: "future timestamp", wantErr: true, request: func() *http.Request {
+			return signedRequest(testKey.ID, path, path, body, time.Now().Add(6*time.Minute), testNonce)
+		}},
+		{name: "unknown key id", wantErr: true, request: func() *http.Request {
+			return signedRequest("other", path, path, body, time.Now(), testNonce)
+		}},
+		{name: "short nonce", wantErr: true, request: func() *http.Request {
+			return signedRequest(testKey.ID, path, path, body, time.Now(), "0123")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := newTestMiddleware().verify(tt.request())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("verify() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if key.ID != testKey.ID {
+				t.Errorf("verify() key = %s, want %s", key.ID, testKey.ID)
+			}
+		})
+	}
+}
+
+func TestVerifyKeepsBody(t *testing.T) {
+	body := []byte(`{"email":"player@eob.local"}`)
+	r := signedRequest(testKey.ID, "/api/internal/accounts", "/api/internal/accounts", body, time.Now(), testNonce)
+	if _, err := newTestMiddleware().verify(r); err != nil {
+		t.Fatalf("verify() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(r.Body)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("body after verify = %q, %v, want %q", got, err, body)
+	}
+}
+
+func TestVerifyReusedNonce(t *testing.T) {
+	m := newTestMiddleware()
+	path := "/api/internal/accounts"
+	if _, err := m.verify(signedRequest(testKey.ID, path, path, nil, time.Now(), testNonce)); err != nil {
+		t.Fatalf("verify() error = %v", err)
+	}
+	if _, err := m.verify(signedRequest(testKey.ID, path, path, nil, time.Now(), testNonce)); err == nil {
+		t.Errorf("verify() of reused nonce error = nil, want error")
+	}
+	//? forged request must not burn nonce of genuine one
+	forged := signedRequest(testKey.ID, path, path, nil, time.Now(), "fedcba9876543210")
+	forged.Header.Set(SignatureHeader, "00")
+	if _, err := m.verify(forged); err == nil {
+		t.Fatalf("verify() of forged request error = nil, want error")
+	}
+	if _, err := m.verify(signedRequest(testKey.ID, path, path, nil, time.Now(), "fedcba9876543210")); err != nil {
+		t.Errorf("verify() after forged request error = %v", err)
+	}
+}
+
+func TestVerifyBodyTooLarge(t *testing.T) {
+	body := make([]byte, maxBodySize+1)
+	r := signedRequest(testKey.ID, "/api/internal/accounts", "/api/internal/accounts", body, time.Now(), testNonce)
+	if _, err := newTestMiddleware().verify(r); !errors.Is(err, apperror.ErrBodyTooLarge) {
+		t.Errorf("verify() error = %v, want %v", err, apperror.ErrBodyTooLarge)
+	}
+
+	body = body[:maxBodySize]
+	r = signedRequest(testKey.ID, "/api/internal/accounts", "/api/internal/accounts", body, time.Now(), testNonce)
+	if _, err := newTestMiddleware().verify(r); err != nil {
+		t.Errorf("verify() of body of max size error = %v", err)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	m := newTestMiddleware()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	path := "/api/internal/accounts"
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{name: "unsigned", request: httptest.NewRequest(http.MethodGet, path, nil), want: http.StatusNoContent},
+		{name: "signed", request: signedRequest(testKey.ID, path, path, nil, time.Now(), testNonce), want: http.StatusNoContent},
+		{name: "replayed", request: signedRequest(testKey.ID, path, path, nil, time.Now(), testNonce), want: http.StatusUnauthorized},
+		{name: "too large", want: http.StatusRequestEntityTooLarge,
+			request: signedRequest(testKey.ID, path, path, make([]byte, maxBodySize+1), time.Now(), "fedcba9876543210")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.Wrap(next).ServeHTTP(w, tt.request)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package sso
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	metadataURLPath = "/saml/metadata"
+	loginURLPath    = "/saml/login"
+	acsURLPath      = "/saml/acs"
+)
+
+type Handler struct {
+	Logger     logging.Logger
+	SSOService Service
+	Login      *accounts.Login
+}
+
+func (h *Handler) Register(router *httprouter.Router) {
+	router.HandlerFunc(http.MethodGet, metadataURLPath, apperror.Middleware(h.Metadata))
+	router.HandlerFunc(http.MethodGet, loginURLPath, apperror.Middleware(h.BeginLogin))
+	router.HandlerFunc(http.MethodPost, acsURLPath, apperror.Middleware(h.Assert))
+}
+
+func (h *Handler) Metadata(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("SAML METADATA")
+
+	metadata, err := h.SSOService.Metadata()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+
+	return nil
+}
+
+func (h *Handler) BeginLogin(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("BEGIN SAML LOGIN")
+	w.Header().Set("Content-Type", "application/json")
+
+	redirect, err := h.SSOService.Begin(r.Context())
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Debug("marshal redirect")
+	redirectBytes, err := json.Marshal(redirect)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(redirectBytes)
+
+	return nil
+}
+
+//? identity provider already verified staff, local second factor is skipped
+func (h *Handler) Assert(w http.ResponseWriter, r *http.Request) error {
+	h.Logger.Info("SAML ASSERTION CONSUMER")
+	w.Header().Set("Content-Type", "application/json")
+
+	account, err := h.SSOService.Assert(r.Context(), r)
+	if err != nil {
+		return err
+	}
+
+	return h.Login.Complete(w, r, account)
+}
@@ -0,0 +1,29 @@
+package sso
+
+import "time"
+
+// Options configure SAML service provider
+type Options struct {
+	RootURL           string
+	EntityID          string
+	CertFile          string
+	KeyFile           string
+	IDPMetadataURL    string
+	IDPMetadataFile   string
+	EmailAttribute    string
+	NameAttribute     string
+	RoleAttribute     string
+	RoleMapping       map[string]string
+	AllowIDPInitiated bool
+}
+
+// Request is pending SP initiated authentication request keyed by relay state hash
+type Request struct {
+	ID        string    `bson:"_id"`
+	RequestID string    `bson:"request_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type RedirectDTO struct {
+	RedirectTo string `json:"redirect_to"`
+}
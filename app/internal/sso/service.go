@@ -0,0 +1,230 @@
+package sso
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/charopevez/eob-accountant-worker/pkg/token"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+var _ Service = &service{}
+
+// requestTTL is how long staff may stay on identity provider login page
+const requestTTL = 10 * time.Minute
+
+type service struct {
+	storage  Storage
+	accounts accounts.Service
+	sp       *saml.ServiceProvider
+	options  Options
+	logger   logging.Logger
+}
+
+func NewService(ssoStorage Storage, accountService accounts.Service, options Options, logger logging.Logger) (Service, error) {
+	keyPair, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saml key pair. error: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("saml key must be RSA")
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse saml certificate. error: %w", err)
+	}
+
+	idpMetadata, err := loadIDPMetadata(options)
+	if err != nil {
+		return nil, err
+	}
+
+	rootURL, err := url.Parse(strings.TrimSuffix(options.RootURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse saml root url. error: %w", err)
+	}
+	metadataURL := *rootURL
+	metadataURL.Path += metadataURLPath
+	acsURL := *rootURL
+	acsURL.Path += acsURLPath
+
+	return &service{
+		storage:  ssoStorage,
+		accounts: accountService,
+		sp: &saml.ServiceProvider{
+			EntityID:          options.EntityID,
+			Key:               key,
+			Certificate:       cert,
+			MetadataURL:       metadataURL,
+			AcsURL:            acsURL,
+			IDPMetadata:       idpMetadata,
+			AllowIDPInitiated: options.AllowIDPInitiated,
+		},
+		options: options,
+		logger:  logger,
+	}, nil
+}
+
+type Service interface {
+	Metadata() ([]byte, error)
+	Begin(ctx context.Context) (RedirectDTO, error)
+	Assert(ctx context.Context, r *http.Request) (accounts.Account, error)
+}
+
+func (s service) Metadata() ([]byte, error) {
+	return xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+}
+
+//? relay state binds response to request so InResponseTo is validated
+func (s service) Begin(ctx context.Context) (d RedirectDTO, err error) {
+	req, err := s.sp.MakeAuthenticationRequest(s.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding))
+	if err != nil {
+		return d, fmt.Errorf("failed to make authentication request. error: %w", err)
+	}
+
+	relayState, err := token.New(32)
+	if err != nil {
+		return d, err
+	}
+	err = s.storage.CreateRequest(ctx, Request{
+		ID:        token.Hash(relayState),
+		RequestID: req.ID,
+		ExpiresAt: time.Now().Add(requestTTL),
+	})
+	if err != nil {
+		return d, fmt.Errorf("failed to create saml request. error: %w", err)
+	}
+
+	d.RedirectTo = req.Redirect(relayState).String()
+	return d, nil
+}
+
+//? validate signed assertion and provision staff account with mapped roles
+func (s service) Assert(ctx context.Context, r *http.Request) (acc accounts.Account, err error) {
+	if err = r.ParseForm(); err != nil {
+		return acc, apperror.BadRequestError("failed to parse form")
+	}
+
+	var requestIDs []string
+	if relayState := r.PostForm.Get("RelayState"); relayState != "" {
+		req, err := s.storage.TakeRequest(ctx, token.Hash(relayState))
+		if err != nil {
+			if errors.Is(err, apperror.ErrNotFound) {
+				return acc, apperror.ErrExternalLogin
+			}
+			return acc, fmt.Errorf("failed to find saml request. error: %w", err)
+		}
+		if time.Now().After(req.ExpiresAt) {
+			return acc, apperror.ErrExternalLogin
+		}
+		requestIDs = []string{req.RequestID}
+	}
+
+	assertion, err := s.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			s.logger.Warnf("rejected saml response. error: %v", invalid.PrivateErr)
+		}
+		return acc, apperror.ErrExternalLogin
+	}
+
+	attributes := attributeValues(assertion)
+	email := first(attributes[s.options.EmailAttribute])
+	if email == "" && assertion.Subject != nil && assertion.Subject.NameID != nil {
+		email = assertion.Subject.NameID.Value
+	}
+	if email == "" {
+		return acc, apperror.BadRequestError("identity provider didn't share email")
+	}
+
+	roles := make([]string, 0)
+	for _, group := range attributes[s.options.RoleAttribute] {
+		if role, ok := s.options.RoleMapping[group]; ok && !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		s.logger.Warnf("staff %s has no mapped roles", email)
+		return acc, apperror.ErrForbidden
+	}
+
+	acc, err = s.accounts.ProvisionStaff(ctx, accounts.StaffAccountDTO{
+		Email:    email,
+		Username: first(attributes[s.options.NameAttribute]),
+		Roles:    roles,
+	})
+	if err != nil {
+		return acc, err
+	}
+	return acc, acc.CheckSignIn()
+}
+
+func loadIDPMetadata(options Options) (*saml.EntityDescriptor, error) {
+	if options.IDPMetadataFile != "" {
+		data, err := ioutil.ReadFile(options.IDPMetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read idp metadata. error: %w", err)
+		}
+		return samlsp.ParseMetadata(data)
+	}
+
+	metadataURL, err := url.Parse(options.IDPMetadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse idp metadata url. error: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	metadata, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *metadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch idp metadata. error: %w", err)
+	}
+	return metadata, nil
+}
+
+// attributeValues indexes assertion attributes by name and friendly name
+func attributeValues(assertion *saml.Assertion) map[string][]string {
+	values := make(map[string][]string)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			for _, v := range attr.Values {
+				values[attr.Name] = append(values[attr.Name], v.Value)
+				if attr.FriendlyName != "" {
+					values[attr.FriendlyName] = append(values[attr.FriendlyName], v.Value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
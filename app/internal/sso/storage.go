@@ -0,0 +1,8 @@
+package sso
+
+import "context"
+
+type Storage interface {
+	CreateRequest(ctx context.Context, request Request) error
+	TakeRequest(ctx context.Context, id string) (Request, error)
+}
@@ -0,0 +1,124 @@
+package usernames
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charopevez/eob-accountant-worker/internal/accounts"
+	"github.com/charopevez/eob-accountant-worker/internal/apperror"
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+var _ accounts.UsernamePolicy = &Policy{}
+
+// Options.Pattern is regexp every username must match. Options.ProfanityPath is file with one
+// word per line, blank lines and lines starting with # are skipped. empty path disables profanity check
+type Options struct {
+	MinLength     int
+	MaxLength     int
+	Pattern       string
+	Reserved      []string
+	ProfanityPath string
+}
+
+// Policy checks usernames chosen by players. reserved words and profanity are matched on lower case
+// letters and digits only, so that "Ad_min" is reserved too
+type Policy struct {
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+	reserved  map[string]bool
+	profanity []string
+	logger    logging.Logger
+}
+
+func NewPolicy(options Options, logger logging.Logger) (*Policy, error) {
+	if options.MinLength <= 0 || options.MaxLength < options.MinLength {
+		return nil, fmt.Errorf("username length must be positive range")
+	}
+	pattern, err := regexp.Compile(options.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile username pattern. error: %w", err)
+	}
+
+	p := &Policy{
+		minLength: options.MinLength,
+		maxLength: options.MaxLength,
+		pattern:   pattern,
+		reserved:  make(map[string]bool, len(options.Reserved)),
+		logger:    logger,
+	}
+	for _, word := range options.Reserved {
+		if word = fold(word); word != "" {
+			p.reserved[word] = true
+		}
+	}
+	if options.ProfanityPath != "" {
+		if p.profanity, err = readWords(options.ProfanityPath); err != nil {
+			return nil, err
+		}
+		logger.Infof("loaded %d profanity words", len(p.profanity))
+	}
+	return p, nil
+}
+
+func (p *Policy) Check(username string) error {
+	n := utf8.RuneCountInString(username)
+	if n < p.minLength || n > p.maxLength {
+		return apperror.BadRequestError(fmt.Sprintf("username must be %d to %d characters", p.minLength, p.maxLength))
+	}
+	if !p.pattern.MatchString(username) {
+		return apperror.BadRequestError("username contains characters that are not allowed")
+	}
+
+	folded := fold(username)
+	if p.reserved[folded] {
+		p.logger.Debugf("username %s is reserved", username)
+		return apperror.ErrUsernameNotAllowed
+	}
+	for _, word := range p.profanity {
+		if strings.Contains(folded, word) {
+			p.logger.Debugf("username %s contains profanity", username)
+			return apperror.ErrUsernameNotAllowed
+		}
+	}
+	return nil
+}
+
+func readWords(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profanity list. error: %w", err)
+	}
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if word := fold(line); word != "" {
+			words = append(words, word)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read profanity list. error: %w", err)
+	}
+	return words, nil
+}
+
+//? separators don't hide reserved words or profanity
+func fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,144 @@
+package geoip
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB resolves client address with MaxMind database file. file is checked every reload interval and read
+// again when it changes. lookups return empty values while there is no file
+type DB struct {
+	path    string
+	logger  logging.Logger
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// record is part of GeoLite2/GeoIP2 Country and City records we use
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// NewDB loads file at path and starts watching it. empty path disables lookups
+func NewDB(path string, reloadInterval time.Duration, logger logging.Logger) *DB {
+	d := &DB{
+		path:   path,
+		logger: logger,
+	}
+	if path == "" {
+		logger.Warn("geoip database is not configured. client location is unknown")
+		return d
+	}
+
+	d.reload()
+	if reloadInterval > 0 {
+		go d.watch(reloadInterval)
+	}
+	return d
+}
+
+// Country returns ISO 3166-1 alpha-2 code of country
+func (d *DB) Country(ip string) string {
+	r, ok := d.lookup(ip)
+	if !ok {
+		return ""
+	}
+	return r.Country.ISOCode
+}
+
+// Locate returns approximate location like "Berlin, Germany"
+func (d *DB) Locate(ip string) string {
+	r, ok := d.lookup(ip)
+	if !ok {
+		return ""
+	}
+	country := r.Country.Names["en"]
+	if country == "" {
+		country = r.Country.ISOCode
+	}
+	if city := r.City.Names["en"]; city != "" {
+		return fmt.Sprintf("%s, %s", city, country)
+	}
+	return country
+}
+
+func (d *DB) lookup(ip string) (r record, ok bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return r, false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.reader == nil {
+		return r, false
+	}
+	if err := d.reader.Lookup(addr, &r); err != nil {
+		d.logger.Errorf("failed to lookup geoip record. error: %v", err)
+		return r, false
+	}
+	return r, true
+}
+
+func (d *DB) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.reload()
+	}
+}
+
+//? file is read into memory, so it can be replaced while service runs.
+// last loaded database is kept when file is removed or broken
+func (d *DB) reload() {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.logger.Debugf("geoip database %s is absent", d.path)
+			return
+		}
+		d.logger.Errorf("failed to stat geoip database. error: %v", err)
+		return
+	}
+
+	d.mu.RLock()
+	unchanged := info.ModTime().Equal(d.modTime) && info.Size() == d.size
+	d.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		d.logger.Errorf("failed to read geoip database. error: %v", err)
+		return
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		d.logger.Errorf("failed to open geoip database. error: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	d.reader = reader
+	d.modTime = info.ModTime()
+	d.size = info.Size()
+	d.mu.Unlock()
+	d.logger.Infof("geoip database %s loaded. build time %s", d.path,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339))
+}
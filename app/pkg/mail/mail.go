@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/charopevez/eob-accountant-worker/pkg/logging"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type smtpSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// logSender is used in debug mode when smtp host isn't configured. messages are written to log only,
+// bodies carry sign in links and codes, so it is refused outside debug mode
+type logSender struct {
+	logger logging.Logger
+}
+
+func NewSender(host, port, username, password, from string, debug bool, logger logging.Logger) (Sender, error) {
+	if host == "" {
+		if !debug {
+			return nil, fmt.Errorf("smtp host is required unless is_debug is set")
+		}
+		logger.Warn("smtp host is not configured. mail will be written to log")
+		return &logSender{logger: logger}, nil
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpSender{
+		addr: net.JoinHostPort(host, port),
+		from: from,
+		auth: auth,
+	}, nil
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header(s.from))
+	fmt.Fprintf(&b, "To: %s\r\n", header(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(b.String()))
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("failed to send mail due to error %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to send mail due to error %w", ctx.Err())
+	}
+}
+
+func (s *logSender) Send(ctx context.Context, msg Message) error {
+	s.logger.Debugf("mail to: %s subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+//? header values must not break message headers
+func header(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
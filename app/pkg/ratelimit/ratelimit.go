@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows limit requests per key in fixed window. counters are kept in memory,
+// so limit is per worker instance
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	counters map[string]*counter
+}
+
+type counter struct {
+	count   int
+	resetAt time.Time
+}
+
+//? expired counters are swept once per window, so Allow does not scan whole map
+func New(limit int, window time.Duration) *Limiter {
+	l := &Limiter{
+		limit:    limit,
+		window:   window,
+		counters: make(map[string]*counter),
+	}
+	go l.sweep()
+	return l
+}
+
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tNow := time.Now()
+	c, ok := l.counters[key]
+	if !ok || tNow.After(c.resetAt) {
+		c = &counter{resetAt: tNow.Add(l.window)}
+		l.counters[key] = c
+	}
+	if c.count >= l.limit {
+		return false
+	}
+	c.count++
+	return true
+}
+
+func (l *Limiter) sweep() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+	for tNow := range ticker.C {
+		l.mu.Lock()
+		for key, c := range l.counters {
+			if tNow.After(c.resetAt) {
+				delete(l.counters, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,115 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+const (
+	keyTypeOKP = 1
+	keyTypeEC2 = 2
+	keyTypeRSA = 3
+
+	curveP256    = 1
+	curveEd25519 = 6
+)
+
+type coseKey struct {
+	Kty int64 `cbor:"1,keyasint"`
+	Alg int64 `cbor:"3,keyasint"`
+}
+
+//? for EC2 and OKP keys -1 is the curve, -2 and -3 are coordinates
+type curveKey struct {
+	Crv int64  `cbor:"-1,keyasint"`
+	X   []byte `cbor:"-2,keyasint"`
+	Y   []byte `cbor:"-3,keyasint"`
+}
+
+//? for RSA keys -1 is modulus and -2 is exponent
+type rsaKey struct {
+	N []byte `cbor:"-1,keyasint"`
+	E []byte `cbor:"-2,keyasint"`
+}
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func parsePublicKey(raw []byte) (pk publicKey, err error) {
+	var ck coseKey
+	if err = cbor.Unmarshal(raw, &ck); err != nil {
+		return pk, fmt.Errorf("failed to unmarshal credential public key. error: %w", err)
+	}
+	pk.alg = ck.Alg
+
+	switch {
+	case ck.Kty == keyTypeEC2 && ck.Alg == AlgES256:
+		var ek curveKey
+		if err = cbor.Unmarshal(raw, &ek); err != nil || ek.Crv != curveP256 {
+			return pk, fmt.Errorf("invalid ec2 public key")
+		}
+		x, y := new(big.Int).SetBytes(ek.X), new(big.Int).SetBytes(ek.Y)
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return pk, fmt.Errorf("public key point is not on curve")
+		}
+		pk.key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case ck.Kty == keyTypeOKP && ck.Alg == AlgEdDSA:
+		var ok curveKey
+		if err = cbor.Unmarshal(raw, &ok); err != nil || ok.Crv != curveEd25519 || len(ok.X) != ed25519.PublicKeySize {
+			return pk, fmt.Errorf("invalid okp public key")
+		}
+		pk.key = ed25519.PublicKey(ok.X)
+	case ck.Kty == keyTypeRSA && ck.Alg == AlgRS256:
+		var rk rsaKey
+		if err = cbor.Unmarshal(raw, &rk); err != nil {
+			return pk, fmt.Errorf("failed to unmarshal rsa public key. error: %w", err)
+		}
+		pk.key = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(rk.N),
+			E: int(new(big.Int).SetBytes(rk.E).Int64()),
+		}
+	default:
+		return pk, fmt.Errorf("unsupported public key kty %d alg %d", ck.Kty, ck.Alg)
+	}
+
+	return pk, nil
+}
+
+func (pk publicKey) verify(data, signature []byte) error {
+	switch key := pk.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key")
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	publicKeyType = "public-key"
+)
+
+var ErrSignCount = errors.New("signature counter did not increase. authenticator may be cloned")
+
+// RelyingParty is the server side of webauthn ceremonies
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	Timeout time.Duration
+}
+
+// User is the account a credential is created for
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a verified public key credential
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte
+	Algorithm    int64
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+	UserVerified bool
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions passed to navigator.credentials.create
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions passed to navigator.credentials.get
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is JSON serialized PublicKeyCredential returned by navigator.credentials.create
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is JSON serialized PublicKeyCredential returned by navigator.credentials.get
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// Encode returns base64url representation used in JSON messages
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode accepts base64url with or without padding
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (rp *RelyingParty) CreationOptions(user User, challenge []byte, exclude []CredentialDescriptor) CreationOptions {
+	return CreationOptions{
+		Challenge: Encode(challenge),
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User: UserEntity{
+			ID:          Encode(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: publicKeyType, Alg: AlgES256},
+			{Type: publicKeyType, Alg: AlgEdDSA},
+			{Type: publicKeyType, Alg: AlgRS256},
+		},
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds assertion options. empty allow list asks for discoverable credential
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	return RequestOptions{
+		Challenge:        Encode(challenge),
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// VerifyRegistration checks attestation response against issued challenge.
+// attestation statements are not verified as "none" conveyance is requested
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp AttestationResponse) (cred Credential, err error) {
+	if resp.Type != publicKeyType {
+		return cred, fmt.Errorf("unsupported credential type %q", resp.Type)
+	}
+	rawClientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return cred, fmt.Errorf("failed to decode client data. error: %w", err)
+	}
+	if err = rp.verifyClientData(rawClientData, ceremonyCreate, challenge); err != nil {
+		return cred, err
+	}
+
+	rawAttestation, err := Decode(resp.Response.AttestationObject)
+	if err != nil {
+		return cred, fmt.Errorf("failed to decode attestation object. error: %w", err)
+	}
+	var att attestationObject
+	if err = cbor.Unmarshal(rawAttestation, &att); err != nil {
+		return cred, fmt.Errorf("failed to unmarshal attestation object. error: %w", err)
+	}
+
+	authData, err := parseAuthenticatorData(att.AuthData)
+	if err != nil {
+		return cred, err
+	}
+	if err = rp.verifyAuthenticatorData(authData); err != nil {
+		return cred, err
+	}
+	if authData.Flags&flagAttested == 0 {
+		return cred, fmt.Errorf("attested credential data is missing")
+	}
+
+	key, err := parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return cred, err
+	}
+
+	return Credential{
+		ID:           authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		Algorithm:    key.alg,
+		SignCount:    authData.SignCount,
+		AAGUID:       authData.AAGUID,
+		Transports:   resp.Response.Transports,
+		UserVerified: authData.Flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks assertion signature with stored credential and returns credential with updated counter
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred Credential, resp AssertionResponse) (Credential, error) {
+	if resp.Type != publicKeyType {
+		return cred, fmt.Errorf("unsupported credential type %q", resp.Type)
+	}
+	rawClientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return cred, fmt.Errorf("failed to decode client data. error: %w", err)
+	}
+	if err = rp.verifyClientData(rawClientData, ceremonyGet, challenge); err != nil {
+		return cred, err
+	}
+
+	rawAuthData, err := Decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return cred, fmt.Errorf("failed to decode authenticator data. error: %w", err)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return cred, err
+	}
+	if err = rp.verifyAuthenticatorData(authData); err != nil {
+		return cred, err
+	}
+
+	signature, err := Decode(resp.Response.Signature)
+	if err != nil {
+		return cred, fmt.Errorf("failed to decode signature. error: %w", err)
+	}
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return cred, err
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err = key.verify(signed, signature); err != nil {
+		return cred, err
+	}
+
+	if (authData.SignCount != 0 || cred.SignCount != 0) && authData.SignCount <= cred.SignCount {
+		return cred, ErrSignCount
+	}
+	cred.SignCount = authData.SignCount
+	cred.UserVerified = authData.Flags&flagUserVerified != 0
+
+	return cred, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("failed to unmarshal client data. error: %w", err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony type %q", cd.Type)
+	}
+	got, err := Decode(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("challenge does not match")
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", cd.Origin)
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return fmt.Errorf("relying party id hash does not match")
+	}
+	if authData.Flags&flagUserPresent == 0 {
+		return fmt.Errorf("user presence flag is not set")
+	}
+	return nil
+}
+
+func parseAuthenticatorData(raw []byte) (authData authenticatorData, err error) {
+	if len(raw) < 37 {
+		return authData, fmt.Errorf("authenticator data is too short")
+	}
+	authData.RPIDHash = raw[:32]
+	authData.Flags = raw[32]
+	authData.SignCount = binary.BigEndian.Uint32(raw[33:37])
+
+	if authData.Flags&flagAttested == 0 {
+		return authData, nil
+	}
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return authData, fmt.Errorf("attested credential data is too short")
+	}
+	authData.AAGUID = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return authData, fmt.Errorf("credential id is truncated")
+	}
+	authData.CredentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	//? public key is followed by extensions map when ED flag is set
+	if authData.Flags&flagExtensions == 0 {
+		authData.PublicKey = rest
+		return authData, nil
+	}
+	var key cbor.RawMessage
+	dec := cbor.NewDecoder(bytes.NewReader(rest))
+	if err = dec.Decode(&key); err != nil {
+		return authData, fmt.Errorf("failed to decode credential public key. error: %w", err)
+	}
+	authData.PublicKey = rest[:dec.NumBytesRead()]
+
+	return authData, nil
+}
@@ -0,0 +1,362 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:10005"
+)
+
+//? keys are encoded in canonical order, so same key gives same bytes
+var canonical, _ = cbor.CanonicalEncOptions().EncMode()
+
+// authenticator is software authenticator producing "none" attestation and assertions
+type authenticator struct {
+	alg       int64
+	signer    crypto.Signer
+	credID    []byte
+	signCount uint32
+	flags     byte
+}
+
+func newAuthenticator(t *testing.T, alg int64) *authenticator {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	credID := make([]byte, 16)
+	rand.Read(credID)
+	return &authenticator{alg: alg, signer: signer, credID: credID, flags: flagUserPresent | flagUserVerified}
+}
+
+func (a *authenticator) coseKey(t *testing.T) []byte {
+	t.Helper()
+	var key map[int]interface{}
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		key = map[int]interface{}{1: keyTypeEC2, 3: AlgES256, -1: curveP256, -2: pad(pub.X.Bytes()), -3: pad(pub.Y.Bytes())}
+	case ed25519.PublicKey:
+		key = map[int]interface{}{1: keyTypeOKP, 3: AlgEdDSA, -1: curveEd25519, -2: []byte(pub)}
+	case *rsa.PublicKey:
+		key = map[int]interface{}{1: keyTypeRSA, 3: AlgRS256, -1: pub.N.Bytes(), -2: big.NewInt(int64(pub.E)).Bytes()}
+	}
+	raw, err := canonical.Marshal(key)
+	if err != nil {
+		t.Fatalf("failed to marshal cose key: %v", err)
+	}
+	return raw
+}
+
+func (a *authenticator) authData(t *testing.T, rpID string, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= flagAttested
+	}
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+	data = append(append(data, flags), counter...)
+	if attested {
+		idLen := make([]byte, 2)
+		binary.BigEndian.PutUint16(idLen, uint16(len(a.credID)))
+		data = append(data, make([]byte, 16)...)
+		data = append(data, idLen...)
+		data = append(data, a.credID...)
+		data = append(data, a.coseKey(t)...)
+	}
+	return data
+}
+
+func (a *authenticator) create(t *testing.T, rpID, origin string, challenge []byte) AttestationResponse {
+	t.Helper()
+	att, err := canonical.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, rpID, true),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal attestation object: %v", err)
+	}
+	var resp AttestationResponse
+	resp.ID = Encode(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = publicKeyType
+	resp.Response.ClientDataJSON = Encode(clientDataJSON(t, ceremonyCreate, origin, challenge))
+	resp.Response.AttestationObject = Encode(att)
+	return resp
+}
+
+func (a *authenticator) get(t *testing.T, rpID, origin string, challenge []byte) AssertionResponse {
+	t.Helper()
+	a.signCount++
+	authData := a.authData(t, rpID, false)
+	cd := clientDataJSON(t, ceremonyGet, origin, challenge)
+	hash := sha256.Sum256(cd)
+	signed := append(append([]byte{}, authData...), hash[:]...)
+
+	var signature []byte
+	var err error
+	if a.alg == AlgEdDSA {
+		signature, err = a.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	var resp AssertionResponse
+	resp.ID = Encode(a.credID)
+	resp.RawID = resp.ID
+	resp.Type = publicKeyType
+	resp.Response.ClientDataJSON = Encode(cd)
+	resp.Response.AuthenticatorData = Encode(authData)
+	resp.Response.Signature = Encode(signature)
+	return resp
+}
+
+func clientDataJSON(t *testing.T, ceremony, origin string, challenge []byte) []byte {
+	t.Helper()
+	raw, err := json.Marshal(clientData{Type: ceremony, Challenge: Encode(challenge), Origin: origin})
+	if err != nil {
+		t.Fatalf("failed to marshal client data: %v", err)
+	}
+	return raw
+}
+
+func pad(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func newRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "eob", Origins: []string{testOrigin}}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	es := newAuthenticator(t, AlgES256)
+	ed := newAuthenticator(t, AlgEdDSA)
+	rs := newAuthenticator(t, AlgRS256)
+	ecKey := es.signer.Public().(*ecdsa.PublicKey)
+
+	mustMarshal := func(v interface{}) []byte {
+		raw, err := canonical.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		alg     int64
+		wantErr bool
+	}{
+		{name: "es256", raw: es.coseKey(t), alg: AlgES256},
+		{name: "eddsa", raw: ed.coseKey(t), alg: AlgEdDSA},
+		{name: "rs256", raw: rs.coseKey(t), alg: AlgRS256},
+		{
+			name:    "point is not on curve",
+			raw:     mustMarshal(map[int]interface{}{1: keyTypeEC2, 3: AlgES256, -1: curveP256, -2: pad(ecKey.X.Bytes()), -3: pad(ecKey.X.Bytes())}),
+			wantErr: true,
+		},
+		{
+			name:    "ec2 key on other curve",
+			raw:     mustMarshal(map[int]interface{}{1: keyTypeEC2, 3: AlgES256, -1: 2, -2: pad(ecKey.X.Bytes()), -3: pad(ecKey.Y.Bytes())}),
+			wantErr: true,
+		},
+		{
+			name:    "short ed25519 key",
+			raw:     mustMarshal(map[int]interface{}{1: keyTypeOKP, 3: AlgEdDSA, -1: curveEd25519, -2: []byte{1, 2, 3}}),
+			wantErr: true,
+		},
+		{
+			name:    "key type does not match algorithm",
+			raw:     mustMarshal(map[int]interface{}{1: keyTypeOKP, 3: AlgES256, -1: curveP256}),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			raw:     mustMarshal(map[int]interface{}{1: keyTypeEC2, 3: -35, -1: 2}),
+			wantErr: true,
+		},
+		{name: "malformed cbor", raw: []byte{0xa5, 0x01}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk, err := parsePublicKey(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && pk.alg != tt.alg {
+				t.Errorf("parsePublicKey() alg = %d, want %d", pk.alg, tt.alg)
+			}
+		})
+	}
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	a := newAuthenticator(t, AlgES256)
+	attested := a.authData(t, testRPID, true)
+	key := a.coseKey(t)
+
+	withExtensions := append([]byte{}, attested...)
+	withExtensions[32] |= flagExtensions
+	extensions, _ := canonical.Marshal(map[string]interface{}{"credProtect": 2})
+	withExtensions = append(withExtensions, extensions...)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantKey []byte
+		wantErr bool
+	}{
+		{name: "assertion", raw: a.authData(t, testRPID, false)},
+		{name: "attested credential", raw: attested, wantKey: key},
+		{name: "public key followed by extensions", raw: withExtensions, wantKey: key},
+		{name: "too short", raw: attested[:36], wantErr: true},
+		{name: "attested data is too short", raw: attested[:37+17], wantErr: true},
+		{name: "credential id is truncated", raw: attested[:37+18+len(a.credID)-1], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authData, err := parseAuthenticatorData(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAuthenticatorData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantKey != nil && string(authData.PublicKey) != string(tt.wantKey) {
+				t.Errorf("parseAuthenticatorData() public key = %x, want %x", authData.PublicKey, tt.wantKey)
+			}
+			if tt.wantKey != nil && string(authData.CredentialID) != string(a.credID) {
+				t.Errorf("parseAuthenticatorData() credential id = %x, want %x", authData.CredentialID, a.credID)
+			}
+		})
+	}
+}
+
+func TestCeremonies(t *testing.T) {
+	rp := newRelyingParty()
+	challenge := []byte("registration challenge 32 bytes!")
+	other := []byte("other challenge of 32 bytes long")
+
+	for _, alg := range []int64{AlgES256, AlgEdDSA, AlgRS256} {
+		a := newAuthenticator(t, alg)
+		cred, err := rp.VerifyRegistration(challenge, a.create(t, testRPID, testOrigin, challenge))
+		if err != nil {
+			t.Fatalf("alg %d: VerifyRegistration() error = %v", alg, err)
+		}
+		if cred.Algorithm != alg || string(cred.ID) != string(a.credID) || !cred.UserVerified {
+			t.Fatalf("alg %d: VerifyRegistration() credential = %+v", alg, cred)
+		}
+
+		cred, err = rp.VerifyAssertion(challenge, cred, a.get(t, testRPID, testOrigin, challenge))
+		if err != nil {
+			t.Fatalf("alg %d: VerifyAssertion() error = %v", alg, err)
+		}
+		if cred.SignCount != a.signCount {
+			t.Errorf("alg %d: VerifyAssertion() sign count = %d, want %d", alg, cred.SignCount, a.signCount)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(a *authenticator, resp *AssertionResponse)
+		rpID   string
+		origin string
+		sent   []byte
+	}{
+		{name: "other challenge", sent: other},
+		{name: "unknown origin", origin: "http://evil.local"},
+		{name: "other relying party", rpID: "evil.local"},
+		{
+			name: "tampered signature",
+			modify: func(a *authenticator, resp *AssertionResponse) {
+				sig, _ := Decode(resp.Response.Signature)
+				sig[len(sig)-1] ^= 0xff
+				resp.Response.Signature = Encode(sig)
+			},
+		},
+		{
+			name: "user is not present",
+			modify: func(a *authenticator, resp *AssertionResponse) {
+				a.flags = 0
+				*resp = a.get(t, testRPID, testOrigin, challenge)
+			},
+		},
+		{
+			name: "replayed counter",
+			modify: func(a *authenticator, resp *AssertionResponse) {
+				a.signCount = 0
+				*resp = a.get(t, testRPID, testOrigin, challenge)
+			},
+		},
+		{
+			name: "wrong ceremony type",
+			modify: func(a *authenticator, resp *AssertionResponse) {
+				resp.Response.ClientDataJSON = Encode(clientDataJSON(t, ceremonyCreate, testOrigin, challenge))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t, AlgES256)
+			cred, err := rp.VerifyRegistration(challenge, a.create(t, testRPID, testOrigin, challenge))
+			if err != nil {
+				t.Fatalf("VerifyRegistration() error = %v", err)
+			}
+			cred.SignCount = 1
+			a.signCount = 1
+
+			rpID, origin, sent := testRPID, testOrigin, challenge
+			if tt.rpID != "" {
+				rpID = tt.rpID
+			}
+			if tt.origin != "" {
+				origin = tt.origin
+			}
+			if tt.sent != nil {
+				sent = tt.sent
+			}
+			resp := a.get(t, rpID, origin, sent)
+			if tt.modify != nil {
+				tt.modify(a, &resp)
+			}
+			if _, err = rp.VerifyAssertion(challenge, cred, resp); err == nil {
+				t.Errorf("VerifyAssertion() accepted %s", tt.name)
+			}
+		})
+	}
+}